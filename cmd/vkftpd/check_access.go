@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkUser    string
+	checkPath    string
+	checkRequire string
+)
+
+var checkAccessCmd = &cobra.Command{
+	Use:   "check-access",
+	Short: "Show the effective permission of a user on a path",
+	Long: `Show the effective permission of a user on a path, as the server would resolve it
+from the configured access_file_path and character_dir_path.
+
+With --require, exits nonzero when the effective permission is below the given
+level (read, grant_read, write, grant_write, grant_grant or a number).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			return fmt.Errorf("config file is required")
+		}
+		if checkUser == "" || checkPath == "" {
+			return fmt.Errorf("--user and --path are required")
+		}
+
+		var required authorization.Permission
+		if checkRequire != "" {
+			var err error
+			if required, err = parsePermissionName(checkRequire); err != nil {
+				return err
+			}
+		}
+
+		var config Config
+		if err := LoadConfig(cfgFile, &config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		charSource := newUserSource(&config, newCharacterSource(&config, config.CharacterDirPath))
+		accessSource := authorization.NewAccessFileSource(config.AccessFilePath)
+
+		// Load the access file up front so a bad file is reported rather than
+		// silently resolving every path to Revoked
+		rawData, err := accessSource.LoadAccessData()
+		if err != nil {
+			return err
+		}
+		if _, err := authorization.BuildAccessTrees(rawData); err != nil {
+			return fmt.Errorf("building access trees: %w", err)
+		}
+
+		authorizer := authorization.NewAuthorizer(accessSource, charSource, 0)
+		perm := authorizer.ResolvePermission(checkUser, checkPath)
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "user:       %s\n", checkUser)
+		fmt.Fprintf(out, "path:       %s\n", checkPath)
+		fmt.Fprintf(out, "groups:     %s\n", strings.Join(authorizer.ResolveGroups(checkUser), ", "))
+		fmt.Fprintf(out, "permission: %s\n", perm)
+
+		if checkRequire != "" && perm < required {
+			return fmt.Errorf("permission %s is below required %s", perm, required)
+		}
+		return nil
+	},
+}
+
+// parsePermissionName accepts a permission name as understood by
+// authorization.ParsePermission, or its numeric level
+func parsePermissionName(s string) (authorization.Permission, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return authorization.Permission(n), nil
+	}
+	return authorization.ParsePermission(s)
+}
+
+func init() {
+	checkAccessCmd.Flags().StringVarP(&checkUser, "user", "u", "", "username to check")
+	checkAccessCmd.Flags().StringVarP(&checkPath, "path", "p", "", "path to check, relative to the FTP root")
+	checkAccessCmd.Flags().StringVar(&checkRequire, "require", "", "exit nonzero if the permission is below this level")
+	rootCmd.AddCommand(checkAccessCmd)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAccessFile = `access_map ([2|` +
+	`"frodo":([3|".":1,"*":1,"players":([2|"*":1,"sam":3])]),` +
+	`"*":([2|"*":1,"secret":-1])` +
+	`])
+`
+
+// writeCheckAccessConfig creates an access file, character directory and
+// config in a temp dir and returns the config path
+func writeCheckAccessConfig(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	writeConfigFile(t, tmpDir, "access.o", testAccessFile)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "characters"), 0755); err != nil {
+		t.Fatalf("Failed to create character dir: %v", err)
+	}
+
+	return writeConfigFile(t, tmpDir, "config.json", `{
+    "ftp_root_dir": ".",
+    "character_dir_path": "characters",
+    "access_file_path": "access.o"
+}`)
+}
+
+func TestCheckAccessCommand(t *testing.T) {
+	cfg := writeCheckAccessConfig(t)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantPerm string
+		wantErr  bool
+	}{
+		{"UserTree", []string{"--user", "frodo", "--path", "/players/sam/notes"}, "Write", false},
+		{"DefaultTree", []string{"--user", "gandalf", "--path", "/doc"}, "Read", false},
+		{"DefaultRevoked", []string{"--user", "gandalf", "--path", "/secret"}, "Revoked", false},
+		{"ImplicitHome", []string{"--user", "gandalf", "--path", "/players/gandalf"}, "GrantGrant", false},
+		{"RequireMet", []string{"--user", "frodo", "--path", "/players/sam", "--require", "write"}, "Write", false},
+		{"RequireNumeric", []string{"--user", "frodo", "--path", "/players/sam", "--require", "3"}, "Write", false},
+		{"RequireNotMet", []string{"--user", "gandalf", "--path", "/doc", "--require", "grant_read"}, "Read", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"check-access", "--config", cfg}, tt.args...)
+			out, err := executeCommand(t, "", args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("check-access error = %v, wantErr %v\n%s", err, tt.wantErr, out)
+			}
+			if !strings.Contains(out, "permission: "+tt.wantPerm+"\n") {
+				t.Errorf("Expected permission %s, got:\n%s", tt.wantPerm, out)
+			}
+		})
+	}
+}
+
+func TestCheckAccessCommandErrors(t *testing.T) {
+	cfg := writeCheckAccessConfig(t)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"MissingUser", []string{"check-access", "--config", cfg, "--path", "/"}},
+		{"MissingConfig", []string{"check-access", "--user", "frodo", "--path", "/"}},
+		{"BadRequire", []string{"check-access", "--config", cfg, "--user", "frodo", "--path", "/", "--require", "everything"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := executeCommand(t, "", tt.args...); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
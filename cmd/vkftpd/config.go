@@ -3,59 +3,140 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/ftpserver"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the FTP server configuration
 type Config struct {
 	// Core server settings
-	ListenAddr     string `json:"listen_addr"`     // Address to listen on (e.g., "0.0.0.0")
-	Port           int    `json:"port"`            // Port to listen on (e.g., 2121)
-	MaxConnections int    `json:"max_connections"` // Maximum concurrent connections
-	IdleTimeout    int    `json:"idle_timeout"`    // Connection idle timeout in seconds
-	FTPRootDir     string `json:"ftp_root_dir"`    // Root directory that FTP users will be restricted to
-	HomePattern    string `json:"home_pattern"`    // Pattern for user home directories (e.g., "players/%s")
+	ListenAddr            string            `json:"listen_addr" yaml:"listen_addr"`                           // Address to listen on (e.g., "0.0.0.0")
+	Port                  int               `json:"port" yaml:"port"`                                         // Port to listen on (e.g., 2121)
+	MaxConnections        int               `json:"max_connections" yaml:"max_connections"`                   // Maximum concurrent connections
+	MaxConnectionsPerUser int               `json:"max_connections_per_user" yaml:"max_connections_per_user"` // Maximum concurrent sessions per user (0 for no limit)
+	IdleTimeout           int               `json:"idle_timeout" yaml:"idle_timeout"`                         // Connection idle timeout in seconds
+	FTPRootDir            string            `json:"ftp_root_dir" yaml:"ftp_root_dir"`                         // Root directory that FTP users will be restricted to
+	HomePattern           string            `json:"home_pattern" yaml:"home_pattern"`                         // Pattern for user home directories (e.g., "players/%s" or "players/%l/%s")
+	AutoCreateHome        bool              `json:"auto_create_home" yaml:"auto_create_home"`                 // Create a missing home directory at login if the user may write there
+	HomeDirMode           string            `json:"home_dir_mode" yaml:"home_dir_mode"`                       // Octal permissions of created home directories (default "0755")
+	FileMode              string            `json:"file_mode" yaml:"file_mode"`                               // Octal permissions of uploaded files, before the umask (default "0666")
+	DirMode               string            `json:"dir_mode" yaml:"dir_mode"`                                 // Octal permissions of directories clients create, before the umask (default "0755")
+	WelcomeMessage        string            `json:"welcome_message" yaml:"welcome_message"`                   // Banner template; supports {version}, {hostname} and {time}
+	DirMessageFile        string            `json:"dir_message_file" yaml:"dir_message_file"`                 // Per-directory message file shown at login (e.g., ".message")
+	SymlinkPolicy         string            `json:"symlink_policy" yaml:"symlink_policy"`                     // How paths through symlinks are authorized ("authorize", "refuse" or "follow")
+	MaxPathLength         int               `json:"max_path_length" yaml:"max_path_length"`                   // Longest path clients may send, in bytes (default 4096)
+	PathAliases           map[string]string `json:"path_aliases" yaml:"path_aliases"`                         // FTP paths served from another directory under ftp_root_dir (e.g., "/pub": "/lib/open/pub")
 
 	// Transfer settings
-	PasvPortRange [2]int `json:"pasv_port_range"` // Range of ports for passive mode transfers
-	PasvAddress   string `json:"pasv_address"`    // Public IP for passive mode connections
-	PasvIPVerify  bool   `json:"pasv_ip_verify"`  // Whether to verify data connection IPs
+	PasvPortRange         [2]int `json:"pasv_port_range" yaml:"pasv_port_range"`                   // Range of ports for passive mode transfers
+	PasvAddress           string `json:"pasv_address" yaml:"pasv_address"`                         // Public IP for passive mode connections
+	PasvAddressAutoDetect bool   `json:"pasv_address_auto_detect" yaml:"pasv_address_auto_detect"` // Detect the public IP at startup, falling back to pasv_address
+	PasvAddressDetectURL  string `json:"pasv_address_detect_url" yaml:"pasv_address_detect_url"`   // Endpoint that returns the caller's IP as plain text
+	PasvListenAddr        string `json:"pasv_listen_addr" yaml:"pasv_listen_addr"`                 // Local IP passive data connections must arrive on (default: any)
+	PasvIPVerify          bool   `json:"pasv_ip_verify" yaml:"pasv_ip_verify"`                     // Whether to verify data connection IPs
+	ActiveMode            bool   `json:"active_mode" yaml:"active_mode"`                           // Whether to allow active (PORT) data connections
+	DefaultTransferType   string `json:"default_transfer_type" yaml:"default_transfer_type"`       // Transfer type before the client sends TYPE ("ascii" or "binary", default "ascii")
+	MaxUploadBytes        int    `json:"max_upload_bytes" yaml:"max_upload_bytes"`                 // Largest file an upload may produce, in bytes (0 for no limit)
 
 	// Security settings
-	TLSCertFile string `json:"tls_cert_file"` // Path to TLS certificate file
-	TLSKeyFile  string `json:"tls_key_file"`  // Path to TLS private key file
+	TLSCertFile           string   `json:"tls_cert_file" yaml:"tls_cert_file"`                       // Path to TLS certificate file
+	TLSKeyFile            string   `json:"tls_key_file" yaml:"tls_key_file"`                         // Path to TLS private key file
+	TLSMinVersion         string   `json:"tls_min_version" yaml:"tls_min_version"`                   // Minimum TLS version ("1.2" or "1.3", default "1.2")
+	TLSCipherSuites       []string `json:"tls_cipher_suites" yaml:"tls_cipher_suites"`               // Allowed TLS 1.2 cipher suites by name (default: Go's defaults)
+	ImplicitTLSPort       int      `json:"implicit_tls_port" yaml:"implicit_tls_port"`               // Additional port for implicit FTPS (e.g., 990)
+	RequireTLSControl     bool     `json:"require_tls_control" yaml:"require_tls_control"`           // Refuse logins on plaintext control connections
+	RequireTLSData        bool     `json:"require_tls_data" yaml:"require_tls_data"`                 // Refuse plaintext data transfers
+	ClientCAFile          string   `json:"client_ca_file" yaml:"client_ca_file"`                     // CA bundle trusted to sign client certificates; enables certificate logins
+	RequireClientCert     bool     `json:"require_client_cert" yaml:"require_client_cert"`           // Refuse TLS connections without a trusted client certificate
+	ClientCertUserPattern string   `json:"client_cert_user_pattern" yaml:"client_cert_user_pattern"` // Regexp whose first group extracts the username from the certificate CN
+	AllowedCIDRs          []string `json:"allowed_cidrs" yaml:"allowed_cidrs"`                       // If set, only clients in these networks may connect
+	DeniedCIDRs           []string `json:"denied_cidrs" yaml:"denied_cidrs"`                         // Clients in these networks are always rejected
+	AllowedCommands       []string `json:"allowed_commands" yaml:"allowed_commands"`                 // If set, only these FTP commands may run
+	DeniedCommands        []string `json:"denied_commands" yaml:"denied_commands"`                   // FTP commands that are always refused
+	AllowAnonymous        bool     `json:"allow_anonymous" yaml:"allow_anonymous"`                   // Allow read-only logins as "anonymous" or "ftp"
+	AnonymousUser         string   `json:"anonymous_user" yaml:"anonymous_user"`                     // Username anonymous sessions are authorized as
+	AllowedUsers          []string `json:"allowed_users" yaml:"allowed_users"`                       // If set, only these users may log in (anonymous logins are unaffected)
+	MinLoginLevel         int      `json:"min_login_level" yaml:"min_login_level"`                   // Lowest character level that may log in (0 for any)
+	ProtectedPaths        []string `json:"protected_paths" yaml:"protected_paths"`                   // Files and directories clients may never write (default: access_file_path and the character directories)
 
 	// MUD-specific paths
-	CharacterDirPath string `json:"character_dir_path"` // Path to character files directory
-	AccessFilePath   string `json:"access_file_path"`   // Path to the MUD's access.o file
+	CharacterDirPath       string `json:"character_dir_path" yaml:"character_dir_path"`                 // Path to character files directory
+	ArchiveCharacterDir    string `json:"archive_character_dir_path" yaml:"archive_character_dir_path"` // Character directory consulted when a character is not in character_dir_path
+	CharacterLayout        string `json:"character_layout" yaml:"character_layout"`                     // How character files are arranged ("letter" or "flat")
+	CharacterFileExtension string `json:"character_file_extension" yaml:"character_file_extension"`     // Extension of character files (default ".o")
+	AccessFilePath         string `json:"access_file_path" yaml:"access_file_path"`                     // Path to the MUD's access.o file
+	ProposedAccessFilePath string `json:"proposed_access_file_path" yaml:"proposed_access_file_path"`   // Replacement access file the admin server's /simulate-access compares against recent requests
 
 	// Cache settings
-	CharacterCacheTime int `json:"character_cache_time"` // How long to cache character data (seconds)
-	AccessCacheTime    int `json:"access_cache_time"`    // How long to cache access data (seconds)
+	CharacterCacheTime int      `json:"character_cache_time" yaml:"character_cache_time"` // How long to cache character data (seconds)
+	AccessCacheTime    int      `json:"access_cache_time" yaml:"access_cache_time"`       // How long to cache access data (seconds)
+	AuthCacheTime      int      `json:"auth_cache_time" yaml:"auth_cache_time"`           // How long to cache successful logins (seconds, 0 disables)
+	PreloadCharacters  []string `json:"preload_characters" yaml:"preload_characters"`     // Characters loaded into the cache at startup
+	WatchCharacters    bool     `json:"watch_characters" yaml:"watch_characters"`         // Drop cached characters as soon as their files change
 
 	// Logging settings
-	AccessLogPath     string `json:"access_log_path"`      // Path to access log file
-	AppLogPath        string `json:"app_log_path"`         // Path to application log file
-	LogLevel          string `json:"log_level"`            // Log level (debug, info, warn, error, panic)
-	MaxLogSize        int    `json:"max_log_size"`         // Maximum log size in bytes before rotation
-	LogVerifyInterval int    `json:"log_verify_interval"`  // Seconds between file verification checks
+	AccessLogPath      string `json:"access_log_path" yaml:"access_log_path"`           // Path to access log file
+	AppLogPath         string `json:"app_log_path" yaml:"app_log_path"`                 // Path to application log file
+	AuditLogPath       string `json:"audit_log_path" yaml:"audit_log_path"`             // Path to audit log of denials and failed logins
+	LogLevel           string `json:"log_level" yaml:"log_level"`                       // Log level (debug, info, warn, error, panic)
+	MaxLogSize         int    `json:"max_log_size" yaml:"max_log_size"`                 // Maximum log size in bytes before rotation
+	LogVerifyInterval  int    `json:"log_verify_interval" yaml:"log_verify_interval"`   // Seconds between file verification checks
+	LogMirror          string `json:"log_mirror" yaml:"log_mirror"`                     // Also write both logs to "stdout" or "stderr"
+	LogTimezone        string `json:"log_timezone" yaml:"log_timezone"`                 // Time zone of log timestamps ("UTC", "Local" or an IANA name)
+	LogTimestampFormat string `json:"log_timestamp_format" yaml:"log_timestamp_format"` // Go time layout of log timestamps
+	LogOutput          string `json:"log_output" yaml:"log_output"`                     // Where logs go: "file" (default), "syslog" or "both"
+	SyslogFacility     string `json:"syslog_facility" yaml:"syslog_facility"`           // Syslog facility (default "daemon")
+	SyslogTag          string `json:"syslog_tag" yaml:"syslog_tag"`                     // Syslog tag (default "vkftpd")
+	SyslogAddress      string `json:"syslog_address" yaml:"syslog_address"`             // Remote syslog as "network:address" (e.g., "udp:loghost:514"); default local
+	LogTransferSizes   bool   `json:"log_transfer_sizes" yaml:"log_transfer_sizes"`     // Log the size of files opened for download, at the cost of a stat (default true)
 
 	// Status monitoring (optional)
-	StatusDir string `json:"status_dir"` // Directory for status files (last_start, running, last_stop)
+	StatusDir      string `json:"status_dir" yaml:"status_dir"`           // Directory for status files (last_start, running, last_stop)
+	StatusFormat   string `json:"status_format" yaml:"status_format"`     // Status file encoding ("text" or "json", default "text")
+	MetricsAddr    string `json:"metrics_addr" yaml:"metrics_addr"`       // Address for the Prometheus /metrics endpoint (e.g., "127.0.0.1:9121")
+	HealthAddr     string `json:"health_addr" yaml:"health_addr"`         // Address for the /healthz and /readyz probes (e.g., "127.0.0.1:9122")
+	AdminAddr      string `json:"admin_addr" yaml:"admin_addr"`           // Address for the unauthenticated /simulate-access tool (e.g., "127.0.0.1:9123")
+	RecentRequests int    `json:"recent_requests" yaml:"recent_requests"` // Permission checks kept for /simulate-access (default 1000, 0 keeps none)
 }
 
-// LoadConfig loads configuration from a JSON file
+// LoadConfig loads configuration from a JSON or YAML file. The format is
+// chosen by extension: .yaml and .yml are parsed as YAML, anything else as JSON.
 func LoadConfig(path string, config *Config) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("reading config file: %w", err)
 	}
 
-	if err := json.Unmarshal(data, config); err != nil {
+	// Defaults the file must be able to turn off are set before parsing
+	config.LogTransferSizes = true
+	config.RecentRequests = 1000
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, config)
+	default:
+		err = json.Unmarshal(data, config)
+	}
+	if err != nil {
 		return fmt.Errorf("parsing config file: %w", err)
 	}
 
+	// Environment variables take precedence over the file
+	if err := applyEnvOverrides(config); err != nil {
+		return err
+	}
+
 	// Convert relative paths to absolute paths based on config file location
 	configDir := filepath.Dir(path)
 	if !filepath.IsAbs(config.FTPRootDir) {
@@ -64,9 +145,15 @@ func LoadConfig(path string, config *Config) error {
 	if !filepath.IsAbs(config.CharacterDirPath) {
 		config.CharacterDirPath = filepath.Join(configDir, config.CharacterDirPath)
 	}
+	if config.ArchiveCharacterDir != "" && !filepath.IsAbs(config.ArchiveCharacterDir) {
+		config.ArchiveCharacterDir = filepath.Join(configDir, config.ArchiveCharacterDir)
+	}
 	if !filepath.IsAbs(config.AccessFilePath) {
 		config.AccessFilePath = filepath.Join(configDir, config.AccessFilePath)
 	}
+	if config.ProposedAccessFilePath != "" && !filepath.IsAbs(config.ProposedAccessFilePath) {
+		config.ProposedAccessFilePath = filepath.Join(configDir, config.ProposedAccessFilePath)
+	}
 
 	// Only convert log paths to absolute if they are specified and not absolute
 	if config.AccessLogPath != "" && !filepath.IsAbs(config.AccessLogPath) {
@@ -75,6 +162,9 @@ func LoadConfig(path string, config *Config) error {
 	if config.AppLogPath != "" && !filepath.IsAbs(config.AppLogPath) {
 		config.AppLogPath = filepath.Join(configDir, config.AppLogPath)
 	}
+	if config.AuditLogPath != "" && !filepath.IsAbs(config.AuditLogPath) {
+		config.AuditLogPath = filepath.Join(configDir, config.AuditLogPath)
+	}
 
 	// Convert status directory to absolute if specified and not absolute
 	if config.StatusDir != "" && !filepath.IsAbs(config.StatusDir) {
@@ -88,6 +178,23 @@ func LoadConfig(path string, config *Config) error {
 	if config.TLSKeyFile != "" && !filepath.IsAbs(config.TLSKeyFile) {
 		config.TLSKeyFile = filepath.Join(configDir, config.TLSKeyFile)
 	}
+	if config.ClientCAFile != "" && !filepath.IsAbs(config.ClientCAFile) {
+		config.ClientCAFile = filepath.Join(configDir, config.ClientCAFile)
+	}
+
+	// Protect the files logins and permissions are read from unless told
+	// otherwise; an empty list protects nothing
+	if config.ProtectedPaths == nil {
+		config.ProtectedPaths = []string{config.AccessFilePath, config.CharacterDirPath}
+		if config.ArchiveCharacterDir != "" {
+			config.ProtectedPaths = append(config.ProtectedPaths, config.ArchiveCharacterDir)
+		}
+	}
+	for i, p := range config.ProtectedPaths {
+		if !filepath.IsAbs(p) {
+			config.ProtectedPaths[i] = filepath.Join(configDir, p)
+		}
+	}
 
 	// Set defaults for optional settings
 	if config.Port == 0 {
@@ -105,6 +212,9 @@ func LoadConfig(path string, config *Config) error {
 	if config.IdleTimeout == 0 {
 		config.IdleTimeout = 300 // 5 minutes
 	}
+	if config.CharacterFileExtension == "" {
+		config.CharacterFileExtension = users.DefaultExtension
+	}
 	if config.CharacterCacheTime == 0 {
 		config.CharacterCacheTime = 60 // 1 minute
 	}
@@ -117,6 +227,316 @@ func LoadConfig(path string, config *Config) error {
 	if config.LogVerifyInterval == 0 {
 		config.LogVerifyInterval = 45 // 45 seconds
 	}
+	// Recent requests are only read by /simulate-access, so none are kept
+	// without a proposed access file to compare them against
+	if config.ProposedAccessFilePath == "" {
+		config.RecentRequests = 0
+	}
+
+	return nil
+}
+
+// envPrefix is prepended to the upper-cased json tag of each Config field to
+// form its override variable, e.g. VKFTPD_PORT for "port"
+const envPrefix = "VKFTPD_"
+
+// applyEnvOverrides replaces config fields with the values of any matching
+// VKFTPD_* environment variables that are set. Port ranges and lists are
+// written comma-separated, e.g. "start,end", and maps as comma-separated
+// key=value pairs.
+func applyEnvOverrides(config *Config) error {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name := envPrefix + strings.ToUpper(tag)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := setField(v.Field(i), strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("parsing %s: %w", name, err)
+		}
+	}
 
 	return nil
 }
+
+// setField parses value into a Config field according to its kind
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		if value != "" {
+			items = strings.Split(value, ",")
+		}
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setField(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(field.Type())
+		if value != "" {
+			for _, pair := range strings.Split(value, ",") {
+				key, val, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("expected key=value, got %q", strings.TrimSpace(pair))
+				}
+				m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), reflect.ValueOf(strings.TrimSpace(val)))
+			}
+		}
+		field.Set(m)
+	case reflect.Array:
+		parts := strings.Split(value, ",")
+		if len(parts) != field.Len() {
+			return fmt.Errorf("expected %d comma-separated values, got %d", field.Len(), len(parts))
+		}
+		for i, part := range parts {
+			if err := setField(field.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// newCharacterSource creates the character file source for dir described by
+// the config. The layout must already have passed Validate.
+func newCharacterSource(c *Config, dir string) *users.FileSource {
+	source := users.NewFileSource(dir)
+	if pathFunc, err := users.ParseLayout(c.CharacterLayout); err == nil {
+		source.SetPathFunc(pathFunc)
+	}
+	source.SetExtension(c.CharacterFileExtension)
+	return source
+}
+
+// newUserSource returns live, falling back to the archive character
+// directory when one is configured
+func newUserSource(c *Config, live *users.FileSource) users.Source {
+	if c.ArchiveCharacterDir == "" {
+		return live
+	}
+	return users.NewMultiSource(live, newCharacterSource(c, c.ArchiveCharacterDir))
+}
+
+// parseMode parses the octal permissions in the setting key, returning 0
+// (the server default) when value is empty
+func parseMode(key, value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("%s %q must be octal permissions such as \"0755\"", key, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// logPaths returns the access and app log paths to open, which are empty
+// when log_output sends logs only to syslog
+func (c *Config) logPaths() (access, app string) {
+	if c.LogOutput == "syslog" {
+		return "", ""
+	}
+	return c.AccessLogPath, c.AppLogPath
+}
+
+// syslogConfig returns the syslog settings, or nil if log_output does not
+// use syslog. The address must already have passed Validate.
+func (c *Config) syslogConfig() *logging.SyslogConfig {
+	if c.LogOutput != "syslog" && c.LogOutput != "both" {
+		return nil
+	}
+	config := &logging.SyslogConfig{Facility: c.SyslogFacility, Tag: c.SyslogTag}
+	if c.SyslogAddress != "" {
+		config.Network, config.Address, _ = strings.Cut(c.SyslogAddress, ":")
+	}
+	return config
+}
+
+// Validate checks the configuration for values the server cannot run with.
+// All problems are reported together in a single error.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.FTPRootDir == "" {
+		problems = append(problems, "ftp_root_dir is required")
+	} else if info, err := os.Stat(c.FTPRootDir); err != nil {
+		problems = append(problems, fmt.Sprintf("ftp_root_dir %q does not exist", c.FTPRootDir))
+	} else if !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("ftp_root_dir %q is not a directory", c.FTPRootDir))
+	}
+
+	if !validPort(c.Port) {
+		problems = append(problems, fmt.Sprintf("port %d is out of range (1-65535)", c.Port))
+	}
+
+	start, end := c.PasvPortRange[0], c.PasvPortRange[1]
+	if !validPort(start) || !validPort(end) {
+		problems = append(problems, fmt.Sprintf("pasv_port_range [%d, %d] contains a port out of range (1-65535)", start, end))
+	} else if start > end {
+		problems = append(problems, fmt.Sprintf("pasv_port_range start %d is greater than end %d", start, end))
+	}
+
+	if c.PasvListenAddr != "" {
+		if _, err := netip.ParseAddr(c.PasvListenAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("pasv_listen_addr %q is not an IP address", c.PasvListenAddr))
+		}
+	}
+
+	if c.MinLoginLevel < 0 {
+		problems = append(problems, fmt.Sprintf("min_login_level %d must not be negative", c.MinLoginLevel))
+	}
+	if c.MaxConnectionsPerUser < 0 {
+		problems = append(problems, fmt.Sprintf("max_connections_per_user %d must not be negative", c.MaxConnectionsPerUser))
+	}
+	if c.MaxPathLength < 0 {
+		problems = append(problems, fmt.Sprintf("max_path_length %d must not be negative", c.MaxPathLength))
+	}
+	if c.MaxUploadBytes < 0 {
+		problems = append(problems, fmt.Sprintf("max_upload_bytes %d must not be negative", c.MaxUploadBytes))
+	}
+	if c.RecentRequests < 0 {
+		problems = append(problems, fmt.Sprintf("recent_requests %d must not be negative", c.RecentRequests))
+	}
+	if c.ProposedAccessFilePath != "" && c.AdminAddr == "" {
+		problems = append(problems, "proposed_access_file_path requires admin_addr")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "tls_cert_file and tls_key_file must be set together")
+	}
+	if _, err := ftpserver.ParseTLSVersion(c.TLSMinVersion); err != nil {
+		problems = append(problems, fmt.Sprintf("tls_min_version: %v", err))
+	}
+	if _, err := ftpserver.ParseCipherSuites(c.TLSCipherSuites); err != nil {
+		problems = append(problems, fmt.Sprintf("tls_cipher_suites: %v", err))
+	}
+	if c.ImplicitTLSPort != 0 {
+		if !validPort(c.ImplicitTLSPort) {
+			problems = append(problems, fmt.Sprintf("implicit_tls_port %d is out of range (1-65535)", c.ImplicitTLSPort))
+		} else if c.ImplicitTLSPort == c.Port {
+			problems = append(problems, fmt.Sprintf("implicit_tls_port %d is the same as port", c.ImplicitTLSPort))
+		}
+		if c.TLSCertFile == "" {
+			problems = append(problems, "implicit_tls_port requires tls_cert_file and tls_key_file")
+		}
+	}
+	if (c.RequireTLSControl || c.RequireTLSData) && c.TLSCertFile == "" {
+		problems = append(problems, "require_tls_control and require_tls_data require tls_cert_file and tls_key_file")
+	}
+	if c.ClientCAFile != "" && c.TLSCertFile == "" {
+		problems = append(problems, "client_ca_file requires tls_cert_file and tls_key_file")
+	}
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		problems = append(problems, "require_client_cert requires client_ca_file")
+	}
+	if c.ClientCertUserPattern != "" {
+		if pattern, err := regexp.Compile(c.ClientCertUserPattern); err != nil {
+			problems = append(problems, fmt.Sprintf("client_cert_user_pattern %q is not a valid regular expression", c.ClientCertUserPattern))
+		} else if pattern.NumSubexp() < 1 {
+			problems = append(problems, fmt.Sprintf("client_cert_user_pattern %q must contain a capture group", c.ClientCertUserPattern))
+		}
+	}
+
+	for _, cidr := range append(append([]string{}, c.AllowedCIDRs...), c.DeniedCIDRs...) {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid CIDR %q in allowed_cidrs/denied_cidrs", cidr))
+		}
+	}
+
+	for _, command := range append(append([]string{}, c.AllowedCommands...), c.DeniedCommands...) {
+		if err := ftpserver.ValidateCommand(command); err != nil {
+			problems = append(problems, fmt.Sprintf("allowed_commands/denied_commands: %v", err))
+		}
+	}
+
+	aliases := make([]string, 0, len(c.PathAliases))
+	for from := range c.PathAliases {
+		aliases = append(aliases, from)
+	}
+	sort.Strings(aliases)
+	for _, from := range aliases {
+		if err := ftpserver.ValidatePathAlias(from, c.PathAliases[from]); err != nil {
+			problems = append(problems, fmt.Sprintf("path_aliases: %v", err))
+		}
+	}
+
+	if _, err := ftpserver.ParseTransferType(c.DefaultTransferType); err != nil {
+		problems = append(problems, fmt.Sprintf("default_transfer_type: %v", err))
+	}
+
+	if _, err := ftpserver.ParseSymlinkPolicy(c.SymlinkPolicy); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := logging.ParseMirror(c.LogMirror); err != nil {
+		problems = append(problems, fmt.Sprintf("log_mirror: %v", err))
+	}
+	if _, err := logging.ParseTimezone(c.LogTimezone); err != nil {
+		problems = append(problems, fmt.Sprintf("log_timezone: %v", err))
+	}
+	switch c.LogOutput {
+	case "", "file", "syslog", "both":
+	default:
+		problems = append(problems, fmt.Sprintf("log_output %q must be \"file\", \"syslog\" or \"both\"", c.LogOutput))
+	}
+	if err := logging.ValidateSyslogFacility(c.SyslogFacility); err != nil {
+		problems = append(problems, fmt.Sprintf("syslog_facility: %v", err))
+	}
+	if c.SyslogAddress != "" {
+		if network, address, ok := strings.Cut(c.SyslogAddress, ":"); !ok || network == "" || address == "" {
+			problems = append(problems, fmt.Sprintf("syslog_address %q must be \"network:address\", e.g. \"udp:loghost:514\"", c.SyslogAddress))
+		}
+	}
+
+	if _, err := users.ParseLayout(c.CharacterLayout); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.HomePattern != "" {
+		if err := ftpserver.ValidateHomePattern(c.HomePattern); err != nil {
+			problems = append(problems, fmt.Sprintf("home_pattern %v", err))
+		}
+	}
+	for _, mode := range [][2]string{{"home_dir_mode", c.HomeDirMode}, {"file_mode", c.FileMode}, {"dir_mode", c.DirMode}} {
+		if _, err := parseMode(mode[0], mode[1]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfigJSON = `{
+    "listen_addr": "127.0.0.1",
+    "port": 2121,
+    "max_connections": 20,
+    "ftp_root_dir": "mud/lib",
+    "home_pattern": "players/%s",
+    "pasv_port_range": [2122, 2150],
+    "pasv_ip_verify": true,
+    "character_dir_path": "mud/lib/characters",
+    "access_file_path": "mud/lib/dgd/sys/data/access.o",
+    "access_cache_time": 30,
+    "app_log_path": "log/vkftpd-app.log",
+    "log_level": "debug",
+    "status_dir": "status"
+}`
+
+const testConfigYAML = `# Same settings as testConfigJSON
+listen_addr: 127.0.0.1
+port: 2121
+max_connections: 20
+ftp_root_dir: mud/lib
+home_pattern: players/%s
+pasv_port_range: [2122, 2150]
+pasv_ip_verify: true
+character_dir_path: mud/lib/characters
+access_file_path: mud/lib/dgd/sys/data/access.o
+access_cache_time: 30
+app_log_path: log/vkftpd-app.log
+log_level: debug
+status_dir: status
+`
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var fromJSON Config
+	if err := LoadConfig(writeConfigFile(t, tmpDir, "config.json", testConfigJSON), &fromJSON); err != nil {
+		t.Fatalf("Failed to load JSON config: %v", err)
+	}
+
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		t.Run(name, func(t *testing.T) {
+			var fromYAML Config
+			if err := LoadConfig(writeConfigFile(t, tmpDir, name, testConfigYAML), &fromYAML); err != nil {
+				t.Fatalf("Failed to load YAML config: %v", err)
+			}
+
+			if !reflect.DeepEqual(fromJSON, fromYAML) {
+				t.Errorf("YAML config does not match JSON config\njson: %+v\nyaml: %+v", fromJSON, fromYAML)
+			}
+		})
+	}
+
+	// Path resolution and defaults apply to YAML the same way
+	if want := filepath.Join(tmpDir, "mud/lib"); fromJSON.FTPRootDir != want {
+		t.Errorf("Expected FTPRootDir %s, got %s", want, fromJSON.FTPRootDir)
+	}
+	if fromJSON.CharacterCacheTime != 60 {
+		t.Errorf("Expected default CharacterCacheTime 60, got %d", fromJSON.CharacterCacheTime)
+	}
+}
+
+func TestLoadConfigInvalidYAML(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var config Config
+	path := writeConfigFile(t, tmpDir, "config.yaml", "port: [not a number\n")
+	if err := LoadConfig(path, &config); err == nil {
+		t.Error("Expected error for malformed YAML")
+	}
+}
+
+func TestLoadConfigLogTransferSizes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var config Config
+	if err := LoadConfig(writeConfigFile(t, tmpDir, "config.yaml", testConfigYAML), &config); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !config.LogTransferSizes {
+		t.Error("Expected log_transfer_sizes to default to true")
+	}
+
+	config = Config{}
+	if err := LoadConfig(writeConfigFile(t, tmpDir, "off.yaml", testConfigYAML+"log_transfer_sizes: false\n"), &config); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.LogTransferSizes {
+		t.Error("Expected log_transfer_sizes: false to turn size logging off")
+	}
+}
+
+func TestLoadConfigProtectedPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var config Config
+	if err := LoadConfig(writeConfigFile(t, tmpDir, "config.yaml", testConfigYAML), &config); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(tmpDir, "mud/lib/dgd/sys/data/access.o"),
+		filepath.Join(tmpDir, "mud/lib/characters"),
+	}
+	if !reflect.DeepEqual(config.ProtectedPaths, want) {
+		t.Errorf("Expected protected_paths to default to %v, got %v", want, config.ProtectedPaths)
+	}
+
+	config = Config{}
+	if err := LoadConfig(writeConfigFile(t, tmpDir, "none.yaml", testConfigYAML+"protected_paths: []\n"), &config); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(config.ProtectedPaths) != 0 {
+		t.Errorf("Expected an empty protected_paths to protect nothing, got %v", config.ProtectedPaths)
+	}
+
+	config = Config{}
+	if err := LoadConfig(writeConfigFile(t, tmpDir, "custom.yaml", testConfigYAML+"protected_paths: [mud/lib/secure]\n"), &config); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if want := []string{filepath.Join(tmpDir, "mud/lib/secure")}; !reflect.DeepEqual(config.ProtectedPaths, want) {
+		t.Errorf("Expected protected_paths %v, got %v", want, config.ProtectedPaths)
+	}
+}
+
+func TestLoadConfigRecentRequests(t *testing.T) {
+	tmpDir := t.TempDir()
+	proposed := testConfigYAML + "admin_addr: 127.0.0.1:9123\nproposed_access_file_path: mud/lib/access.proposed.o\n"
+
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"Default", proposed, 1000},
+		{"Explicit", proposed + "recent_requests: 50\n", 50},
+		{"Disabled", proposed + "recent_requests: 0\n", 0},
+		// Nothing reads the requests without a proposed access file
+		{"NoProposedFile", testConfigYAML + "recent_requests: 50\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			if err := LoadConfig(writeConfigFile(t, tmpDir, tt.name+".yaml", tt.content), &config); err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if config.RecentRequests != tt.want {
+				t.Errorf("RecentRequests = %d, want %d", config.RecentRequests, tt.want)
+			}
+		})
+	}
+}
+
+// validConfig returns a config that passes Validate
+func validConfig(t *testing.T) Config {
+	return Config{
+		Port:          2121,
+		FTPRootDir:    t.TempDir(),
+		HomePattern:   "players/%s",
+		PasvPortRange: [2]int{2122, 2150},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	notADir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"Valid", func(c *Config) {}, ""},
+		{"ValidWithTLS", func(c *Config) { c.TLSCertFile, c.TLSKeyFile = "cert.pem", "key.pem" }, ""},
+		{"ValidWithoutHomePattern", func(c *Config) { c.HomePattern = "" }, ""},
+		{"MissingRootDir", func(c *Config) { c.FTPRootDir = "" }, "ftp_root_dir is required"},
+		{"NonexistentRootDir", func(c *Config) { c.FTPRootDir = "/nonexistent/vkftpd" }, "does not exist"},
+		{"RootDirIsFile", func(c *Config) { c.FTPRootDir = notADir }, "is not a directory"},
+		{"PortTooLow", func(c *Config) { c.Port = 0 }, "port 0 is out of range"},
+		{"PortTooHigh", func(c *Config) { c.Port = 70000 }, "port 70000 is out of range"},
+		{"PasvRangeReversed", func(c *Config) { c.PasvPortRange = [2]int{2150, 2122} }, "start 2150 is greater than end 2122"},
+		{"PasvRangeInvalid", func(c *Config) { c.PasvPortRange = [2]int{2122, 99999} }, "contains a port out of range"},
+		{"CertWithoutKey", func(c *Config) { c.TLSCertFile = "cert.pem" }, "must be set together"},
+		{"KeyWithoutCert", func(c *Config) { c.TLSKeyFile = "key.pem" }, "must be set together"},
+		{"ValidClientCerts", func(c *Config) {
+			c.TLSCertFile, c.TLSKeyFile, c.ClientCAFile = "cert.pem", "key.pem", "ca.pem"
+			c.RequireClientCert, c.ClientCertUserPattern = true, `^backup-(\w+)$`
+		}, ""},
+		{"ValidTLSVersion", func(c *Config) { c.TLSMinVersion = "1.3" }, ""},
+		{"InvalidTLSVersion", func(c *Config) { c.TLSMinVersion = "1.0" }, "tls_min_version"},
+		{"InvalidCipherSuite", func(c *Config) { c.TLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }, "tls_cipher_suites"},
+		{"InvalidLogMirror", func(c *Config) { c.LogMirror = "journald" }, "log_mirror"},
+		{"InvalidLogTimezone", func(c *Config) { c.LogTimezone = "Middle/Earth" }, "log_timezone"},
+		{"InvalidLogOutput", func(c *Config) { c.LogOutput = "journald" }, "log_output"},
+		{"InvalidSyslogFacility", func(c *Config) { c.SyslogFacility = "local9" }, "syslog_facility"},
+		{"InvalidSyslogAddress", func(c *Config) { c.SyslogAddress = "loghost" }, "syslog_address"},
+		{"ValidImplicitTLS", func(c *Config) { c.TLSCertFile, c.TLSKeyFile, c.ImplicitTLSPort = "cert.pem", "key.pem", 990 }, ""},
+		{"ImplicitTLSWithoutCert", func(c *Config) { c.ImplicitTLSPort = 990 }, "implicit_tls_port requires tls_cert_file"},
+		{"ImplicitTLSSamePort", func(c *Config) { c.TLSCertFile, c.TLSKeyFile, c.ImplicitTLSPort = "cert.pem", "key.pem", 2121 }, "same as port"},
+		{"RequireTLSWithoutCert", func(c *Config) { c.RequireTLSData = true }, "require_tls_data require tls_cert_file"},
+		{"ClientCAWithoutTLS", func(c *Config) { c.ClientCAFile = "ca.pem" }, "client_ca_file requires tls_cert_file"},
+		{"RequireClientCertWithoutCA", func(c *Config) { c.RequireClientCert = true }, "require_client_cert requires client_ca_file"},
+		{"InvalidClientCertPattern", func(c *Config) { c.ClientCertUserPattern = "(" }, "not a valid regular expression"},
+		{"ClientCertPatternNoGroup", func(c *Config) { c.ClientCertUserPattern = "^backup-" }, "must contain a capture group"},
+		{"InvalidCIDR", func(c *Config) { c.DeniedCIDRs = []string{"10.0.0.0/33"} }, "invalid CIDR"},
+		{"InvalidPasvListenAddr", func(c *Config) { c.PasvListenAddr = "eth0" }, "pasv_listen_addr"},
+		{"NegativeMinLoginLevel", func(c *Config) { c.MinLoginLevel = -1 }, "min_login_level"},
+		{"NegativeMaxConnectionsPerUser", func(c *Config) { c.MaxConnectionsPerUser = -1 }, "max_connections_per_user"},
+		{"NegativeMaxPathLength", func(c *Config) { c.MaxPathLength = -1 }, "max_path_length"},
+		{"NegativeMaxUploadBytes", func(c *Config) { c.MaxUploadBytes = -1 }, "max_upload_bytes"},
+		{"RelativePathAlias", func(c *Config) { c.PathAliases = map[string]string{"pub": "/lib/pub"} }, "path_aliases"},
+		{"RootPathAlias", func(c *Config) { c.PathAliases = map[string]string{"/": "/lib"} }, "path_aliases"},
+		{"NegativeRecentRequests", func(c *Config) { c.RecentRequests = -1 }, "recent_requests"},
+		{"ProposedAccessFileWithoutAdmin", func(c *Config) { c.ProposedAccessFilePath = "access.o.new" }, "requires admin_addr"},
+		// The health address is for load balancers and does not serve the tool
+		{"ProposedAccessFileOnHealth", func(c *Config) { c.ProposedAccessFilePath = "access.o.new"; c.HealthAddr = "127.0.0.1:9122" }, "requires admin_addr"},
+		{"ProposedAccessFileWithAdmin", func(c *Config) { c.ProposedAccessFilePath = "access.o.new"; c.AdminAddr = "127.0.0.1:9123" }, ""},
+		{"UnfilterableCommand", func(c *Config) { c.DeniedCommands = []string{"DELE", "USER"} }, "denied_commands"},
+		{"InvalidSymlinkPolicy", func(c *Config) { c.SymlinkPolicy = "sometimes" }, "unknown symlink policy"},
+		{"ValidFlatLayout", func(c *Config) { c.CharacterLayout = "flat" }, ""},
+		{"InvalidCharacterLayout", func(c *Config) { c.CharacterLayout = "nested" }, "unknown character layout"},
+		{"HomePatternNoPlaceholder", func(c *Config) { c.HomePattern = "players" }, "exactly one %s"},
+		{"HomePatternTwoPlaceholders", func(c *Config) { c.HomePattern = "%s/%s" }, "exactly one %s"},
+		{"ValidHomePatternLetter", func(c *Config) { c.HomePattern = "players/%l/%s" }, ""},
+		{"HomePatternUnknownToken", func(c *Config) { c.HomePattern = "players/%d/%s" }, "unknown token %d"},
+		{"ValidHomeDirMode", func(c *Config) { c.HomeDirMode = "0750" }, ""},
+		{"InvalidHomeDirMode", func(c *Config) { c.HomeDirMode = "rwxr-x---" }, "home_dir_mode"},
+		{"HomeDirModeTooLarge", func(c *Config) { c.HomeDirMode = "7777" }, "home_dir_mode"},
+		{"ValidFileAndDirMode", func(c *Config) { c.FileMode, c.DirMode = "0640", "0750" }, ""},
+		{"InvalidFileMode", func(c *Config) { c.FileMode = "644x" }, "file_mode"},
+		{"InvalidDirMode", func(c *Config) { c.DirMode = "0" }, "dir_mode"},
+		{"ValidTransferType", func(c *Config) { c.DefaultTransferType = "ascii" }, ""},
+		{"InvalidTransferType", func(c *Config) { c.DefaultTransferType = "ebcdic" }, "unknown transfer type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(t)
+			tt.modify(&config)
+
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected valid config, got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected error containing %q, got nil", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateAggregatesProblems(t *testing.T) {
+	config := validConfig(t)
+	config.Port = -1
+	config.PasvPortRange = [2]int{3000, 2000}
+	config.TLSCertFile = "cert.pem"
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	for _, want := range []string{"port -1", "pasv_port_range", "tls_cert_file"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := writeConfigFile(t, tmpDir, "config.json", testConfigJSON)
+
+	t.Setenv("VKFTPD_PORT", "3131")
+	t.Setenv("VKFTPD_LISTEN_ADDR", "0.0.0.0")
+	t.Setenv("VKFTPD_FTP_ROOT_DIR", "/srv/mud/lib")
+	t.Setenv("VKFTPD_LOG_LEVEL", "warn")
+	t.Setenv("VKFTPD_PASV_IP_VERIFY", "false")
+	t.Setenv("VKFTPD_PASV_PORT_RANGE", "4000, 4010")
+	t.Setenv("VKFTPD_IDLE_TIMEOUT", "600")
+	t.Setenv("VKFTPD_DENIED_CIDRS", "10.0.0.0/8, 2001:db8::/32")
+	t.Setenv("VKFTPD_PATH_ALIASES", "/pub=/lib/open/pub, /docs=/doc")
+
+	var config Config
+	if err := LoadConfig(path, &config); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Port != 3131 {
+		t.Errorf("Expected port 3131, got %d", config.Port)
+	}
+	if config.ListenAddr != "0.0.0.0" {
+		t.Errorf("Expected listen_addr 0.0.0.0, got %s", config.ListenAddr)
+	}
+	if config.FTPRootDir != "/srv/mud/lib" {
+		t.Errorf("Expected ftp_root_dir /srv/mud/lib, got %s", config.FTPRootDir)
+	}
+	if config.LogLevel != "warn" {
+		t.Errorf("Expected log_level warn, got %s", config.LogLevel)
+	}
+	if config.PasvIPVerify {
+		t.Error("Expected pasv_ip_verify false")
+	}
+	if config.PasvPortRange != [2]int{4000, 4010} {
+		t.Errorf("Expected pasv_port_range [4000 4010], got %v", config.PasvPortRange)
+	}
+	// Env wins over the default as well as the file
+	if config.IdleTimeout != 600 {
+		t.Errorf("Expected idle_timeout 600, got %d", config.IdleTimeout)
+	}
+	if len(config.DeniedCIDRs) != 2 || config.DeniedCIDRs[0] != "10.0.0.0/8" || config.DeniedCIDRs[1] != "2001:db8::/32" {
+		t.Errorf("Expected denied_cidrs [10.0.0.0/8 2001:db8::/32], got %v", config.DeniedCIDRs)
+	}
+	if len(config.PathAliases) != 2 || config.PathAliases["/pub"] != "/lib/open/pub" || config.PathAliases["/docs"] != "/doc" {
+		t.Errorf("Expected path_aliases /pub and /docs, got %v", config.PathAliases)
+	}
+	// Fields without an override keep their file values
+	if config.MaxConnections != 20 {
+		t.Errorf("Expected max_connections 20 from file, got %d", config.MaxConnections)
+	}
+}
+
+func TestEnvOverridesInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := writeConfigFile(t, tmpDir, "config.json", testConfigJSON)
+
+	tests := map[string]string{
+		"VKFTPD_PORT":            "not-a-port",
+		"VKFTPD_PASV_IP_VERIFY":  "maybe",
+		"VKFTPD_PASV_PORT_RANGE": "4000",
+		"VKFTPD_PATH_ALIASES":    "/pub",
+	}
+
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			var config Config
+			err := LoadConfig(path, &config)
+			if err == nil {
+				t.Fatalf("Expected error for %s=%q", name, value)
+			}
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("Expected error to name %s, got: %v", name, err)
+			}
+		})
+	}
+}
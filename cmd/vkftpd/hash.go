@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authentication"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	hashAlgo      string
+	hashFromStdin bool
+)
+
+// cryptSaltChars is the alphabet traditional crypt(3) accepts for salts
+const cryptSaltChars = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var hashCmd = &cobra.Command{
+	Use:   "hash",
+	Short: "Generate a password hash for a character file",
+	Long: `Generate a password hash in the format accepted by the server's verifiers.
+
+The password is prompted for without echo, or read from the first line of
+standard input with --stdin.
+
+Supported algorithms:
+  argon2id  $argon2id$v=19$m=65536,t=2,p=1$<salt>$<hash> (default)
+  crypt     traditional 13-character Unix crypt (only the first 8 characters are significant)`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var password string
+		var err error
+		if hashFromStdin {
+			password, err = readPasswordLine(cmd.InOrStdin())
+		} else {
+			password, err = promptPassword(cmd.ErrOrStderr())
+		}
+		if err != nil {
+			return err
+		}
+
+		hash, err := hashPassword(hashAlgo, password)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), hash)
+		return nil
+	},
+}
+
+// hashPassword hashes password with the named algorithm
+func hashPassword(algo, password string) (string, error) {
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+
+	switch algo {
+	case "argon2id":
+		return authentication.NewArgon2ID().Hash(password)
+	case "crypt":
+		salt, err := randomCryptSalt()
+		if err != nil {
+			return "", err
+		}
+		return authentication.NewUnixCrypt().HashWithSalt(password, salt)
+	case "bcrypt":
+		return "", errors.New("bcrypt is not supported: no verifier accepts bcrypt hashes")
+	default:
+		return "", fmt.Errorf("unknown algorithm %q (expected argon2id or crypt)", algo)
+	}
+}
+
+// randomCryptSalt returns a random two-character crypt(3) salt
+func randomCryptSalt() (string, error) {
+	b := make([]byte, 2)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	return string([]byte{
+		cryptSaltChars[int(b[0])%len(cryptSaltChars)],
+		cryptSaltChars[int(b[1])%len(cryptSaltChars)],
+	}), nil
+}
+
+// readPasswordLine reads a password from the first line of r
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// promptPassword reads a password from the terminal without echo, asking twice
+func promptPassword(prompt io.Writer) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("standard input is not a terminal; use --stdin to pipe the password")
+	}
+
+	fmt.Fprint(prompt, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+
+	fmt.Fprint(prompt, "Confirm password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+
+	if string(password) != string(confirm) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(password), nil
+}
+
+func init() {
+	hashCmd.Flags().StringVar(&hashAlgo, "algo", "argon2id", "hash algorithm (argon2id, crypt)")
+	hashCmd.Flags().BoolVar(&hashFromStdin, "stdin", false, "read the password from standard input instead of prompting")
+	rootCmd.AddCommand(hashCmd)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authentication"
+)
+
+func TestHashCommand(t *testing.T) {
+	verifier := authentication.NewVerifier()
+
+	for _, algo := range []string{"argon2id", "crypt"} {
+		t.Run(algo, func(t *testing.T) {
+			out, err := executeCommand(t, "hunter22\n", "hash", "--algo", algo, "--stdin")
+			if err != nil {
+				t.Fatalf("hash command failed: %v", err)
+			}
+
+			hash := strings.TrimSpace(out)
+			if err := verifier.VerifyPassword("hunter22", hash); err != nil {
+				t.Errorf("Emitted hash %q does not verify: %v", hash, err)
+			}
+			if err := verifier.VerifyPassword("wrong", hash); err == nil {
+				t.Errorf("Emitted hash %q verified a wrong password", hash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordErrors(t *testing.T) {
+	tests := []struct {
+		algo     string
+		password string
+	}{
+		{"argon2id", ""},
+		{"bcrypt", "hunter22"},
+		{"md5", "hunter22"},
+	}
+
+	for _, tt := range tests {
+		if _, err := hashPassword(tt.algo, tt.password); err == nil {
+			t.Errorf("hashPassword(%q, %q) expected error", tt.algo, tt.password)
+		}
+	}
+}
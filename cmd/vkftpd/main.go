@@ -12,7 +12,9 @@ import (
 	"github.com/mmcdole/viking-ftpd/pkg/authentication"
 	"github.com/mmcdole/viking-ftpd/pkg/authorization"
 	"github.com/mmcdole/viking-ftpd/pkg/ftpserver"
+	"github.com/mmcdole/viking-ftpd/pkg/health"
 	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/metrics"
 	"github.com/mmcdole/viking-ftpd/pkg/status"
 	"github.com/mmcdole/viking-ftpd/pkg/users"
 	"github.com/spf13/cobra"
@@ -38,7 +40,8 @@ var rootCmd = &cobra.Command{
 This server integrates with VikingMUD's authentication and access control systems,
 providing secure FTP access while respecting the MUD's permissions system.
 
-Configuration file must be in JSON format with the following structure:
+Configuration file must be in JSON (or YAML, for .yaml/.yml files) format with the
+following structure:
 {
     "listen_addr": "0.0.0.0",
     "port": 2121,
@@ -49,6 +52,7 @@ Configuration file must be in JSON format with the following structure:
     "pasv_port_range": [2122, 2150],
     "pasv_address": "",
     "pasv_ip_verify": false,
+    "active_mode": false,
     "tls_cert_file": "/path/to/cert.pem",
     "tls_key_file": "/path/to/key.pem",
     "character_dir_path": "/mud/lib/characters",
@@ -57,7 +61,8 @@ Configuration file must be in JSON format with the following structure:
     "access_cache_time": 60,
     "access_log_path": "/mud/lib/log/vkftpd-access.log",
     "app_log_path": "/mud/lib/log/vkftpd-app.log",
-    "log_level": "info"
+    "log_level": "info",
+    "metrics_addr": ""
 }`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if showVersion {
@@ -83,41 +88,88 @@ Configuration file must be in JSON format with the following structure:
 		if err := LoadConfig(cfgFile, &config); err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := config.Validate(); err != nil {
+			return err
+		}
 
 		// Initialize logging
-		if err := logging.Initialize(
-			config.AccessLogPath,
-			config.AppLogPath,
-			logging.LogLevel(config.LogLevel),
-			int64(config.MaxLogSize),
-			time.Duration(config.LogVerifyInterval)*time.Second,
-		); err != nil {
+		if err := initLogging(&config); err != nil {
 			return fmt.Errorf("failed to initialize logging: %w", err)
 		}
 		defer logging.Shutdown()
 
-		// Create user source
-		charSource := users.NewFileSource(config.CharacterDirPath)
+		// Create user source. The archive directory, if any, is only
+		// consulted for characters missing from the live one.
+		charSource := newCharacterSource(&config, config.CharacterDirPath)
+		userSource := newUserSource(&config, charSource)
 
 		// Create authenticator
 		// Use a multi-hash verifier that supports both legacy unixcrypt and argon2id
-		authenticator := authentication.NewAuthenticator(charSource, authentication.NewVerifier())
+		authenticator := authentication.NewAuthenticator(userSource, authentication.NewVerifier())
+		authenticator.SetCacheDuration(time.Duration(config.AuthCacheTime) * time.Second)
 
-		// Create authorizer for permission checks
+		// Create authorizer for permission checks. Character levels used for
+		// implicit groups are cached; logins always read the character file.
+		charRepository := users.NewRepository(userSource, time.Duration(config.CharacterCacheTime)*time.Second)
 		accessSource := authorization.NewAccessFileSource(config.AccessFilePath)
-		authorizer := authorization.NewAuthorizer(accessSource, charSource, time.Duration(config.AccessCacheTime)*time.Second)
+		authorizer := authorization.NewAuthorizer(accessSource, charRepository, time.Duration(config.AccessCacheTime)*time.Second)
+		defer authorizer.Close()
+		if config.WatchCharacters {
+			if err := charSource.Watch(charRepository.Invalidate); err != nil {
+				return fmt.Errorf("failed to watch character files: %w", err)
+			}
+			defer charSource.Close()
+		}
 
-		// Create and start FTP server
+		// Create and start FTP server. Validate has already checked the modes.
+		homeDirMode, _ := parseMode("home_dir_mode", config.HomeDirMode)
+		fileMode, _ := parseMode("file_mode", config.FileMode)
+		dirMode, _ := parseMode("dir_mode", config.DirMode)
 		server, err := ftpserver.New(&ftpserver.Config{
-			ListenAddr:    config.ListenAddr,
-			Port:          config.Port,
-			RootDir:       config.FTPRootDir,
-			HomePattern:   config.HomePattern,
-			TLSCertFile:   config.TLSCertFile,
-			TLSKeyFile:    config.TLSKeyFile,
-			PasvPortRange: config.PasvPortRange,
-			PasvAddress:   config.PasvAddress,
-			PasvIPVerify:  config.PasvIPVerify,
+			ListenAddr:            config.ListenAddr,
+			Port:                  config.Port,
+			RootDir:               config.FTPRootDir,
+			HomePattern:           config.HomePattern,
+			AutoCreateHome:        config.AutoCreateHome,
+			HomeDirMode:           homeDirMode,
+			FileMode:              fileMode,
+			DirMode:               dirMode,
+			DefaultTransferType:   config.DefaultTransferType,
+			LogTransferSizes:      config.LogTransferSizes,
+			MaxPathLength:         config.MaxPathLength,
+			MaxUploadBytes:        int64(config.MaxUploadBytes),
+			PathAliases:           config.PathAliases,
+			ProtectedPaths:        config.ProtectedPaths,
+			RecentRequests:        config.RecentRequests,
+			MaxConnectionsPerUser: config.MaxConnectionsPerUser,
+			AllowedUsers:          config.AllowedUsers,
+			MinLoginLevel:         config.MinLoginLevel,
+			TLSCertFile:           config.TLSCertFile,
+			TLSKeyFile:            config.TLSKeyFile,
+			TLSMinVersion:         config.TLSMinVersion,
+			TLSCipherSuites:       config.TLSCipherSuites,
+			ImplicitTLSPort:       config.ImplicitTLSPort,
+			RequireTLSControl:     config.RequireTLSControl,
+			RequireTLSData:        config.RequireTLSData,
+			ClientCAFile:          config.ClientCAFile,
+			RequireClientCert:     config.RequireClientCert,
+			ClientCertUserPattern: config.ClientCertUserPattern,
+			PasvPortRange:         config.PasvPortRange,
+			PasvAddress:           config.PasvAddress,
+			PasvAddressAutoDetect: config.PasvAddressAutoDetect,
+			PasvAddressDetectURL:  config.PasvAddressDetectURL,
+			PasvListenAddr:        config.PasvListenAddr,
+			PasvIPVerify:          config.PasvIPVerify,
+			ActiveMode:            config.ActiveMode,
+			AllowedCIDRs:          config.AllowedCIDRs,
+			DeniedCIDRs:           config.DeniedCIDRs,
+			AllowedCommands:       config.AllowedCommands,
+			DeniedCommands:        config.DeniedCommands,
+			WelcomeMessage:        config.WelcomeMessage,
+			DirMessageFile:        config.DirMessageFile,
+			SymlinkPolicy:         ftpserver.SymlinkPolicy(config.SymlinkPolicy),
+			AllowAnonymous:        config.AllowAnonymous,
+			AnonymousUser:         config.AnonymousUser,
 		}, authorizer, authenticator, version)
 		if err != nil {
 			return fmt.Errorf("failed to create FTP server: %w", err)
@@ -126,12 +178,20 @@ Configuration file must be in JSON format with the following structure:
 		// Initialize status writer if configured
 		var statusWriter *status.Writer
 		if config.StatusDir != "" {
+			statusFormat, err := status.ParseFormat(config.StatusFormat)
+			if err != nil {
+				return fmt.Errorf("invalid status format: %w", err)
+			}
+
 			statusWriter, err = status.New(config.StatusDir, 10*time.Second, version)
 			if err != nil {
 				return fmt.Errorf("failed to create status writer: %w", err)
 			}
 
+			statusWriter.SetFormat(statusFormat)
+
 			statusWriter.SetMetricsProvider(server)
+			statusWriter.SetAccessProvider(authorizer)
 
 			if err := statusWriter.WriteStartFile(); err != nil {
 				return fmt.Errorf("failed to write start file: %w", err)
@@ -143,12 +203,60 @@ Configuration file must be in JSON format with the following structure:
 			defer statusWriter.Shutdown("unexpected_exit")
 		}
 
+		// Start metrics endpoint if configured
+		var metricsServer *metrics.Server
+		if config.MetricsAddr != "" {
+			metricsServer = metrics.NewServer(config.MetricsAddr, server)
+			if err := metricsServer.Start(); err != nil {
+				return fmt.Errorf("failed to start metrics server: %w", err)
+			}
+			defer metricsServer.Shutdown(context.Background())
+		}
+
+		// Start health probes if configured
+		if config.HealthAddr != "" {
+			healthServer := health.NewServer(config.HealthAddr, server.Ready)
+			if err := healthServer.Start(); err != nil {
+				return fmt.Errorf("failed to start health server: %w", err)
+			}
+			defer healthServer.Shutdown(context.Background())
+		}
+
+		// Start the admin endpoint if a proposed access file is configured. It
+		// shows who has been accessing what, so it is kept off health_addr,
+		// which load balancers are meant to reach.
+		if config.ProposedAccessFilePath != "" {
+			adminServer, err := startAdminServer(config.AdminAddr, simulateAccessHandler(server, accessSource, config.ProposedAccessFilePath, charRepository))
+			if err != nil {
+				return fmt.Errorf("failed to start admin server: %w", err)
+			}
+			defer adminServer.Shutdown(context.Background())
+		}
+
+		// Warm the caches so the first logins are not slowed by cold loads
+		warmStart := time.Now()
+		if err := authorizer.Warm(); err != nil {
+			logging.App.Warn("Failed to preload access trees", "error", err)
+		}
+		preloaded := charRepository.Warm(config.PreloadCharacters)
+		logging.App.Info("Caches warmed", "duration", time.Since(warmStart), "characters", preloaded)
+
 		logging.App.Info("Starting VikingMUD FTP Server", "version", version, "listen_addr", config.ListenAddr, "port", config.Port)
 
 		// Set up signal handling for graceful shutdown
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+		// SIGHUP reopens the logs with the current logging settings
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		defer signal.Stop(hupChan)
+		go func() {
+			for range hupChan {
+				reloadLogging(cfgFile)
+			}
+		}()
+
 		// Start server in goroutine
 		serverErr := make(chan error, 1)
 		go func() {
@@ -201,6 +309,54 @@ Configuration file must be in JSON format with the following structure:
 	},
 }
 
+// initLogging (re)initializes the global loggers from the logging section of config
+func initLogging(config *Config) error {
+	mirror, err := logging.ParseMirror(config.LogMirror)
+	if err != nil {
+		return err
+	}
+	location, err := logging.ParseTimezone(config.LogTimezone)
+	if err != nil {
+		return err
+	}
+	accessLogPath, appLogPath := config.logPaths()
+	if err := logging.Initialize(
+		accessLogPath,
+		appLogPath,
+		config.AuditLogPath,
+		logging.LogLevel(config.LogLevel),
+		int64(config.MaxLogSize),
+		time.Duration(config.LogVerifyInterval)*time.Second,
+		mirror,
+		config.syslogConfig(),
+	); err != nil {
+		return err
+	}
+	logging.SetTimestampFormat(location, config.LogTimestampFormat)
+	return nil
+}
+
+// reloadLogging re-reads the config file and reinitializes logging from it.
+// On any error the current loggers are left in place.
+func reloadLogging(path string) {
+	var config Config
+	if err := LoadConfig(path, &config); err != nil {
+		logging.App.Error("Failed to reload logging configuration", "error", err)
+		return
+	}
+	if err := config.Validate(); err != nil {
+		logging.App.Error("Failed to reload logging configuration", "error", err)
+		return
+	}
+
+	if err := initLogging(&config); err != nil {
+		logging.App.Error("Failed to reload logging configuration", "error", err)
+		return
+	}
+
+	logging.App.Info("Reloaded logging configuration", "log_level", config.LogLevel, "app_log_path", config.AppLogPath, "access_log_path", config.AccessLogPath, "audit_log_path", config.AuditLogPath)
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file path")
 	rootCmd.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "show version")
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// executeCommand runs rootCmd with args and returns what it wrote to stdout.
+// Flags are reset afterwards so tests do not leak values into each other.
+func executeCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	rootCmd.SetIn(strings.NewReader(stdin))
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs(args)
+	t.Cleanup(func() {
+		rootCmd.SetIn(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetArgs(nil)
+
+		reset := func(f *pflag.Flag) {
+			_ = f.Value.Set(f.DefValue)
+			f.Changed = false
+		}
+		rootCmd.PersistentFlags().VisitAll(reset)
+		for _, cmd := range rootCmd.Commands() {
+			cmd.Flags().VisitAll(reset)
+		}
+	})
+
+	err := rootCmd.Execute()
+	return out.String(), err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/lpc"
+	"github.com/spf13/cobra"
+)
+
+var scanStrict bool
+
+var scanCharactersCmd = &cobra.Command{
+	Use:   "scan-characters",
+	Short: "Report character files that cannot be parsed",
+	Long: `Report character files that cannot be parsed.
+
+Walks character_dir_path, parses every file with character_file_extension and
+prints each file with errors along with its first error, followed by an
+overall success rate. The exit status is nonzero if any file failed.
+
+By default every entry of a file is parsed and the number of errors is
+shown. With --strict, parsing stops at the first error, as it does in tests
+that treat any damage as fatal.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			return fmt.Errorf("config file is required")
+		}
+
+		var config Config
+		if err := LoadConfig(cfgFile, &config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		scanned, failed, err := scanCharacters(cmd.OutOrStdout(), config.CharacterDirPath, config.CharacterFileExtension, scanStrict)
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d character files failed to parse", failed, scanned)
+		}
+		return nil
+	},
+}
+
+// scanCharacters parses every file under dir ending in extension, writing a
+// line to out for each file that fails and a summary at the end. It returns
+// the number of files scanned and the number that failed.
+func scanCharacters(out io.Writer, dir, extension string, strict bool) (scanned, failed int, err error) {
+	parser := lpc.NewObjectParser(strict)
+
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, extension) {
+			return nil
+		}
+		scanned++
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "%s: %v\n", path, err)
+			return nil
+		}
+
+		result, err := parser.ParseObject(string(data))
+		switch {
+		case result != nil && len(result.Errors) > 0:
+			failed++
+			first := result.Errors[0]
+			fmt.Fprintf(out, "%s:%d: %v (%d errors)\n", path, first.Line, first.Err, result.Stats.Errors)
+		case err != nil:
+			failed++
+			var parseErr *lpc.ParseError
+			if errors.As(err, &parseErr) {
+				fmt.Fprintf(out, "%s:%d: %v\n", path, parseErr.Line, parseErr.Err)
+			} else {
+				fmt.Fprintf(out, "%s: %v\n", path, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return scanned, failed, fmt.Errorf("scanning %s: %w", dir, err)
+	}
+
+	rate := 100.0
+	if scanned > 0 {
+		rate = float64(scanned-failed) / float64(scanned) * 100
+	}
+	fmt.Fprintf(out, "%d files scanned, %d failed (%.1f%% parsed cleanly)\n", scanned, failed, rate)
+	return scanned, failed, nil
+}
+
+func init() {
+	scanCharactersCmd.Flags().BoolVar(&scanStrict, "strict", false, "stop parsing each file at its first error")
+	rootCmd.AddCommand(scanCharactersCmd)
+}
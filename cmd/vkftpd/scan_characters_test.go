@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScanConfig(t *testing.T) (cfg, charDir string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	charDir = filepath.Join(tmpDir, "characters", "f")
+	if err := os.MkdirAll(charDir, 0755); err != nil {
+		t.Fatalf("Failed to create character dir: %v", err)
+	}
+	writeConfigFile(t, charDir, "frodo.o", "password \"hash\"\nlevel 1\n")
+	writeConfigFile(t, tmpDir, "access.o", testAccessFile)
+
+	cfg = writeConfigFile(t, tmpDir, "config.json", `{
+    "ftp_root_dir": ".",
+    "character_dir_path": "characters",
+    "access_file_path": "access.o"
+}`)
+	return cfg, charDir
+}
+
+func TestScanCharactersCommand(t *testing.T) {
+	cfg, charDir := writeScanConfig(t)
+
+	out, err := executeCommand(t, "", "scan-characters", "--config", cfg)
+	if err != nil {
+		t.Fatalf("Expected clean scan, got: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "1 files scanned, 0 failed (100.0% parsed cleanly)") {
+		t.Errorf("Expected clean summary, got:\n%s", out)
+	}
+
+	writeConfigFile(t, charDir, "fatty.o", "password \"hash\"\nlevel  1\ngender 1\n")
+	writeConfigFile(t, charDir, "notes.txt", "not a character\n")
+
+	for _, strict := range []bool{false, true} {
+		args := []string{"scan-characters", "--config", cfg}
+		if strict {
+			args = append(args, "--strict")
+		}
+		out, err := executeCommand(t, "", args...)
+		if err == nil {
+			t.Fatalf("strict=%v: expected error for bad file\n%s", strict, out)
+		}
+		if !strings.Contains(out, filepath.Join(charDir, "fatty.o")+":2:") {
+			t.Errorf("strict=%v: expected bad file and line in output, got:\n%s", strict, out)
+		}
+		if strings.Contains(out, "frodo.o") {
+			t.Errorf("strict=%v: expected good file not to be reported, got:\n%s", strict, out)
+		}
+		if !strings.Contains(out, "2 files scanned, 1 failed (50.0% parsed cleanly)") {
+			t.Errorf("strict=%v: expected summary, got:\n%s", strict, out)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/ftpserver"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+// simulateAccessHandler answers with the server's recent permission checks
+// whose outcome would change if proposedPath replaced the current access
+// file. The proposed file is read on every request, so it can be edited and
+// checked again without restarting.
+func simulateAccessHandler(server *ftpserver.Server, current authorization.AccessSource, proposedPath string, userSource users.Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		proposed := authorization.NewAccessFileSource(proposedPath)
+		requests := server.RecentRequests()
+		changes, err := ftpserver.SimulateAccess(requests, current, proposed, userSource)
+		if err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		fmt.Fprintf(w, "checked %d recent requests against %s\n", len(requests), proposedPath)
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "no outcomes would change")
+			return
+		}
+		for _, change := range changes {
+			fmt.Fprintf(w, "%s %s %s: %s -> %s\n", change.User, change.Op(), change.Path, change.Old, change.New)
+		}
+	})
+}
+
+// startAdminServer serves /simulate-access on addr in the background. The
+// endpoint is not authenticated, so addr should only be reachable by the
+// MUD's administrators.
+func startAdminServer(addr string, simulateAccess http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/simulate-access", simulateAccess)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.App.Error("Admin server error", "error", err)
+		}
+	}()
+	logging.App.Info("Started admin server", "addr", listener.Addr().String())
+	return server, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/ftpserver"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+func TestSimulateAccessHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	current := authorization.NewAccessFileSource(writeConfigFile(t, tmpDir, "access.o", testAccessFile))
+	proposed := writeConfigFile(t, tmpDir, "access.o.new", testAccessFile)
+	server, err := ftpserver.New(&ftpserver.Config{RootDir: tmpDir, RecentRequests: 10}, nil, nil, "test")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		proposed   string
+		wantStatus int
+		wantBody   string
+	}{
+		{"NoChanges", proposed, http.StatusOK, "no outcomes would change"},
+		{"MissingFile", filepath.Join(tmpDir, "missing.o"), http.StatusUnprocessableEntity, "loading new access data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := simulateAccessHandler(server, current, tt.proposed, users.NewMemorySource())
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/simulate-access", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body containing %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/spf13/cobra"
+)
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate-config",
+	Short: "Check a configuration file without starting the server",
+	Long: `Check a configuration file without starting the server.
+
+Runs the same validation as startup, then loads the TLS certificate and key if
+configured, checks the character directory, and parses the access file into
+access trees. All problems are reported; the exit status is nonzero if any
+were found. Groups referenced in the access file without a tree of their own
+are reported as warnings, which do not affect the exit status.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			return fmt.Errorf("config file is required")
+		}
+
+		problems, warnings := checkConfig(cfgFile)
+
+		out := cmd.OutOrStdout()
+		for _, warning := range warnings {
+			fmt.Fprintf(out, "%s: warning: %s\n", cfgFile, warning)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(out, "%s: OK\n", cfgFile)
+			return nil
+		}
+
+		for _, problem := range problems {
+			fmt.Fprintf(out, "%s: %v\n", cfgFile, problem)
+		}
+		return fmt.Errorf("%d problem(s) found in %s", len(problems), cfgFile)
+	},
+}
+
+// checkConfig loads and validates the config at path, including the files it
+// refers to, and returns every problem found. Warnings are suspicious but
+// valid settings, such as references to undefined groups in the access file.
+func checkConfig(path string) (problems []error, warnings []string) {
+	var config Config
+	if err := LoadConfig(path, &config); err != nil {
+		// Nothing else can be checked without a parsed config
+		return []error{err}, nil
+	}
+
+	if err := config.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+
+	if config.TLSCertFile != "" && config.TLSKeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			problems = append(problems, fmt.Errorf("loading TLS cert/key pair: %w", err))
+		}
+	}
+
+	if info, err := os.Stat(config.CharacterDirPath); err != nil {
+		problems = append(problems, fmt.Errorf("character_dir_path %q does not exist", config.CharacterDirPath))
+	} else if !info.IsDir() {
+		problems = append(problems, fmt.Errorf("character_dir_path %q is not a directory", config.CharacterDirPath))
+	}
+
+	if config.ArchiveCharacterDir != "" {
+		if info, err := os.Stat(config.ArchiveCharacterDir); err != nil {
+			problems = append(problems, fmt.Errorf("archive_character_dir_path %q does not exist", config.ArchiveCharacterDir))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Errorf("archive_character_dir_path %q is not a directory", config.ArchiveCharacterDir))
+		}
+	}
+
+	rawData, err := authorization.NewAccessFileSource(config.AccessFilePath).LoadAccessData()
+	if err != nil {
+		problems = append(problems, fmt.Errorf("access_file_path: %w", err))
+	} else if trees, err := authorization.BuildAccessTrees(rawData); err != nil {
+		problems = append(problems, fmt.Errorf("access_file_path: building access trees: %w", err))
+	} else {
+		for _, warning := range authorization.CheckGroupReferences(trees) {
+			warnings = append(warnings, "access_file_path: "+warning)
+		}
+	}
+
+	return problems, warnings
+}
+
+func init() {
+	rootCmd.AddCommand(validateConfigCmd)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigCommand(t *testing.T) {
+	cfg := writeCheckAccessConfig(t)
+
+	out, err := executeCommand(t, "", "validate-config", "--config", cfg)
+	if err != nil {
+		t.Fatalf("Expected valid config, got: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "OK") {
+		t.Errorf("Expected OK output, got:\n%s", out)
+	}
+}
+
+func TestValidateConfigCommandReportsAllProblems(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfigFile(t, tmpDir, "access.o", "access_map ([1|\"frodo\":\"not a tree\"])\n")
+	cfg := writeConfigFile(t, tmpDir, "config.json", `{
+    "ftp_root_dir": ".",
+    "character_dir_path": "missing",
+    "access_file_path": "access.o",
+    "tls_cert_file": "cert.pem",
+    "tls_key_file": "key.pem",
+    "pasv_port_range": [3000, 2000]
+}`)
+
+	out, err := executeCommand(t, "", "validate-config", "--config", cfg)
+	if err == nil {
+		t.Fatalf("Expected error, got nil\n%s", out)
+	}
+
+	for _, want := range []string{"pasv_port_range", "TLS cert/key", "character_dir_path", "access_file_path"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to mention %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestValidateConfigCommandWarnsUndefinedGroups(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeConfigFile(t, tmpDir, "access.o", `access_map ([2|"frodo":([2|"?":({1|"Wiz_domian"}),".":1]),"Wiz_domain":([1|"*":3])])`+"\n")
+	if err := os.Mkdir(filepath.Join(tmpDir, "characters"), 0755); err != nil {
+		t.Fatalf("Failed to create character dir: %v", err)
+	}
+	cfg := writeConfigFile(t, tmpDir, "config.json", `{
+    "ftp_root_dir": ".",
+    "character_dir_path": "characters",
+    "access_file_path": "access.o"
+}`)
+
+	out, err := executeCommand(t, "", "validate-config", "--config", cfg)
+	if err != nil {
+		t.Fatalf("Expected warnings not to fail validation, got: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "warning: access_file_path: frodo references undefined group Wiz_domian") {
+		t.Errorf("Expected undefined group warning, got:\n%s", out)
+	}
+}
@@ -1,6 +1,7 @@
 package authentication
 
 import (
+	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
@@ -17,6 +18,28 @@ type Argon2ID struct{}
 // NewArgon2ID returns an Argon2ID verifier.
 func NewArgon2ID() *Argon2ID { return &Argon2ID{} }
 
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Hash derives an argon2id hash of password with a random salt and the
+// default parameters, returned in the PHC format that VerifyPassword accepts.
+func (a *Argon2ID) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+
+	params := defaultArgon2Params
+	hash := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.time, params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
 // VerifyPassword verifies a password against a PHC-formatted argon2id hash.
 func (a *Argon2ID) VerifyPassword(password, hashedPassword string) error {
 	params, salt, expectedHash, err := parsePHCArgon2ID(hashedPassword)
@@ -37,9 +60,13 @@ type argon2Params struct {
 	threads uint8
 }
 
+// defaultArgon2Params are used for new hashes and for any parameter missing
+// from a parsed hash
+var defaultArgon2Params = argon2Params{memory: 64 * 1024, time: 2, threads: 1}
+
 func parsePHCArgon2ID(s string) (argon2Params, []byte, []byte, error) {
 	// Defaults align with common settings
-	params := argon2Params{memory: 64 * 1024, time: 2, threads: 1}
+	params := defaultArgon2Params
 
 	parts := strings.Split(s, "$")
 	// Expected shapes:
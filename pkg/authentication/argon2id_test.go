@@ -108,3 +108,18 @@ func TestArgon2ID_VerifyPassword_Table(t *testing.T) {
 		})
 	}
 }
+
+func TestArgon2ID_Hash_RoundTrip(t *testing.T) {
+	v := NewArgon2ID()
+
+	hash, err := v.Hash("correcthorsebatterystaple")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=65536,t=2,p=1\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`, hash)
+	assert.NoError(t, v.VerifyPassword("correcthorsebatterystaple", hash))
+	assert.Error(t, v.VerifyPassword("wrong", hash))
+
+	// Salts are random, so hashing twice never yields the same string
+	again, err := v.Hash("correcthorsebatterystaple")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, again)
+}
@@ -1,7 +1,14 @@
 package authentication
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/metrics"
 	"github.com/mmcdole/viking-ftpd/pkg/users"
 )
 
@@ -9,6 +16,22 @@ import (
 type Authenticator struct {
 	source   users.Source
 	verifier PasswordHashVerifier
+
+	// Users that recently authenticated, so repeat logins skip the file read
+	cacheDuration time.Duration
+	mu            sync.Mutex
+	cache         map[string]cacheEntry
+}
+
+// dummyHash is an argon2id hash of "dummy" with the default parameters. It is
+// verified whenever the real verification would be cheaper than an argon2id
+// one, so every attempt costs about the same whether or not the user exists.
+const dummyHash = "$argon2id$v=19$m=65536,t=2,p=1$vqx0Rf1ioJyBEukgSd+Vfw$sDVZQsxVHHCnyWwuni+blwj7AuNlAGdpRuxWv/g6TgU"
+
+// cacheEntry is a successfully authenticated user and when it expires
+type cacheEntry struct {
+	user    *users.User
+	expires time.Time
 }
 
 // NewAuthenticator creates a new authenticator with the given configuration
@@ -16,16 +39,51 @@ func NewAuthenticator(source users.Source, verifier PasswordHashVerifier) *Authe
 	return &Authenticator{
 		source:   source,
 		verifier: verifier,
+		cache:    make(map[string]cacheEntry),
 	}
 }
 
+// SetCacheDuration enables caching of successful logins for d. Within that
+// window a login is verified against the cached password hash without
+// reading the user's file; a changed hash on disk is picked up once the
+// entry expires. Zero (the default) disables the cache.
+func (a *Authenticator) SetCacheDuration(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cacheDuration = d
+	a.cache = make(map[string]cacheEntry)
+}
+
 // Authenticate verifies a username and password combination.
 // Returns ErrInvalidCredentials for any authentication failure to prevent user enumeration.
 // This implements constant-time authentication by always performing password verification.
 func (a *Authenticator) Authenticate(username, password string) (*users.User, error) {
+	return a.AuthenticateContext(context.Background(), username, password)
+}
+
+// AuthenticateContext is Authenticate with a context that is passed to the
+// user source. If ctx is done before the user is loaded, ctx.Err() is
+// returned instead of ErrInvalidCredentials.
+func (a *Authenticator) AuthenticateContext(ctx context.Context, username, password string) (*users.User, error) {
 	logging.App.Debug("Authentication attempt", "user", username)
 
-	user, err := a.source.LoadUser(username)
+	cached := a.cachedUser(username)
+	var cachedErr error
+	if cached != nil {
+		if cachedErr = a.verifier.VerifyPassword(password, cached.PasswordHash); cachedErr == nil {
+			logging.App.Debug("Authentication successful from cache", "user", username)
+			metrics.AuthCacheHits.Inc()
+			metrics.LoginSuccesses.Inc()
+			return cached, nil
+		}
+		// The password may have changed on disk, so fall through to a fresh read
+	}
+
+	user, err := users.LoadUserContext(ctx, a.source, username)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		logging.App.Debug("Authentication abandoned", "user", username, "error", ctxErr)
+		return nil, ctxErr
+	}
 	var userExists bool = err == nil
 	var passwordHash string
 
@@ -34,29 +92,105 @@ func (a *Authenticator) Authenticate(username, password string) (*users.User, er
 		// Do not log password hashes
 		logging.App.Debug("Found user, verifying password", "user", username)
 	} else {
-		// Use a dummy hash to maintain constant timing behavior
-		// This is a bcrypt hash of "dummy" to ensure consistent verification time
-		passwordHash = "$2a$10$N9qo8uLOickgx2ZMRZoMye1NW8k3xPGLhpMeE.f0aK5bPHQu3CcI2"
-		if err == users.ErrUserNotFound {
+		// Verify against a dummy hash to maintain constant timing behavior
+		passwordHash = dummyHash
+		if errors.Is(err, users.ErrUserNotFound) {
 			logging.App.Debug("User not found", "user", username)
+		} else if errors.Is(err, users.ErrCorruptFile) {
+			logging.App.Warn("Corrupt character file", "user", username, "error", err)
 		} else {
 			logging.App.Debug("Error loading user", "user", username, "error", err)
 		}
 	}
 
-	// Always perform password verification to prevent timing attacks
-	passwordErr := a.verifier.VerifyPassword(password, passwordHash)
+	// Always perform password verification to prevent timing attacks. A
+	// hash that was just checked from the cache is not checked again, since
+	// a second verification would make a recently logged in user's failures
+	// slower than anyone else's.
+	var passwordErr error
+	if cached != nil && passwordHash == cached.PasswordHash {
+		passwordErr = cachedErr
+	} else {
+		passwordErr = a.verifier.VerifyPassword(password, passwordHash)
+	}
+
+	// Legacy crypt hashes verify far faster than argon2id, which would let
+	// response time tell those users apart from nonexistent ones. Pad them
+	// with a discarded argon2id verification.
+	if !strings.HasPrefix(passwordHash, "$argon2id$") {
+		_ = a.verifier.VerifyPassword(password, dummyHash)
+	}
 
 	// Only return success if user exists AND password is correct
 	if userExists && passwordErr == nil {
 		logging.App.Debug("Authentication successful", "user", username)
+		a.cacheUser(username, user)
+		metrics.LoginSuccesses.Inc()
 		return user, nil
 	}
+	a.forgetUser(username)
 
 	// Log specific failure reason for debugging, but return generic error
 	if userExists {
 		logging.App.Debug("Password verification failed", "user", username, "error", passwordErr)
 	}
 
+	metrics.LoginFailures.Inc()
 	return nil, ErrInvalidCredentials
 }
+
+// UserExists reports whether username has a character in the user source.
+// Unlike Authenticate, it answers as fast as the source does, so its timing
+// reveals whether the user exists. Use it only for admin and diagnostic
+// paths, never in the login flow.
+func (a *Authenticator) UserExists(username string) (bool, error) {
+	_, err := a.LookupUser(username)
+	if errors.Is(err, users.ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// LookupUser loads the character of username without checking a password,
+// for logins that were proven some other way. Like UserExists, its timing
+// reveals whether the user exists.
+func (a *Authenticator) LookupUser(username string) (*users.User, error) {
+	return a.source.LoadUser(username)
+}
+
+// cachedUser returns the unexpired cache entry for username, if any
+func (a *Authenticator) cachedUser(username string) *users.User {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.cache[username]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(a.cache, username)
+		return nil
+	}
+	return entry.user
+}
+
+// cacheUser records a successful login, if caching is enabled
+func (a *Authenticator) cacheUser(username string, user *users.User) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cacheDuration <= 0 {
+		return
+	}
+	a.cache[username] = cacheEntry{user: user, expires: time.Now().Add(a.cacheDuration)}
+}
+
+// forgetUser drops username from the cache after a failed login
+func (a *Authenticator) forgetUser(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.cache, username)
+}
@@ -1,8 +1,11 @@
 package authentication
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/mmcdole/viking-ftpd/pkg/users"
 	"github.com/stretchr/testify/assert"
@@ -108,3 +111,207 @@ func TestAuthenticator_Authenticate(t *testing.T) {
 		})
 	}
 }
+
+// countingSource counts LoadUser calls on an underlying source
+type countingSource struct {
+	*mockSource
+	loads int
+}
+
+func (s *countingSource) LoadUser(username string) (*users.User, error) {
+	s.loads++
+	return s.mockSource.LoadUser(username)
+}
+
+func TestAuthenticator_Cache(t *testing.T) {
+	source := &countingSource{mockSource: newMockSource()}
+	source.addUser("user1", "hash1", 1)
+	verifier := &mockVerifier{expectedHash: "hash1", expectedPassword: "pass1"}
+
+	auth := NewAuthenticator(source, verifier)
+	auth.SetCacheDuration(100 * time.Millisecond)
+
+	// First login reads the file, the second is answered from the cache
+	_, err := auth.Authenticate("user1", "pass1")
+	assert.NoError(t, err)
+	_, err = auth.Authenticate("user1", "pass1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, source.loads)
+
+	// A wrong password still fails and re-reads the file
+	_, err = auth.Authenticate("user1", "wrongpass")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, 2, source.loads)
+
+	// Change the hash on disk; the new password works once the entry expires
+	_, err = auth.Authenticate("user1", "pass1")
+	assert.NoError(t, err)
+	source.addUser("user1", "hash2", 1)
+	verifier.expectedHash, verifier.expectedPassword = "hash2", "pass2"
+
+	time.Sleep(150 * time.Millisecond)
+
+	loads := source.loads
+	_, err = auth.Authenticate("user1", "pass1")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = auth.Authenticate("user1", "pass2")
+	assert.NoError(t, err)
+	assert.Equal(t, loads+2, source.loads)
+}
+
+func TestAuthenticator_CacheDisabled(t *testing.T) {
+	source := &countingSource{mockSource: newMockSource()}
+	source.addUser("user1", "hash1", 1)
+	auth := NewAuthenticator(source, &mockVerifier{expectedHash: "hash1", expectedPassword: "pass1"})
+
+	for i := 0; i < 3; i++ {
+		_, err := auth.Authenticate("user1", "pass1")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, source.loads)
+}
+
+// timingSource returns users with real hashes for timing comparisons
+func timingSource(t testing.TB) *mockSource {
+	argon2Hash, err := NewArgon2ID().Hash("secret")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	cryptHash, err := NewUnixCrypt().HashWithSalt("secret", "ab")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	source := newMockSource()
+	source.addUser("argonuser", argon2Hash, 1)
+	source.addUser("cryptuser", cryptHash, 1)
+	return source
+}
+
+// medianAuthTimes returns the median duration of n failed logins for each
+// username. Attempts are interleaved so load on the machine affects every
+// username alike. If prepare is not nil it is called, untimed, before each
+// attempt.
+func medianAuthTimes(auth *Authenticator, usernames []string, n int, prepare func(username string)) []time.Duration {
+	durations := make([][]time.Duration, len(usernames))
+	for i := 0; i < n; i++ {
+		for j, username := range usernames {
+			if prepare != nil {
+				prepare(username)
+			}
+			start := time.Now()
+			_, _ = auth.Authenticate(username, "wrongpass")
+			durations[j] = append(durations[j], time.Since(start))
+		}
+	}
+
+	medians := make([]time.Duration, len(usernames))
+	for j, d := range durations {
+		sort.Slice(d, func(a, b int) bool { return d[a] < d[b] })
+		medians[j] = d[n/2]
+	}
+	return medians
+}
+
+func TestAuthenticator_ConstantTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test skipped in short mode")
+	}
+
+	tests := []struct {
+		name   string
+		cached bool
+	}{
+		{"Uncached", false},
+		// A correct login just before puts the user in the login cache
+		{"CachedWrongPassword", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewAuthenticator(timingSource(t), NewVerifier())
+			var prepare func(username string)
+			if tt.cached {
+				auth.SetCacheDuration(time.Minute)
+				prepare = func(username string) { _, _ = auth.Authenticate(username, "secret") }
+			}
+			usernames := []string{"nosuchuser", "argonuser", "cryptuser"}
+			medians := medianAuthTimes(auth, usernames, 9, prepare)
+
+			nonexistent := medians[0]
+			for i, existing := range medians[1:] {
+				// The failures should be indistinguishable; allow for scheduling noise
+				ratio := float64(existing) / float64(nonexistent)
+				if ratio < 0.67 || ratio > 1.5 {
+					t.Errorf("%s wrong password took %v, nonexistent user took %v (ratio %.2f)", usernames[i+1], existing, nonexistent, ratio)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAuthenticate(b *testing.B) {
+	auth := NewAuthenticator(timingSource(b), NewVerifier())
+
+	for _, username := range []string{"argonuser", "cryptuser", "nosuchuser"} {
+		b.Run(username, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = auth.Authenticate(username, "wrongpass")
+			}
+		})
+	}
+}
+
+// slowSource blocks until release is closed
+type slowSource struct {
+	release chan struct{}
+}
+
+func (s *slowSource) LoadUser(username string) (*users.User, error) {
+	<-s.release
+	return nil, users.ErrUserNotFound
+}
+
+func TestAuthenticator_AuthenticateContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	auth := NewAuthenticator(&slowSource{release: release}, &mockVerifier{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	user, err := auth.AuthenticateContext(ctx, "user1", "pass1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, user)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// errorSource fails every load with err
+type errorSource struct {
+	err error
+}
+
+func (s *errorSource) LoadUser(username string) (*users.User, error) {
+	return nil, s.err
+}
+
+func TestAuthenticator_UserExists(t *testing.T) {
+	source := newMockSource()
+	source.addUser("user1", "hashedpass123", 1)
+	auth := NewAuthenticator(source, &mockVerifier{})
+
+	exists, err := auth.UserExists("user1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = auth.UserExists("nonexistent")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// Other source errors are passed through
+	sourceErr := errors.New("disk on fire")
+	exists, err = NewAuthenticator(&errorSource{err: sourceErr}, &mockVerifier{}).UserExists("user1")
+	assert.ErrorIs(t, err, sourceErr)
+	assert.False(t, exists)
+}
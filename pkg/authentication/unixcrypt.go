@@ -17,7 +17,17 @@ func NewUnixCrypt() *UnixCrypt {
 // Hash takes a plaintext password and returns its hashed version
 func (h *UnixCrypt) Hash(password string) (string, error) {
 	// Use the first two characters of the password as the salt
-	salt := password[:2]
+	if len(password) < 2 {
+		return "", errors.New("password too short")
+	}
+	return h.HashWithSalt(password, password[:2])
+}
+
+// HashWithSalt hashes a plaintext password using the given two-character salt
+func (h *UnixCrypt) HashWithSalt(password, salt string) (string, error) {
+	if len(salt) != 2 {
+		return "", errors.New("invalid salt: must be two characters")
+	}
 	return crypt.Crypt(password, salt)
 }
 
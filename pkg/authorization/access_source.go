@@ -1,8 +1,10 @@
 package authorization
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/mmcdole/viking-ftpd/pkg/lpc"
 )
@@ -19,7 +21,9 @@ func NewAccessFileSource(filePath string) *AccessFileSource {
 	}
 }
 
-// LoadAccessData implements AccessSource
+// LoadAccessData implements AccessSource. The file is parsed as an LPC
+// object, and its access_map variable is returned under the "access_map"
+// key; other variables in the file are dropped.
 func (s *AccessFileSource) LoadAccessData() (map[string]interface{}, error) {
 	data, err := os.ReadFile(s.filePath)
 	if err != nil {
@@ -30,8 +34,119 @@ func (s *AccessFileSource) LoadAccessData() (map[string]interface{}, error) {
 	parser := lpc.NewObjectParser(false)
 	result, err := parser.ParseObject(string(data))
 	if err != nil {
-		return nil, fmt.Errorf("parsing access file: %w", err)
+		return nil, fmt.Errorf("parsing access file %s: %w", s.filePath, err)
 	}
 
-	return result.Object, nil
+	rawMap, ok := result.Object["access_map"]
+	if !ok {
+		return nil, fmt.Errorf("parsing access file %s: no access_map variable found", s.filePath)
+	}
+	accessMap, ok := rawMap.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parsing access file %s: access_map is %s, expected a mapping", s.filePath, lpcTypeName(rawMap))
+	}
+
+	return map[string]interface{}{"access_map": accessMap}, nil
+}
+
+// AccessDataVersion implements VersionedAccessSource with the file's
+// modification time and size, which a single stat provides
+func (s *AccessFileSource) AccessDataVersion() (string, error) {
+	info, err := os.Stat(s.filePath)
+	if err != nil {
+		return "", fmt.Errorf("reading access file: %w", err)
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// MemoryAccessSource serves an access map held in memory, for embedding the
+// authorizer without an access file
+type MemoryAccessSource struct {
+	mu        sync.RWMutex
+	accessMap map[string]interface{}
+}
+
+// NewMemoryAccessSource creates a source serving accessMap, which has the
+// shape of the access file's access_map variable: groups or usernames
+// mapped to their path trees
+func NewMemoryAccessSource(accessMap map[string]interface{}) *MemoryAccessSource {
+	return &MemoryAccessSource{accessMap: accessMap}
+}
+
+// LoadAccessData implements AccessSource, returning the map under the
+// "access_map" key like AccessFileSource
+func (s *MemoryAccessSource) LoadAccessData() (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return map[string]interface{}{"access_map": s.accessMap}, nil
+}
+
+// SetAccessMap replaces the map served. Authorizers pick it up at their next
+// refresh.
+func (s *MemoryAccessSource) SetAccessMap(accessMap map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessMap = accessMap
+}
+
+// lpcTypeName names the LPC type of a parsed value for error messages
+func lpcTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "a string"
+	case int, int64:
+		return "an integer"
+	case float64:
+		return "a float"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "a mapping"
+	case nil:
+		return "nil"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// ContextAccessSource is implemented by access sources whose loads can be cancelled
+type ContextAccessSource interface {
+	LoadAccessDataContext(ctx context.Context) (map[string]interface{}, error)
+}
+
+// VersionedAccessSource is implemented by access sources that can cheaply
+// tell whether their data has changed. The version is an opaque string that
+// differs whenever the data may have; while it stays the same, the
+// authorizer keeps its trees instead of loading and parsing the data again.
+type VersionedAccessSource interface {
+	AccessDataVersion() (string, error)
+}
+
+// loadAccessData loads from source, returning ctx.Err() once ctx is done.
+// Sources that do not implement ContextAccessSource are run in a goroutine
+// that is abandoned on cancellation.
+func loadAccessData(ctx context.Context, source AccessSource) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cs, ok := source.(ContextAccessSource); ok {
+		return cs.LoadAccessDataContext(ctx)
+	}
+
+	type loadResult struct {
+		data map[string]interface{}
+		err  error
+	}
+	done := make(chan loadResult, 1)
+	go func() {
+		data, err := source.LoadAccessData()
+		done <- loadResult{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
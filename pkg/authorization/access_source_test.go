@@ -0,0 +1,142 @@
+package authorization
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAccessFile is a small access.o in the format the MUD saves, with nested
+// mappings, a group list and an unrelated variable
+const testAccessFile = `#/obj/master/access
+version 3
+access_map ([3|"*":([3|"*":1,"secret":-1,"players":([1|"*":-1])]),"frodo":([3|"?":({1|"Wiz_shire"}),".":1,"players":([2|"sam":3,"*":1])]),"Wiz_shire":([1|"domains":([1|"shire":4])])])
+`
+
+func writeAccessFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "access.o")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write access file: %v", err)
+	}
+	return path
+}
+
+func TestAccessFileSource(t *testing.T) {
+	source := NewAccessFileSource(writeAccessFile(t, testAccessFile))
+
+	rawData, err := source.LoadAccessData()
+	if err != nil {
+		t.Fatalf("LoadAccessData failed: %v", err)
+	}
+	if _, ok := rawData["version"]; ok {
+		t.Error("Expected variables other than access_map to be dropped")
+	}
+
+	trees, err := BuildAccessTrees(rawData)
+	if err != nil {
+		t.Fatalf("BuildAccessTrees failed: %v", err)
+	}
+	if len(trees) != 3 {
+		t.Errorf("Expected 3 trees, got %d", len(trees))
+	}
+	if !reflect.DeepEqual(trees["frodo"].Groups, []string{"Wiz_shire"}) {
+		t.Errorf("Expected frodo's groups [Wiz_shire], got %v", trees["frodo"].Groups)
+	}
+
+	auth := NewAuthorizer(source, newMockUserSource(), 0)
+	runTests(t, auth, []testCase{
+		{"NestedUserTree", "frodo", "/players/sam", Write},
+		{"GroupTree", "frodo", "/domains/shire", GrantWrite},
+		{"DefaultTree", "gandalf", "/doc", Read},
+		{"DefaultRevoked", "gandalf", "/secret", Revoked},
+	})
+}
+
+func TestAccessFileSourceVersion(t *testing.T) {
+	path := writeAccessFile(t, testAccessFile)
+	source := NewAccessFileSource(path)
+
+	first, err := source.AccessDataVersion()
+	if err != nil {
+		t.Fatalf("AccessDataVersion failed: %v", err)
+	}
+	if again, _ := source.AccessDataVersion(); again != first {
+		t.Errorf("Version of an unchanged file changed from %q to %q", first, again)
+	}
+
+	if err := os.WriteFile(path, []byte(testAccessFile+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite access file: %v", err)
+	}
+	if changed, _ := source.AccessDataVersion(); changed == first {
+		t.Errorf("Version %q did not change when the file did", changed)
+	}
+
+	if _, err := NewAccessFileSource(filepath.Join(t.TempDir(), "missing.o")).AccessDataVersion(); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestAccessFileSourceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"Empty", "", "input string is empty"},
+		{"Unparseable", "this is not an object\n", "no valid entries found"},
+		{"NoAccessMap", "version 3\n", "no access_map variable found"},
+		{"AccessMapNotMapping", "access_map ({2|1,2})\n", "access_map is an array, expected a mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeAccessFile(t, tt.content)
+			_, err := NewAccessFileSource(path).LoadAccessData()
+			if err == nil {
+				t.Fatalf("Expected error containing %q, got nil", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+				t.Errorf("Expected error naming %s and containing %q, got: %v", path, tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := NewAccessFileSource(filepath.Join(t.TempDir(), "missing.o")).LoadAccessData()
+		if !os.IsNotExist(errors.Unwrap(err)) {
+			t.Errorf("Expected not-exist error, got: %v", err)
+		}
+	})
+}
+
+func TestMemoryAccessSource(t *testing.T) {
+	source := NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{
+			"*":      int(Read),
+			"secret": int(Revoked),
+		},
+	})
+	users := newMockUserSource()
+	users.addUser("frodo", 1)
+	// A zero cache duration reloads on every check
+	auth := NewAuthorizer(source, users, 0)
+
+	if got := auth.ResolvePermission("frodo", "/docs"); got != Read {
+		t.Errorf("ResolvePermission(/docs) = %v, want Read", got)
+	}
+	if got := auth.ResolvePermission("frodo", "/secret"); got != Revoked {
+		t.Errorf("ResolvePermission(/secret) = %v, want Revoked", got)
+	}
+
+	source.SetAccessMap(map[string]interface{}{
+		"*":     map[string]interface{}{"*": int(Read)},
+		"frodo": map[string]interface{}{"secret": int(Write)},
+	})
+	if got := auth.ResolvePermission("frodo", "/secret"); got != Write {
+		t.Errorf("ResolvePermission(/secret) after SetAccessMap = %v, want Write", got)
+	}
+}
@@ -1,6 +1,10 @@
 package authorization
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
 
 // BuildAccessTrees constructs a map of access trees from raw data
 func BuildAccessTrees(rawData map[string]interface{}) (map[string]*AccessTree, error) {
@@ -26,6 +30,22 @@ func BuildAccessTrees(rawData map[string]interface{}) (map[string]*AccessTree, e
 	return result, nil
 }
 
+// CheckGroupReferences returns a warning for every group named in a tree's
+// group list that has no tree of its own. Such groups are skipped when
+// resolving permissions, which usually means a typo in the access file.
+func CheckGroupReferences(trees map[string]*AccessTree) []string {
+	var warnings []string
+	for name, tree := range trees {
+		for _, group := range tree.Groups {
+			if _, ok := trees[group]; !ok {
+				warnings = append(warnings, fmt.Sprintf("%s references undefined group %s", name, group))
+			}
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
 // buildAccessTree constructs an access tree from raw data
 func buildAccessTree(data map[string]interface{}) (*AccessTree, error) {
 	root, groups, err := buildAccessNode(data)
@@ -35,11 +55,29 @@ func buildAccessTree(data map[string]interface{}) (*AccessTree, error) {
 
 	return &AccessTree{
 		Root:   root,
-		Groups: groups,
+		Groups: uniqueStrings(groups),
 	}, nil
 }
 
-// buildAccessNode recursively constructs an access node from raw data
+// uniqueStrings returns values without repeats, keeping the first of each
+func uniqueStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !slices.Contains(unique, v) {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// buildAccessNode recursively constructs an access node from raw data. A "?"
+// group list may appear at any node, not only the root, and every list in the
+// subtree is collected: the node's own groups first, in the order listed,
+// then those of its children in order of their names. Repeats are left for
+// buildAccessTree to remove.
 func buildAccessNode(data map[string]interface{}) (*AccessNode, []string, error) {
 	node := &AccessNode{
 		DotAccess:  Revoked,
@@ -48,6 +86,7 @@ func buildAccessNode(data map[string]interface{}) (*AccessNode, []string, error)
 	}
 
 	var groups []string
+	childGroups := make(map[string][]string)
 
 	for key, value := range data {
 		switch key {
@@ -60,12 +99,12 @@ func buildAccessNode(data map[string]interface{}) (*AccessNode, []string, error)
 		case "*":
 			// Star access can be either a direct permission or a directory node
 			if childMap, ok := value.(map[string]interface{}); ok {
-				child, childGroups, err := buildAccessNode(childMap)
+				child, nested, err := buildAccessNode(childMap)
 				if err != nil {
 					return nil, nil, fmt.Errorf("building star directory: %w", err)
 				}
 				node.Children["*"] = child
-				groups = append(groups, childGroups...)
+				childGroups["*"] = nested
 			} else {
 				perm, err := parsePermission(value)
 				if err != nil {
@@ -88,14 +127,12 @@ func buildAccessNode(data map[string]interface{}) (*AccessNode, []string, error)
 		default:
 			switch v := value.(type) {
 			case map[string]interface{}:
-				child, childGroups, err := buildAccessNode(v)
+				child, nested, err := buildAccessNode(v)
 				if err != nil {
 					return nil, nil, fmt.Errorf("building child node %s: %w", key, err)
 				}
-				if len(childGroups) > 0 {
-					groups = append(groups, childGroups...)
-				}
 				node.Children[key] = child
+				childGroups[key] = nested
 			default:
 				// Handle direct permission value
 				perm, err := parsePermission(value)
@@ -111,6 +148,15 @@ func buildAccessNode(data map[string]interface{}) (*AccessNode, []string, error)
 			}
 		}
 	}
+
+	names := make([]string, 0, len(childGroups))
+	for name := range childGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		groups = append(groups, childGroups[name]...)
+	}
 	return node, groups, nil
 }
 
@@ -121,9 +167,14 @@ func parsePermission(value interface{}) (Permission, error) {
 		return Permission(int(v)), nil
 	case int:
 		return Permission(v), nil
+	case int64:
+		return Permission(v), nil
 	case Permission:
 		return v, nil
+	case string:
+		// Symbolic names written by external tooling, e.g. "GRANT_READ"
+		return ParsePermission(v)
 	default:
-		return Revoked, fmt.Errorf("invalid permission format: expected number or Permission, got %T", value)
+		return Revoked, fmt.Errorf("invalid permission format: expected number, name or Permission, got %T", value)
 	}
 }
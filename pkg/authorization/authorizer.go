@@ -1,6 +1,8 @@
 package authorization
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path"
 	"strings"
@@ -8,74 +10,160 @@ import (
 	"time"
 
 	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/metrics"
 	"github.com/mmcdole/viking-ftpd/pkg/users"
 )
 
+// ErrClosed is returned for access data requested after Close
+var ErrClosed = errors.New("authorizer is closed")
+
 // Authorizer handles access control and permissions with caching
 type Authorizer struct {
 	source        AccessSource
 	characterData users.Source
 	cacheDuration time.Duration
 
+	// ctx is cancelled by Close, aborting loads in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	mu          sync.RWMutex
 	trees       map[string]*AccessTree
-	lastRefresh time.Time
+	lastRefresh time.Time // last load attempt that counts toward cacheDuration
+	lastSuccess time.Time // last successful load
+	lastErr     error     // error of the most recent load, nil if it succeeded
+	version     string    // source version of the loaded trees, for VersionedAccessSource
 }
 
 // NewAuthorizer creates a new Authorizer instance
 func NewAuthorizer(source AccessSource, characterData users.Source, cacheDuration time.Duration) *Authorizer {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Authorizer{
 		source:        source,
 		characterData: characterData,
 		cacheDuration: cacheDuration,
+		ctx:           ctx,
+		cancel:        cancel,
 		trees:         make(map[string]*AccessTree),
 	}
 }
 
+// Close stops any background work, aborting a load of the access data that
+// is in progress. Afterwards every path resolves to Revoked. It is safe to
+// call more than once.
+func (a *Authorizer) Close() error {
+	a.cancel()
+	return nil
+}
+
 // HasPermission checks if a user has the required permission for a path
 func (a *Authorizer) HasPermission(username string, filepath string, requiredPerm Permission) bool {
 	effectivePerm := a.ResolvePermission(username, filepath)
 	return effectivePerm >= requiredPerm
 }
 
-// ResolvePermission returns the effective permission for a user on a path
+// ResolvePermission returns the effective permission for a user on a path.
+// Like the MUD, it takes the first tree that has a rule for the path rather
+// than the highest permission: implicit wizard home access, then the user's
+// own tree, then their groups in the order ResolveGroups returns them, then
+// the default "*" tree. A lower permission from an earlier group therefore
+// wins over a higher one from a later group, and Denied stops the search.
 func (a *Authorizer) ResolvePermission(username string, filepath string) Permission {
-	if err := a.ensureFreshCache(); err != nil {
+	perm, err := a.ResolvePermissionContext(context.Background(), username, filepath)
+	if err != nil {
 		logging.App.Debug("Cache refresh failed", "user", username, "path", filepath, "error", err)
-		return Revoked
 	}
+	return perm
+}
 
-	// Clean the path and split into parts
-	parts := strings.Split(path.Clean(filepath), "/")
-	if len(parts) > 0 && parts[0] == "" {
-		parts = parts[1:]
+// ResolvePermissionContext is ResolvePermission with a context that is passed
+// to the access and character sources. If the access data cannot be loaded or
+// ctx is done before the permission is resolved, it returns Revoked and the error.
+func (a *Authorizer) ResolvePermissionContext(ctx context.Context, username string, filepath string) (Permission, error) {
+	if err := a.ensureFreshCache(ctx); err != nil {
+		return Revoked, err
 	}
-	// Handle root path specifically
-	if len(parts) == 1 && parts[0] == "" {
-		parts = []string{} // Empty array for root path
+
+	perm := a.resolvePermission(username, filepath, &lazyGroups{ctx: ctx, authorizer: a, username: username})
+	if err := ctx.Err(); err != nil {
+		return Revoked, err
 	}
+	return perm, nil
+}
+
+// ResolvePermissions returns the effective permissions for a user on several paths.
+// The cache is checked and the user's groups are resolved only once for the whole
+// batch; each result matches what ResolvePermission would return for that path.
+func (a *Authorizer) ResolvePermissions(username string, paths []string) []Permission {
+	perms := make([]Permission, len(paths))
+
+	if err := a.ensureFreshCache(context.Background()); err != nil {
+		logging.App.Debug("Cache refresh failed", "user", username, "paths", len(paths), "error", err)
+		for i := range perms {
+			perms[i] = Revoked
+		}
+		return perms
+	}
+
+	groups := &lazyGroups{ctx: context.Background(), authorizer: a, username: username}
+	for i, filepath := range paths {
+		perms[i] = a.resolvePermission(username, filepath, groups)
+	}
+	return perms
+}
+
+// resolvePermission evaluates a path against the cached trees without
+// refreshing them, returning the first result that is not Revoked in the
+// precedence described on ResolvePermission
+func (a *Authorizer) resolvePermission(username string, filepath string, groups *lazyGroups) Permission {
+	// Split the cleaned path into parts, in a buffer that covers most paths
+	// without allocating. The root path has no parts.
+	var buf [16]string
+	parts := splitPath(buf[:0], path.Clean(filepath))
+
+	// Formatting debug details is measurable on this path, so it is skipped
+	// unless they will be written
+	debug := logging.App.IsDebug()
 
 	// Check implicit permissions first
 	if implicitPerm, ok := a.resolveImplicitPermission(username, parts); ok {
-		logging.App.Debug("Resolved implicit permission", "user", username, "path", filepath, "permission", implicitPerm)
+		if debug {
+			logging.App.Debug("Resolved implicit permission", "user", username, "path", filepath, "permission", implicitPerm)
+		}
 		return implicitPerm
 	}
 
 	// Check user's direct permissions
 	if tree, ok := a.trees[username]; ok {
 		perm := a.resolveNodePermission(tree.Root, parts)
+		if perm == Denied {
+			if debug {
+				logging.App.Debug("Resolved explicit deny", "user", username, "path", filepath)
+			}
+			return Denied
+		}
 		if perm != Revoked {
-			logging.App.Debug("Resolved direct permission", "user", username, "path", filepath, "permission", perm)
+			if debug {
+				logging.App.Debug("Resolved direct permission", "user", username, "path", filepath, "permission", perm)
+			}
 			return perm
 		}
 	}
 
 	// Check all group permissions (both explicit and implicit)
-	for _, group := range a.ResolveGroups(username) {
+	for _, group := range groups.get() {
 		if tree, ok := a.trees[group]; ok {
 			perm := a.resolveNodePermission(tree.Root, parts)
+			if perm == Denied {
+				if debug {
+					logging.App.Debug("Resolved explicit group deny", "user", username, "group", group, "path", filepath)
+				}
+				return Denied
+			}
 			if perm != Revoked {
-				logging.App.Debug("Resolved group permission", "user", username, "group", group, "path", filepath, "permission", perm)
+				if debug {
+					logging.App.Debug("Resolved group permission", "user", username, "group", group, "path", filepath, "permission", perm)
+				}
 				return perm
 			}
 		}
@@ -84,42 +172,86 @@ func (a *Authorizer) ResolvePermission(username string, filepath string) Permiss
 	// Finally check default permissions
 	if tree, ok := a.trees["*"]; ok {
 		perm := a.resolveNodePermission(tree.Root, parts)
-		logging.App.Debug("Using default permission", "user", username, "path", filepath, "permission", perm)
+		if debug {
+			logging.App.Debug("Using default permission", "user", username, "path", filepath, "permission", perm)
+		}
 		return perm
 	}
 
-	logging.App.Debug("No permission found, defaulting to revoked", "user", username, "path", filepath)
+	if debug {
+		logging.App.Debug("No permission found, defaulting to revoked", "user", username, "path", filepath)
+	}
 	return Revoked
 }
 
+// splitPath appends the slash-separated parts of a cleaned path to parts,
+// skipping the empty parts around a leading slash or a root path
+func splitPath(parts []string, cleaned string) []string {
+	for cleaned != "" {
+		var part string
+		part, cleaned, _ = strings.Cut(cleaned, "/")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// lazyGroups resolves a user's groups on first use and remembers the result,
+// so paths answered by the user's own tree never pay for a character lookup
+type lazyGroups struct {
+	ctx        context.Context
+	authorizer *Authorizer
+	username   string
+	groups     []string
+	resolved   bool
+}
+
+func (g *lazyGroups) get() []string {
+	if !g.resolved {
+		g.groups = g.authorizer.resolveGroups(g.ctx, g.username)
+		g.resolved = true
+	}
+	return g.groups
+}
+
 // ResolveGroups returns all groups that a user belongs to, including both
 // explicit groups from the access tree and implicit groups based on character level.
 func (a *Authorizer) ResolveGroups(username string) []string {
-	if err := a.ensureFreshCache(); err != nil {
+	if err := a.ensureFreshCache(context.Background()); err != nil {
 		return []string{}
 	}
 
+	return a.resolveGroups(context.Background(), username)
+}
+
+// resolveGroups combines explicit and implicit groups without refreshing the
+// cache. A group that is both, such as Arch_full listed for an archwizard, is
+// returned once, at its explicit position.
+func (a *Authorizer) resolveGroups(ctx context.Context, username string) []string {
 	// Get explicit groups
-	groups := a.GetExplicitGroups(username)
-	if groups == nil {
-		groups = []string{}
-	}
+	groups := append([]string{}, a.explicitGroups(username)...)
 
 	// Add implicit groups
-	implicitGroups := a.resolveImplicitGroups(username)
+	implicitGroups := a.resolveImplicitGroups(ctx, username)
 	if implicitGroups != nil {
 		groups = append(groups, implicitGroups...)
 	}
 
-	return groups
+	return uniqueStrings(groups)
 }
 
 // GetExplicitGroups returns the explicit groups a user belongs to from their access tree
 func (a *Authorizer) GetExplicitGroups(username string) []string {
-	if err := a.ensureFreshCache(); err != nil {
+	if err := a.ensureFreshCache(context.Background()); err != nil {
 		return []string{}
 	}
 
+	return a.explicitGroups(username)
+}
+
+// explicitGroups returns the groups listed in a user's tree without refreshing the cache
+func (a *Authorizer) explicitGroups(username string) []string {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
@@ -151,38 +283,159 @@ func (a *Authorizer) CanGrant(username string, filepath string) bool {
 	return a.ResolvePermission(username, filepath).CanGrant()
 }
 
-// refreshCache loads fresh data from the source
-func (a *Authorizer) refreshCache() error {
-	logging.App.Debug("Refreshing access cache")
-	rawData, err := a.source.LoadAccessData()
-	if err != nil {
-		logging.App.Debug("Failed to load access data", "error", err)
-		return fmt.Errorf("loading raw data: %w", err)
+// Warm loads the access trees now, so the first permission check after
+// startup does not pay for parsing the access file. References to undefined
+// groups are logged as warnings.
+func (a *Authorizer) Warm() error {
+	if err := a.refreshCache(context.Background()); err != nil {
+		return err
 	}
 
-	trees, err := BuildAccessTrees(rawData)
+	a.mu.RLock()
+	warnings := CheckGroupReferences(a.trees)
+	a.mu.RUnlock()
+
+	for _, warning := range warnings {
+		logging.App.Warn("Access file problem", "warning", warning)
+	}
+	return nil
+}
+
+// Loaded reports whether the access trees have been loaded at least once
+func (a *Authorizer) Loaded() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return !a.lastSuccess.IsZero()
+}
+
+// LastRefresh returns when the access trees were last loaded successfully,
+// which is zero if they never were, and the error of the most recent load
+// attempt, which is nil if it succeeded
+func (a *Authorizer) LastRefresh() (time.Time, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.lastSuccess, a.lastErr
+}
+
+// refreshCache loads fresh data from the source, logging the outcome. If the
+// source is a VersionedAccessSource whose version has not changed since the
+// last successful load, the trees are kept and only the refresh time moves.
+func (a *Authorizer) refreshCache(ctx context.Context) error {
+	if a.ctx.Err() != nil {
+		return ErrClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(a.ctx, cancel)()
+
+	// The version is read before loading, so a change made during the load
+	// is picked up by the next refresh
+	version, unchanged := a.checkVersion()
+	if unchanged {
+		a.mu.Lock()
+		a.lastRefresh = time.Now()
+		a.mu.Unlock()
+		logging.App.Debug("Access data unchanged, keeping access cache", "version", version)
+		return nil
+	}
+
+	start := time.Now()
+	trees, err := a.loadTrees(ctx)
+	if a.ctx.Err() != nil {
+		return ErrClosed
+	}
 	if err != nil {
-		logging.App.Debug("Failed to build access trees", "error", err)
-		return fmt.Errorf("building access trees: %w", err)
+		a.mu.Lock()
+		a.lastErr = err
+		a.mu.Unlock()
+		logging.App.Error("Failed to refresh access cache", "duration", time.Since(start), "error", err)
+		return err
 	}
 
+	now := time.Now()
 	a.mu.Lock()
 	a.trees = trees
-	a.lastRefresh = time.Now()
+	a.lastRefresh = now
+	a.lastSuccess = now
+	a.lastErr = nil
+	a.version = version
 	a.mu.Unlock()
 
+	metrics.AuthorizerRefreshes.Inc()
+	logging.App.Info("Refreshed access cache", "duration", now.Sub(start), "trees", len(trees))
+
 	return nil
 }
 
-// ensureFreshCache checks if cache needs refresh
-func (a *Authorizer) ensureFreshCache() error {
+// checkVersion returns the source's current version, or "" if it has none or
+// it cannot be read, and whether the loaded trees are already of that version
+func (a *Authorizer) checkVersion() (string, bool) {
+	vs, ok := a.source.(VersionedAccessSource)
+	if !ok {
+		return "", false
+	}
+	version, err := vs.AccessDataVersion()
+	if err != nil {
+		// Let the load report the problem
+		return "", false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return version, a.trees != nil && version == a.version
+}
+
+// loadTrees reads the access data and builds its trees
+func (a *Authorizer) loadTrees(ctx context.Context) (map[string]*AccessTree, error) {
+	rawData, err := loadAccessData(ctx, a.source)
+	if err != nil {
+		return nil, fmt.Errorf("loading raw data: %w", err)
+	}
+
+	trees, err := BuildAccessTrees(rawData)
+	if err != nil {
+		return nil, fmt.Errorf("building access trees: %w", err)
+	}
+	// An empty map is what a half-written access file looks like; it would
+	// revoke everyone's access, so never accept it as a reload
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("building access trees: access_map is empty")
+	}
+	return trees, nil
+}
+
+// ensureFreshCache checks if cache needs refresh. If a reload fails after
+// trees were loaded before, for instance while the MUD is rewriting the access
+// file, the previous trees stay in use until the next refresh is due.
+func (a *Authorizer) ensureFreshCache(ctx context.Context) error {
+	if a.ctx.Err() != nil {
+		return ErrClosed
+	}
+
 	a.mu.RLock()
 	needsRefresh := time.Since(a.lastRefresh) >= a.cacheDuration
 	a.mu.RUnlock()
 
-	if needsRefresh {
-		return a.refreshCache()
+	if !needsRefresh {
+		return nil
+	}
+
+	err := a.refreshCache(ctx)
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrClosed) {
+		return err
+	}
+
+	a.mu.Lock()
+	loaded := !a.lastSuccess.IsZero()
+	if loaded {
+		a.lastRefresh = time.Now()
 	}
+	a.mu.Unlock()
+
+	if !loaded {
+		return err
+	}
+	logging.App.Warn("Failed to reload access data, keeping previous permissions", "error", err)
 	return nil
 }
 
@@ -201,8 +454,8 @@ func (a *Authorizer) resolveImplicitPermission(username string, parts []string)
 }
 
 // resolveImplicitGroups returns implicit groups based on character level
-func (a *Authorizer) resolveImplicitGroups(username string) []string {
-	user, err := a.characterData.LoadUser(username)
+func (a *Authorizer) resolveImplicitGroups(ctx context.Context, username string) []string {
+	user, err := users.LoadUserContext(ctx, a.characterData, username)
 	if err != nil {
 		return []string{}
 	}
@@ -224,33 +477,27 @@ func (a *Authorizer) resolveImplicitGroups(username string) []string {
 	return groups
 }
 
-// resolveNodePermission recursively checks permissions in a node
+// resolveNodePermission walks pathParts down from node and returns the
+// permission of the deepest node reached. Where the path leaves the tree,
+// the star access of the last node applies; at the final node, dot access
+// overrides star access.
 func (a *Authorizer) resolveNodePermission(node *AccessNode, pathParts []string) Permission {
 	if node == nil {
 		return Revoked
 	}
 
-	// At the target node (final node)
-	if len(pathParts) == 0 {
-		// At final node, dot access overrides star access
-		if node.DotAccess != Revoked {
-			return node.DotAccess
+	for _, part := range pathParts {
+		// A child's answer is final, even Revoked or Denied; only a missing
+		// child falls back to star access
+		child, ok := node.Children[part]
+		if !ok {
+			return node.StarAccess
 		}
-		// No dot access, use star access
-		return node.StarAccess
+		node = child
 	}
 
-	part := pathParts[0]
-	rest := pathParts[1:]
-
-	// Check for exact match in children
-	if child, ok := node.Children[part]; ok {
-		// Recursively check child permissions
-		childPerm := a.resolveNodePermission(child, rest)
-		// If child returns Revoked, that's final - don't fall back to star access
-		return childPerm
+	if node.DotAccess != Revoked {
+		return node.DotAccess
 	}
-
-	// No matching child, use star access
 	return node.StarAccess
 }
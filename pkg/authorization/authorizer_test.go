@@ -1,11 +1,17 @@
 package authorization
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
 	"github.com/mmcdole/viking-ftpd/pkg/users"
 )
 
@@ -35,7 +41,8 @@ func (m *mockUserSource) addUser(username string, level int) {
 }
 
 type mockAccessSource struct {
-	tree map[string]interface{}
+	tree  map[string]interface{}
+	loads int
 }
 
 func newMockAccessSource(tree map[string]interface{}) *mockAccessSource {
@@ -43,6 +50,7 @@ func newMockAccessSource(tree map[string]interface{}) *mockAccessSource {
 }
 
 func (m *mockAccessSource) LoadAccessData() (map[string]interface{}, error) {
+	m.loads++
 	return m.tree, nil
 }
 
@@ -234,7 +242,7 @@ func TestCorePermissions(t *testing.T) {
 	source.addUser("anonymous", users.WIZARD) // Use WIZARD for testing basic permissions
 
 	auth := NewAuthorizer(newMockAccessSource(coreTree()), source, time.Hour)
-	if err := auth.refreshCache(); err != nil {
+	if err := auth.refreshCache(context.Background()); err != nil {
 		t.Fatalf("Failed to refresh cache: %v", err)
 	}
 
@@ -302,7 +310,7 @@ func TestGroupPermissions(t *testing.T) {
 	source.addUser("user2", users.WIZARD) // WIZARD level for group membership tests
 
 	auth := NewAuthorizer(newMockAccessSource(groupTree()), source, time.Hour)
-	if err := auth.refreshCache(); err != nil {
+	if err := auth.refreshCache(context.Background()); err != nil {
 		t.Fatalf("Failed to refresh cache: %v", err)
 	}
 
@@ -332,7 +340,7 @@ func TestImplicitPermissions(t *testing.T) {
 	source.addUser("wizard", users.WIZARD)      // Level 31
 
 	auth := NewAuthorizer(newMockAccessSource(productionTree()), source, time.Hour)
-	if err := auth.refreshCache(); err != nil {
+	if err := auth.refreshCache(context.Background()); err != nil {
 		t.Fatalf("Failed to refresh cache: %v", err)
 	}
 
@@ -415,7 +423,7 @@ func TestGroupMembership(t *testing.T) {
 	}
 
 	auth := NewAuthorizer(newMockAccessSource(testTree), source, time.Hour)
-	if err := auth.refreshCache(); err != nil {
+	if err := auth.refreshCache(context.Background()); err != nil {
 		t.Fatalf("Failed to refresh cache: %v", err)
 	}
 
@@ -458,3 +466,739 @@ func TestGroupMembership(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveGroupsDeduplicates(t *testing.T) {
+	source := newMockUserSource()
+	source.addUser("arch", users.ARCHWIZARD) // Implicitly Arch_full
+
+	testTree := map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"arch": map[string]interface{}{
+				"?": []interface{}{"Wiz_domain", "Arch_full"},
+			},
+			"Arch_full": map[string]interface{}{
+				".": GrantGrant,
+				"*": GrantGrant,
+			},
+		},
+	}
+
+	auth := NewAuthorizer(newMockAccessSource(testTree), source, time.Hour)
+	if err := auth.refreshCache(context.Background()); err != nil {
+		t.Fatalf("Failed to refresh cache: %v", err)
+	}
+
+	// Arch_full appears once, where it is listed explicitly
+	want := []string{"Wiz_domain", "Arch_full"}
+	if got := auth.ResolveGroups("arch"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveGroups(arch) = %v, want %v", got, want)
+	}
+}
+
+func TestGroupPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []interface{}
+		want   Permission
+	}{
+		// The first group with a rule wins, as in the MUD, even if a later
+		// group grants more
+		{"LowerListedFirst", []interface{}{"Wiz_qc", "Wiz_domain"}, Read},
+		{"HigherListedFirst", []interface{}{"Wiz_domain", "Wiz_qc"}, GrantWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testTree := map[string]interface{}{
+				"access_map": map[string]interface{}{
+					"wizard": map[string]interface{}{
+						"?": tt.groups,
+					},
+					"Wiz_qc": map[string]interface{}{
+						"d": Read,
+					},
+					"Wiz_domain": map[string]interface{}{
+						"d": GrantWrite,
+					},
+				},
+			}
+			source := newMockUserSource()
+			source.addUser("wizard", users.WIZARD)
+			auth := NewAuthorizer(newMockAccessSource(testTree), source, time.Hour)
+
+			if got := auth.ResolvePermission("wizard", "/d/Realm"); got != tt.want {
+				t.Errorf("ResolvePermission(wizard, /d/Realm) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupOrderStable(t *testing.T) {
+	// Groups from several ? nodes disagree about /d. Their order used to
+	// follow map iteration, so the winner could change from one load to the
+	// next.
+	testTree := map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"wizard": map[string]interface{}{
+				"players": map[string]interface{}{"?": []interface{}{"Wiz_players"}},
+				"domains": map[string]interface{}{"?": []interface{}{"Wiz_domain"}},
+				"open":    map[string]interface{}{"?": []interface{}{"Wiz_open"}},
+				"*":       map[string]interface{}{"?": []interface{}{"Wiz_star"}},
+			},
+			"Wiz_players": map[string]interface{}{"d": Read},
+			"Wiz_domain":  map[string]interface{}{"d": GrantWrite},
+			"Wiz_open":    map[string]interface{}{"d": Write},
+			"Wiz_star":    map[string]interface{}{"d": GrantRead},
+		},
+	}
+	source := newMockUserSource()
+	source.addUser("wizard", users.WIZARD)
+
+	// "*" sorts before the other names, so Wiz_star is checked first
+	for i := 0; i < 50; i++ {
+		auth := NewAuthorizer(newMockAccessSource(testTree), source, time.Hour)
+		if got := auth.ResolvePermission("wizard", "/d/Realm"); got != GrantRead {
+			t.Fatalf("Load %d: ResolvePermission(wizard, /d/Realm) = %v, want %v", i, got, GrantRead)
+		}
+	}
+}
+
+func TestExplicitDeny(t *testing.T) {
+	source := newMockUserSource()
+	source.addUser("junior", users.JUNIOR_ARCH) // Level 40, implicit Arch_junior
+	source.addUser("wizard", users.WIZARD)      // Level 31
+
+	testTree := map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"*": map[string]interface{}{
+				".": Read,
+				"*": Revoked,
+			},
+			"Arch_junior": map[string]interface{}{
+				".": GrantWrite,
+				"*": GrantWrite,
+			},
+			"junior": map[string]interface{}{
+				"secure": map[string]interface{}{
+					"keys": Denied, // Carve a hole in the group's GrantWrite
+				},
+			},
+			"wizard": map[string]interface{}{
+				"d": map[string]interface{}{
+					"*": GrantWrite,
+					"Realm": map[string]interface{}{
+						"*":      GrantWrite,
+						"secret": Denied,
+						"public": map[string]interface{}{
+							".": Denied, // Directory itself denied, contents still granted
+							"*": GrantWrite,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	auth := NewAuthorizer(newMockAccessSource(testTree), source, time.Hour)
+	if err := auth.refreshCache(context.Background()); err != nil {
+		t.Fatalf("Failed to refresh cache: %v", err)
+	}
+
+	t.Run("DenyBeatsGroupGrant", func(t *testing.T) {
+		cases := []testCase{
+			{"group_grant", "junior", "/secure/other", GrantWrite},      // Revoked falls through to Arch_junior
+			{"deny_exact", "junior", "/secure/keys", Denied},            // Denied does not fall through
+			{"deny_below", "junior", "/secure/keys/master.key", Denied}, // Denied applies to the whole subtree
+			{"root_grant", "junior", "/", GrantWrite},                   // Unrelated paths keep the group grant
+		}
+		runTests(t, auth, cases)
+	})
+
+	t.Run("DeepDenyBeatsShallowGrant", func(t *testing.T) {
+		cases := []testCase{
+			{"shallow_grant", "wizard", "/d/Other/room.c", GrantWrite},
+			{"realm_grant", "wizard", "/d/Realm/room.c", GrantWrite},
+			{"deep_deny", "wizard", "/d/Realm/secret", Denied},
+			{"deep_deny_file", "wizard", "/d/Realm/secret/plans.txt", Denied},
+			{"dot_deny", "wizard", "/d/Realm/public", Denied},
+			{"dot_deny_contents", "wizard", "/d/Realm/public/room.c", GrantWrite},
+		}
+		runTests(t, auth, cases)
+	})
+
+	t.Run("DeniedCannotAccess", func(t *testing.T) {
+		if auth.CanRead("wizard", "/d/Realm/secret") {
+			t.Error("CanRead returned true for an explicitly denied path")
+		}
+		if auth.HasPermission("junior", "/secure/keys", Read) {
+			t.Error("HasPermission returned true for an explicitly denied path")
+		}
+	})
+}
+
+// slowAccessSource blocks until release is closed
+type slowAccessSource struct {
+	release chan struct{}
+}
+
+func (s *slowAccessSource) LoadAccessData() (map[string]interface{}, error) {
+	<-s.release
+	return productionTree(), nil
+}
+
+// slowUserSource blocks until release is closed
+type slowUserSource struct {
+	release chan struct{}
+}
+
+func (s *slowUserSource) LoadUser(username string) (*users.User, error) {
+	<-s.release
+	return &users.User{Username: username, Level: users.ARCHWIZARD}, nil
+}
+
+func TestResolvePermissionContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	t.Run("SlowAccessSource", func(t *testing.T) {
+		auth := NewAuthorizer(&slowAccessSource{release: release}, newMockUserSource(), time.Hour)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		perm, err := auth.ResolvePermissionContext(ctx, "junior", "/log")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want context.DeadlineExceeded", err)
+		}
+		if perm != Revoked {
+			t.Errorf("permission = %v, want Revoked", perm)
+		}
+	})
+
+	t.Run("SlowCharacterSource", func(t *testing.T) {
+		auth := NewAuthorizer(newMockAccessSource(productionTree()), &slowUserSource{release: release}, time.Hour)
+		if err := auth.Warm(); err != nil {
+			t.Fatalf("Warm failed: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Reaching group permissions needs the character's level
+		if _, err := auth.ResolvePermissionContext(ctx, "someone", "/log"); !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		source := newMockUserSource()
+		source.addUser("junior", users.JUNIOR_ARCH)
+		auth := NewAuthorizer(newMockAccessSource(productionTree()), source, time.Hour)
+
+		perm, err := auth.ResolvePermissionContext(context.Background(), "junior", "/players/junior")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := auth.ResolvePermission("junior", "/players/junior"); perm != want {
+			t.Errorf("permission = %v, want %v", perm, want)
+		}
+	})
+}
+
+// flakyAccessSource serves each response in turn, repeating the last one
+type flakyAccessSource struct {
+	responses []func() (map[string]interface{}, error)
+}
+
+func (s *flakyAccessSource) LoadAccessData() (map[string]interface{}, error) {
+	next := s.responses[0]
+	if len(s.responses) > 1 {
+		s.responses = s.responses[1:]
+	}
+	return next()
+}
+
+func TestFailedRefreshKeepsTrees(t *testing.T) {
+	good := func() (map[string]interface{}, error) { return productionTree(), nil }
+
+	tests := []struct {
+		name string
+		bad  func() (map[string]interface{}, error)
+	}{
+		{"LoadError", func() (map[string]interface{}, error) { return nil, errors.New("file is being rewritten") }},
+		{"MissingAccessMap", func() (map[string]interface{}, error) { return map[string]interface{}{}, nil }},
+		{"EmptyAccessMap", func() (map[string]interface{}, error) {
+			return map[string]interface{}{"access_map": map[string]interface{}{}}, nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newMockUserSource()
+			source.addUser("junior", users.JUNIOR_ARCH)
+			accessSource := &flakyAccessSource{responses: []func() (map[string]interface{}, error){good, tt.bad}}
+			// A zero cache duration reloads on every check
+			auth := NewAuthorizer(accessSource, source, 0)
+
+			want := auth.ResolvePermission("junior", "/log")
+			if want == Revoked {
+				t.Fatalf("expected a permission from the good tree, got Revoked")
+			}
+
+			if got := auth.ResolvePermission("junior", "/log"); got != want {
+				t.Errorf("after failed refresh got %v, want previous %v", got, want)
+			}
+		})
+	}
+
+	t.Run("NoPreviousTrees", func(t *testing.T) {
+		accessSource := &flakyAccessSource{responses: []func() (map[string]interface{}, error){tests[0].bad}}
+		auth := NewAuthorizer(accessSource, newMockUserSource(), 0)
+
+		if err := auth.Warm(); err == nil {
+			t.Error("expected Warm to fail without access data")
+		}
+		if got := auth.ResolvePermission("junior", "/log"); got != Revoked {
+			t.Errorf("got %v, want Revoked", got)
+		}
+	})
+}
+
+func TestLoaded(t *testing.T) {
+	bad := func() (map[string]interface{}, error) { return nil, errors.New("file is being rewritten") }
+	good := func() (map[string]interface{}, error) { return productionTree(), nil }
+	accessSource := &flakyAccessSource{responses: []func() (map[string]interface{}, error){bad, good, bad}}
+	auth := NewAuthorizer(accessSource, newMockUserSource(), 0)
+
+	if auth.Loaded() {
+		t.Fatal("expected a new authorizer not to be loaded")
+	}
+	if err := auth.Warm(); err == nil {
+		t.Fatal("expected the first Warm to fail")
+	}
+	if auth.Loaded() {
+		t.Error("expected a failed load not to count as loaded")
+	}
+	if err := auth.Warm(); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	if !auth.Loaded() {
+		t.Error("expected the authorizer to be loaded")
+	}
+
+	// Later failed reloads keep the previous trees, so it stays loaded
+	auth.ResolvePermission("junior", "/log")
+	if !auth.Loaded() {
+		t.Error("expected a failed reload to keep the authorizer loaded")
+	}
+}
+
+func TestClose(t *testing.T) {
+	source := newMockUserSource()
+	source.addUser("junior", users.JUNIOR_ARCH)
+	auth := NewAuthorizer(newMockAccessSource(productionTree()), source, time.Hour)
+	if got := auth.ResolvePermission("junior", "/players/junior"); got == Revoked {
+		t.Fatalf("expected a permission before Close, got Revoked")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := auth.Close(); err != nil {
+			t.Fatalf("Close #%d failed: %v", i+1, err)
+		}
+	}
+
+	if got := auth.ResolvePermission("junior", "/players/junior"); got != Revoked {
+		t.Errorf("after Close got %v, want Revoked", got)
+	}
+	if _, err := auth.ResolvePermissionContext(context.Background(), "junior", "/log"); !errors.Is(err, ErrClosed) {
+		t.Errorf("error = %v, want ErrClosed", err)
+	}
+	if err := auth.Warm(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Warm error = %v, want ErrClosed", err)
+	}
+
+	t.Run("AbortsLoad", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		auth := NewAuthorizer(&slowAccessSource{release: release}, newMockUserSource(), time.Hour)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := auth.ResolvePermissionContext(context.Background(), "junior", "/log")
+			done <- err
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		auth.Close()
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrClosed) {
+				t.Errorf("error = %v, want ErrClosed", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Close did not abort the load in progress")
+		}
+	})
+}
+
+func TestRefreshLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.NewAppLogger("", logging.LogLevelInfo, 1000000, time.Minute, &buf)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	oldApp := logging.App
+	logging.App = logger
+	defer func() { logging.App = oldApp }()
+
+	bad := func() (map[string]interface{}, error) { return nil, errors.New("file is being rewritten") }
+	good := func() (map[string]interface{}, error) { return productionTree(), nil }
+	auth := NewAuthorizer(&flakyAccessSource{responses: []func() (map[string]interface{}, error){good, bad}}, newMockUserSource(), 0)
+
+	before := time.Now()
+	if err := auth.Warm(); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	last, lastErr := auth.LastRefresh()
+	if last.Before(before) || lastErr != nil {
+		t.Errorf("LastRefresh() = %v, %v; want a time after %v and no error", last, lastErr, before)
+	}
+	if !strings.Contains(buf.String(), "info: Refreshed access cache duration=") || !strings.Contains(buf.String(), fmt.Sprintf("trees=%d", len(auth.trees))) {
+		t.Errorf("expected refresh line with the tree count, got %q", buf.String())
+	}
+
+	buf.Reset()
+	auth.ResolvePermission("junior", "/log")
+	failedLast, lastErr := auth.LastRefresh()
+	if !failedLast.Equal(last) || lastErr == nil {
+		t.Errorf("after a failed reload LastRefresh() = %v, %v; want %v and the error", failedLast, lastErr, last)
+	}
+	if !strings.Contains(buf.String(), "error: Failed to refresh access cache") {
+		t.Errorf("expected a refresh failure line, got %q", buf.String())
+	}
+}
+
+func TestCheckGroupReferences(t *testing.T) {
+	trees, err := BuildAccessTrees(map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"frodo": map[string]interface{}{
+				"?": []interface{}{"Wiz_domain", "Wiz_domian"},
+			},
+			"sam": map[string]interface{}{
+				"players": map[string]interface{}{
+					"?": []interface{}{"Hobbits"},
+				},
+			},
+			"Wiz_domain": map[string]interface{}{
+				"*": int(Read),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildAccessTrees failed: %v", err)
+	}
+
+	want := []string{
+		"frodo references undefined group Wiz_domian",
+		"sam references undefined group Hobbits",
+	}
+	if got := CheckGroupReferences(trees); !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckGroupReferences() = %v, want %v", got, want)
+	}
+}
+
+func TestNestedGroupLists(t *testing.T) {
+	trees, err := BuildAccessTrees(map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"frodo": map[string]interface{}{
+				"?": []interface{}{"Wiz_shire", "Wiz_qc"},
+				"players": map[string]interface{}{
+					"?": []interface{}{"Hobbits", "Wiz_shire"},
+					"*": map[string]interface{}{
+						"?": []interface{}{"Ringbearers"},
+					},
+				},
+				"domains": map[string]interface{}{
+					"?": []interface{}{"Wiz_domain"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildAccessTrees failed: %v", err)
+	}
+
+	// Root groups in order, then nested ones by path name, each once
+	want := []string{"Wiz_shire", "Wiz_qc", "Wiz_domain", "Hobbits", "Ringbearers"}
+	if got := trees["frodo"].Groups; !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups = %v, want %v", got, want)
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	tests := []struct {
+		name string
+		want Permission
+	}{
+		{"DENIED", Denied},
+		{"REVOKED", Revoked},
+		{"READ", Read},
+		{"GRANT_READ", GrantRead},
+		{"WRITE", Write},
+		{"GRANT_WRITE", GrantWrite},
+		{"GRANT_GRANT", GrantGrant},
+		{"grant_read", GrantRead},
+		{"GrantWrite", GrantWrite},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePermission(tt.name)
+		if err != nil {
+			t.Errorf("ParsePermission(%q) error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParsePermission(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+		// Names round-trip through String
+		if back, err := ParsePermission(got.String()); err != nil || back != got {
+			t.Errorf("ParsePermission(%q) = %v, %v; want %v", got.String(), back, err, got)
+		}
+	}
+
+	if _, err := ParsePermission("SUPERUSER"); err == nil {
+		t.Error("expected error for unknown permission name")
+	}
+	if got := Permission(7).String(); got != "Permission(7)" {
+		t.Errorf("Permission(7).String() = %q", got)
+	}
+}
+
+func TestSymbolicPermissionsInTree(t *testing.T) {
+	trees, err := BuildAccessTrees(map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"*": map[string]interface{}{
+				"*":      "read",
+				"log":    "WRITE",
+				"secret": "Denied",
+				"open":   3,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildAccessTrees failed: %v", err)
+	}
+
+	auth := NewAuthorizer(newMockAccessSource(nil), newMockUserSource(), time.Hour)
+	auth.trees = trees
+	auth.lastRefresh = time.Now()
+
+	runTests(t, auth, []testCase{
+		{"StarName", "frodo", "/doc", Read},
+		{"UpperCaseName", "frodo", "/log", Write},
+		{"MixedCaseName", "frodo", "/secret", Denied},
+		{"NumericStillWorks", "frodo", "/open", Write},
+	})
+
+	_, err = BuildAccessTrees(map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"*": map[string]interface{}{"*": "SUPERUSER"},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), `unknown permission "SUPERUSER"`) {
+		t.Errorf("expected unknown permission error, got %v", err)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	source := newMockUserSource()
+	source.addUser("junior", users.JUNIOR_ARCH)
+	accessSource := newMockAccessSource(productionTree())
+	auth := NewAuthorizer(accessSource, source, time.Hour)
+
+	if err := auth.Warm(); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	if accessSource.loads != 1 {
+		t.Fatalf("Warm loaded the access data %d times, want 1", accessSource.loads)
+	}
+
+	// The first check after warming is served from the cache
+	auth.ResolvePermission("junior", "/players/junior")
+	if accessSource.loads != 1 {
+		t.Errorf("ResolvePermission after Warm loaded the access data again (%d loads)", accessSource.loads)
+	}
+}
+
+// versionedAccessSource is a mockAccessSource that reports a version
+type versionedAccessSource struct {
+	*mockAccessSource
+	version string
+}
+
+func (v *versionedAccessSource) AccessDataVersion() (string, error) {
+	return v.version, nil
+}
+
+func TestUnchangedAccessDataNotReloaded(t *testing.T) {
+	source := newMockUserSource()
+	source.addUser("junior", users.JUNIOR_ARCH)
+	accessSource := &versionedAccessSource{mockAccessSource: newMockAccessSource(productionTree()), version: "1"}
+
+	// A zero cache duration refreshes on every check
+	auth := NewAuthorizer(accessSource, source, 0)
+	for i := 0; i < 3; i++ {
+		if got := auth.ResolvePermission("junior", "/secure"); got != Write {
+			t.Fatalf("ResolvePermission(junior, /secure) = %v, want Write", got)
+		}
+	}
+	if accessSource.loads != 1 {
+		t.Errorf("Unchanged access data was loaded %d times, want 1", accessSource.loads)
+	}
+
+	// A new version is loaded at the next refresh
+	tree := productionTree()
+	tree["access_map"].(map[string]interface{})["Arch_junior"] = map[string]interface{}{"secure": Read}
+	accessSource.tree = tree
+	accessSource.version = "2"
+	if got := auth.ResolvePermission("junior", "/secure"); got != Read {
+		t.Errorf("ResolvePermission(junior, /secure) after the change = %v, want Read", got)
+	}
+	if accessSource.loads != 2 {
+		t.Errorf("Changed access data was loaded %d times in all, want 2", accessSource.loads)
+	}
+}
+
+func TestResolvePermissions(t *testing.T) {
+	source := newMockUserSource()
+	source.addUser("wizard1", users.WIZARD)
+	source.addUser("arch", users.ARCHWIZARD)
+	source.addUser("junior", users.JUNIOR_ARCH)
+
+	auth := NewAuthorizer(newMockAccessSource(productionTree()), source, time.Hour)
+
+	paths := []string{
+		"/",
+		"/accounts",
+		"/log/test.log",
+		"/log/Driver",
+		"/tmp",
+		"/d/MyRealm/room.c",
+		"/d/SharedRealm",
+		"/d/SharedRealm/room.c",
+		"/players/wizard1/workroom.c",
+		"/players/arch/open",
+		"/secure",
+	}
+
+	for _, username := range []string{"wizard1", "arch", "junior", "anonymous"} {
+		t.Run(username, func(t *testing.T) {
+			got := auth.ResolvePermissions(username, paths)
+			if len(got) != len(paths) {
+				t.Fatalf("ResolvePermissions returned %d results, want %d", len(got), len(paths))
+			}
+			for i, p := range paths {
+				if want := auth.ResolvePermission(username, p); got[i] != want {
+					t.Errorf("ResolvePermissions(%q)[%q] = %v, want %v", username, p, got[i], want)
+				}
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		if got := auth.ResolvePermissions("wizard1", nil); len(got) != 0 {
+			t.Errorf("ResolvePermissions with no paths = %v, want empty", got)
+		}
+	})
+}
+
+func benchmarkPaths() []string {
+	paths := make([]string, 0, 64)
+	for i := 0; i < 16; i++ {
+		paths = append(paths, "/", "/log/test.log", "/d/SharedRealm/room.c", "/secure/file")
+	}
+	return paths
+}
+
+func BenchmarkResolvePermissionLoop(b *testing.B) {
+	source := newMockUserSource()
+	source.addUser("junior", users.JUNIOR_ARCH)
+	auth := NewAuthorizer(newMockAccessSource(productionTree()), source, time.Hour)
+	paths := benchmarkPaths()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range paths {
+			auth.ResolvePermission("junior", p)
+		}
+	}
+}
+
+func BenchmarkResolvePermissions(b *testing.B) {
+	source := newMockUserSource()
+	source.addUser("junior", users.JUNIOR_ARCH)
+	auth := NewAuthorizer(newMockAccessSource(productionTree()), source, time.Hour)
+	paths := benchmarkPaths()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		auth.ResolvePermissions("junior", paths)
+	}
+}
+
+// benchmarkTree is productionTree with a deep realm and a wizard whose
+// permissions come from the last of several groups
+func benchmarkTree() map[string]interface{} {
+	tree := productionTree()
+	accessMap := tree["access_map"].(map[string]interface{})
+
+	deep := map[string]interface{}{"*": Write}
+	for _, dir := range []string{"h", "g", "f", "e", "d", "c", "b", "a"} {
+		deep = map[string]interface{}{dir: deep, "*": Read}
+	}
+	accessMap["wizard1"].(map[string]interface{})["d"].(map[string]interface{})["Deep"] = deep
+
+	groups := []interface{}{}
+	for _, group := range []string{"Wiz_a", "Wiz_b", "Wiz_c", "Wiz_d", "Wiz_e"} {
+		groups = append(groups, group)
+		accessMap[group] = map[string]interface{}{"doc": Read}
+	}
+	accessMap["Wiz_e"] = map[string]interface{}{"d": map[string]interface{}{"*": Write}}
+	accessMap["grouped"] = map[string]interface{}{"?": groups}
+	return tree
+}
+
+func BenchmarkResolvePermission(b *testing.B) {
+	source := newMockUserSource()
+	source.addUser("wizard1", users.WIZARD)
+	source.addUser("grouped", users.WIZARD)
+	auth := NewAuthorizer(newMockAccessSource(benchmarkTree()), source, time.Hour)
+	if err := auth.Warm(); err != nil {
+		b.Fatalf("Warm failed: %v", err)
+	}
+
+	benchmarks := []struct {
+		name string
+		user string
+		path string
+		want Permission
+	}{
+		{"Shallow", "wizard1", "/d/MyRealm", Write},
+		{"Deep", "wizard1", "/d/Deep/a/b/c/d/e/f/g/h/room.c", Write},
+		{"MultiGroup", "grouped", "/d/Realm/room.c", Write},
+		{"Default", "grouped", "/log/test.log", Read},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			if got := auth.ResolvePermission(bm.user, bm.path); got != bm.want {
+				b.Fatalf("ResolvePermission(%s, %s) = %v, want %v", bm.user, bm.path, got, bm.want)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				auth.ResolvePermission(bm.user, bm.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package authorization
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+// AccessCase is a user and path whose permission is compared by SimulateAccess
+type AccessCase struct {
+	User string
+	Path string
+}
+
+// Diff is the effective permission for an AccessCase under the old and new
+// access data
+type Diff struct {
+	AccessCase
+	Old Permission
+	New Permission
+}
+
+// Changed reports whether the permission differs between old and new
+func (d Diff) Changed() bool {
+	return d.Old != d.New
+}
+
+// SimulateAccess resolves every case against two access sources, typically
+// the live access file and a proposed replacement, and returns the old and
+// new permission for each, in order. Both sources share userSource for
+// character levels. It fails if either source cannot be loaded, since every
+// permission would otherwise compare as Revoked.
+func SimulateAccess(oldSource, newSource AccessSource, userSource users.Source, cases []AccessCase) ([]Diff, error) {
+	// The cache never expires during a simulation, so each source is read once
+	oldAuth := NewAuthorizer(oldSource, userSource, time.Hour)
+	if err := oldAuth.Warm(); err != nil {
+		return nil, fmt.Errorf("loading old access data: %w", err)
+	}
+	newAuth := NewAuthorizer(newSource, userSource, time.Hour)
+	if err := newAuth.Warm(); err != nil {
+		return nil, fmt.Errorf("loading new access data: %w", err)
+	}
+
+	diffs := make([]Diff, len(cases))
+	for i, c := range cases {
+		diffs[i] = Diff{
+			AccessCase: c,
+			Old:        oldAuth.ResolvePermission(c.User, c.Path),
+			New:        newAuth.ResolvePermission(c.User, c.Path),
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,77 @@
+package authorization
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+func TestSimulateAccess(t *testing.T) {
+	oldTree := map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"*": map[string]interface{}{
+				"*":   Read,
+				"doc": Read,
+				"log": Read,
+			},
+		},
+	}
+	// The proposed file revokes /log and grants write on /doc to frodo
+	newTree := map[string]interface{}{
+		"access_map": map[string]interface{}{
+			"*": map[string]interface{}{
+				"*":   Read,
+				"doc": Read,
+				"log": Revoked,
+			},
+			"frodo": map[string]interface{}{
+				"doc": Write,
+			},
+		},
+	}
+
+	userSource := newMockUserSource()
+	userSource.addUser("frodo", users.WIZARD)
+
+	cases := []AccessCase{
+		{User: "frodo", Path: "/log"},
+		{User: "frodo", Path: "/doc"},
+		{User: "sam", Path: "/doc"},
+	}
+	diffs, err := SimulateAccess(newMockAccessSource(oldTree), newMockAccessSource(newTree), userSource, cases)
+	if err != nil {
+		t.Fatalf("SimulateAccess failed: %v", err)
+	}
+
+	want := []Diff{
+		{AccessCase: cases[0], Old: Read, New: Revoked},
+		{AccessCase: cases[1], Old: Read, New: Write},
+		{AccessCase: cases[2], Old: Read, New: Read},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("got %d diffs, want %d", len(diffs), len(want))
+	}
+	for i := range want {
+		if diffs[i] != want[i] {
+			t.Errorf("diff %d = %+v, want %+v", i, diffs[i], want[i])
+		}
+		if diffs[i].Changed() != (want[i].Old != want[i].New) {
+			t.Errorf("diff %d Changed() = %v", i, diffs[i].Changed())
+		}
+	}
+}
+
+func TestSimulateAccessLoadError(t *testing.T) {
+	broken := &flakyAccessSource{responses: []func() (map[string]interface{}, error){
+		func() (map[string]interface{}, error) { return nil, errors.New("unreadable") },
+	}}
+	good := newMockAccessSource(productionTree())
+
+	if _, err := SimulateAccess(good, broken, newMockUserSource(), nil); err == nil {
+		t.Error("expected error for unreadable new access data")
+	}
+	if _, err := SimulateAccess(broken, good, newMockUserSource(), nil); err == nil {
+		t.Error("expected error for unreadable old access data")
+	}
+}
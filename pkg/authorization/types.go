@@ -1,5 +1,10 @@
 package authorization
 
+import (
+	"fmt"
+	"strings"
+)
+
 // AccessSource provides access to the raw access tree data
 type AccessSource interface {
 	LoadAccessData() (map[string]interface{}, error)
@@ -9,6 +14,10 @@ type AccessSource interface {
 type Permission int
 
 const (
+	// Denied is an explicit deny. Unlike Revoked, which only means that a tree
+	// grants nothing for a path, Denied is final: resolution stops at the tree
+	// that declares it instead of falling through to group and default trees.
+	Denied     Permission = -2
 	Revoked    Permission = -1
 	Read       Permission = 1
 	GrantRead  Permission = 2
@@ -17,6 +26,38 @@ const (
 	GrantGrant Permission = 5
 )
 
+// permissionNames maps each permission level to its display name
+var permissionNames = map[Permission]string{
+	Denied:     "Denied",
+	Revoked:    "Revoked",
+	Read:       "Read",
+	GrantRead:  "GrantRead",
+	Write:      "Write",
+	GrantWrite: "GrantWrite",
+	GrantGrant: "GrantGrant",
+}
+
+// String returns the name of the permission, e.g. "GrantRead"
+func (p Permission) String() string {
+	if name, ok := permissionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Permission(%d)", int(p))
+}
+
+// ParsePermission converts a permission name to a Permission. Names are
+// case-insensitive and may use underscores, so "GRANT_READ", "grant_read"
+// and "GrantRead" are all GrantRead.
+func ParsePermission(name string) (Permission, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for p, pname := range permissionNames {
+		if strings.ToLower(pname) == normalized {
+			return p, nil
+		}
+	}
+	return Revoked, fmt.Errorf("unknown permission %q", name)
+}
+
 // CanRead returns true if the permission allows reading
 func (p Permission) CanRead() bool {
 	return p >= Read
@@ -0,0 +1,142 @@
+package ftpserver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// pathAlias serves the FTP paths under from out of the directory to. Both are
+// paths below the FTP root.
+type pathAlias struct {
+	from string
+	to   string
+}
+
+// ValidatePathAlias checks that an alias maps an absolute FTP path other
+// than the root onto an absolute path, both relative to the FTP root
+func ValidatePathAlias(from, to string) error {
+	if !strings.HasPrefix(from, "/") || !strings.HasPrefix(to, "/") {
+		return fmt.Errorf("alias %q -> %q must use absolute paths", from, to)
+	}
+	if path.Clean(from) == "/" {
+		return fmt.Errorf("alias %q -> %q cannot replace the root", from, to)
+	}
+	return nil
+}
+
+// parsePathAliases validates Config.PathAliases and orders them longest
+// first, so the most specific alias of a path is found first
+func parsePathAliases(aliases map[string]string) ([]pathAlias, error) {
+	parsed := make([]pathAlias, 0, len(aliases))
+	seen := make(map[string]string, len(aliases))
+	for from, to := range aliases {
+		if err := ValidatePathAlias(from, to); err != nil {
+			return nil, err
+		}
+		alias := pathAlias{from: path.Clean(from), to: path.Clean(to)}
+		if other, ok := seen[alias.from]; ok {
+			return nil, fmt.Errorf("aliases %q and %q are the same path", other, from)
+		}
+		seen[alias.from] = from
+		parsed = append(parsed, alias)
+	}
+	sort.Slice(parsed, func(i, j int) bool {
+		return len(parsed[i].from) > len(parsed[j].from)
+	})
+	return parsed, nil
+}
+
+// aliasPath returns the path name is stored at, relative to the FTP root.
+// Names under an alias are rewritten to its target; others are returned as
+// they are.
+func (s *Server) aliasPath(name string) string {
+	if len(s.aliases) == 0 {
+		return name
+	}
+	clean := path.Clean("/" + filepath.ToSlash(name))
+	for _, alias := range s.aliases {
+		if clean == alias.from {
+			return filepath.FromSlash(alias.to)
+		}
+		if strings.HasPrefix(clean, alias.from+"/") {
+			return filepath.FromSlash(path.Join(alias.to, clean[len(alias.from):]))
+		}
+	}
+	return name
+}
+
+// aliasFs rewrites the paths it is given with Server.aliasPath. Sessions use
+// it in front of the root filesystem, so permissions, logs and errors all
+// deal in the FTP paths users see while files are read from and written to
+// the alias targets.
+type aliasFs struct {
+	afero.Fs
+	server *Server
+}
+
+// Create implements afero.Fs
+func (a *aliasFs) Create(name string) (afero.File, error) {
+	return a.Fs.Create(a.server.aliasPath(name))
+}
+
+// Mkdir implements afero.Fs
+func (a *aliasFs) Mkdir(name string, perm os.FileMode) error {
+	return a.Fs.Mkdir(a.server.aliasPath(name), perm)
+}
+
+// MkdirAll implements afero.Fs
+func (a *aliasFs) MkdirAll(name string, perm os.FileMode) error {
+	return a.Fs.MkdirAll(a.server.aliasPath(name), perm)
+}
+
+// Open implements afero.Fs
+func (a *aliasFs) Open(name string) (afero.File, error) {
+	return a.Fs.Open(a.server.aliasPath(name))
+}
+
+// OpenFile implements afero.Fs
+func (a *aliasFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return a.Fs.OpenFile(a.server.aliasPath(name), flag, perm)
+}
+
+// Remove implements afero.Fs
+func (a *aliasFs) Remove(name string) error {
+	return a.Fs.Remove(a.server.aliasPath(name))
+}
+
+// RemoveAll implements afero.Fs
+func (a *aliasFs) RemoveAll(name string) error {
+	return a.Fs.RemoveAll(a.server.aliasPath(name))
+}
+
+// Rename implements afero.Fs
+func (a *aliasFs) Rename(oldname, newname string) error {
+	return a.Fs.Rename(a.server.aliasPath(oldname), a.server.aliasPath(newname))
+}
+
+// Stat implements afero.Fs
+func (a *aliasFs) Stat(name string) (os.FileInfo, error) {
+	return a.Fs.Stat(a.server.aliasPath(name))
+}
+
+// Chmod implements afero.Fs
+func (a *aliasFs) Chmod(name string, mode os.FileMode) error {
+	return a.Fs.Chmod(a.server.aliasPath(name), mode)
+}
+
+// Chown implements afero.Fs
+func (a *aliasFs) Chown(name string, uid, gid int) error {
+	return a.Fs.Chown(a.server.aliasPath(name), uid, gid)
+}
+
+// Chtimes implements afero.Fs
+func (a *aliasFs) Chtimes(name string, atime, mtime time.Time) error {
+	return a.Fs.Chtimes(a.server.aliasPath(name), atime, mtime)
+}
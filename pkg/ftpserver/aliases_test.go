@@ -0,0 +1,107 @@
+package ftpserver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAliasPath(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.PathAliases = map[string]string{
+			"/pub":          "/lib/open/pub",
+			"/pub/incoming": "/uploads/",
+		}
+	})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"/pub", "/lib/open/pub"},
+		{"/pub/readme.txt", "/lib/open/pub/readme.txt"},
+		{"/pub/incoming/new.txt", "/uploads/new.txt"},
+		{"pub/readme.txt", "/lib/open/pub/readme.txt"},
+		{"/public/readme.txt", "/public/readme.txt"},
+		{"/players/frodo", "/players/frodo"},
+	}
+
+	for _, tt := range tests {
+		if got := s.aliasPath(tt.name); got != filepath.FromSlash(tt.want) {
+			t.Errorf("aliasPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPathAliases(t *testing.T) {
+	// Everyone may read everything except /secret, where the alias points
+	s := newTestServer(t, func(c *Config) {
+		c.PathAliases = map[string]string{"/pub": "/secret/pub"}
+	})
+	s.authorizer = newTestAuthorizer()
+	for path, content := range map[string]string{
+		"secret/pub/map.txt": "There and back again",
+		"notes.txt":          "Second breakfast",
+	} {
+		full := filepath.Join(s.config.RootDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	client, err := (&ftpDriver{server: s}).startSession(newMockClient(1, "10.0.0.1"), "frodo", nil, false, "password")
+	if err != nil {
+		t.Fatalf("startSession failed: %v", err)
+	}
+	read := func(name string) (string, error) {
+		f, err := client.Open(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		content, err := io.ReadAll(f)
+		return string(content), err
+	}
+
+	// The alias is authorized as the path the user sees
+	if got, err := read("/pub/map.txt"); err != nil || got != "There and back again" {
+		t.Errorf("Reading /pub/map.txt = %q, %v", got, err)
+	}
+	entries, err := client.ReadDir("/pub")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "map.txt" {
+		t.Errorf("ReadDir(/pub) = %v, %v; want map.txt", entries, err)
+	}
+
+	// The backing path keeps its own permissions
+	if _, err := read("/secret/pub/map.txt"); !os.IsPermission(err) {
+		t.Errorf("Reading /secret/pub/map.txt error = %v, want permission denied", err)
+	}
+
+	// Errors name the alias, not the backing path
+	if _, err := read("/pub/missing.txt"); err == nil || err.Error() != "open /pub/missing.txt: file does not exist" {
+		t.Errorf("Reading /pub/missing.txt error = %v", err)
+	}
+
+	// Paths outside any alias pass through unchanged
+	if got, err := read("/notes.txt"); err != nil || got != "Second breakfast" {
+		t.Errorf("Reading /notes.txt = %q, %v", got, err)
+	}
+}
+
+func TestNewRejectsInvalidPathAlias(t *testing.T) {
+	for _, aliases := range []map[string]string{
+		{"pub": "/lib/pub"},
+		{"/pub": "lib/pub"},
+		{"/": "/lib"},
+		{"/pub": "/a", "/pub/": "/b"},
+	} {
+		config := &Config{RootDir: t.TempDir(), PathAliases: aliases}
+		if _, err := New(config, nil, nil, "test"); err == nil {
+			t.Errorf("Expected New to reject aliases %v", aliases)
+		}
+	}
+}
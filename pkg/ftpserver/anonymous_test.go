@@ -0,0 +1,132 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authentication"
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+func TestAnonymousLogin(t *testing.T) {
+	// Only the guest identity may read /pub; everyone may write /incoming
+	source := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"guest": map[string]interface{}{
+			"pub": int(authorization.Read),
+		},
+		"*": map[string]interface{}{
+			"*":        int(authorization.Revoked),
+			"incoming": int(authorization.Write),
+		},
+	})
+
+	tests := []struct {
+		name      string
+		allow     bool
+		login     string
+		wantLogin bool
+	}{
+		{"Anonymous", true, "anonymous", true},
+		{"FTP", true, "ftp", true},
+		{"UpperCase", true, "ANONYMOUS", true},
+		{"Disabled", false, "anonymous", false},
+		{"OtherUser", true, "frodo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.AllowAnonymous = tt.allow
+				c.AnonymousUser = "guest"
+			})
+			s.authorizer = authorization.NewAuthorizer(source, users.NewMemorySource(), time.Minute)
+			s.authenticator = authentication.NewAuthenticator(users.NewMemorySource(), authentication.NewVerifier())
+			for _, dir := range []string{"pub", "incoming"} {
+				if err := os.Mkdir(filepath.Join(s.config.RootDir, dir), 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", dir, err)
+				}
+			}
+
+			driver := &ftpDriver{server: s}
+			cc := newMockClient(1, "10.0.0.1")
+			if _, err := driver.ClientConnected(cc); err != nil {
+				t.Fatalf("ClientConnected failed: %v", err)
+			}
+
+			clientDriver, err := driver.AuthUser(cc, tt.login, "me@example.com")
+			if !tt.wantLogin {
+				if err == nil {
+					t.Fatal("Expected login to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthUser failed: %v", err)
+			}
+
+			client := clientDriver.(*ftpClient)
+			if client.user != "guest" {
+				t.Errorf("Session authorized as %q, want %q", client.user, "guest")
+			}
+			if got := s.GetConnectionsByUser()["guest"]; got != 1 {
+				t.Errorf("Connections for guest = %d, want 1", got)
+			}
+
+			// Reads go through the authorizer as the configured identity
+			if _, err := client.ReadDir("/pub"); err != nil {
+				t.Errorf("ReadDir(/pub) failed: %v", err)
+			}
+			// Writes are refused even where the access tree allows them
+			if _, err := client.OpenFile("/incoming/upload.txt", os.O_WRONLY|os.O_CREATE, 0644); !os.IsPermission(err) {
+				t.Errorf("Upload error = %v, want permission denied", err)
+			}
+			if err := client.Mkdir("/incoming/dir", 0755); !os.IsPermission(err) {
+				t.Errorf("Mkdir error = %v, want permission denied", err)
+			}
+		})
+	}
+}
+
+func TestAnonymousOpenDirectories(t *testing.T) {
+	// The access tree grants the anonymous identity nothing, so only the
+	// implicit rule for players' open directories lets it read
+	source := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{
+			"*": int(authorization.Revoked),
+		},
+	})
+
+	s := newTestServer(t, func(c *Config) {
+		c.AllowAnonymous = true
+	})
+	s.authorizer = authorization.NewAuthorizer(source, users.NewMemorySource(), time.Minute)
+	s.authenticator = authentication.NewAuthenticator(users.NewMemorySource(), authentication.NewVerifier())
+	for _, dir := range []string{"players/frodo/open", "players/frodo/private"} {
+		if err := os.MkdirAll(filepath.Join(s.config.RootDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	driver := &ftpDriver{server: s}
+	cc := newMockClient(1, "10.0.0.1")
+	clientDriver, err := driver.AuthUser(cc, "anonymous", "me@example.com")
+	if err != nil {
+		t.Fatalf("AuthUser failed: %v", err)
+	}
+	client := clientDriver.(*ftpClient)
+
+	if _, err := client.ReadDir("/players/frodo/open"); err != nil {
+		t.Errorf("ReadDir(/players/frodo/open) failed: %v", err)
+	}
+	for _, dir := range []string{"/players/frodo", "/players/frodo/private", "/players"} {
+		if _, err := client.ReadDir(dir); !os.IsPermission(err) {
+			t.Errorf("ReadDir(%s) error = %v, want permission denied", dir, err)
+		}
+	}
+	if _, err := client.Create("/players/frodo/open/upload.txt"); !os.IsPermission(err) {
+		t.Errorf("Upload to open directory error = %v, want permission denied", err)
+	}
+}
@@ -0,0 +1,71 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenFileAppend(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastCommand string
+		flag        int
+	}{
+		// ftpserverlib's own APPE flags
+		{"APPE", "APPE", os.O_WRONLY | os.O_APPEND | os.O_CREATE},
+		// APPE is mapped to append even if truncating flags are passed
+		{"APPETruncateFlags", "APPE", os.O_WRONLY | os.O_CREATE | os.O_TRUNC},
+		// O_APPEND always wins over O_TRUNC
+		{"AppendWithTrunc", "STOR", os.O_WRONLY | os.O_APPEND | os.O_TRUNC},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			s.authorizer = newTestAuthorizer()
+			client := newTestClient(s, "frodo")
+			client.cc.(*mockClientContext).lastCommand = tt.lastCommand
+
+			path := filepath.Join(s.config.RootDir, "players", "frodo", "log.txt")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("Failed to create home: %v", err)
+			}
+			if err := os.WriteFile(path, []byte("existing "), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			f, err := client.OpenFile("/players/frodo/log.txt", tt.flag, 0644)
+			if err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			if _, err := f.Write([]byte("appended")); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			f.Close()
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != "existing appended" {
+				t.Errorf("File content = %q, want %q", content, "existing appended")
+			}
+		})
+	}
+}
+
+func TestOpenFileAppendRequiresWrite(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+	client.cc.(*mockClientContext).lastCommand = "APPE"
+
+	// Everyone may read /pub, but only frodo's home is writable
+	if err := os.MkdirAll(filepath.Join(s.config.RootDir, "pub"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if _, err := client.OpenFile("/pub/log.txt", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); !os.IsPermission(err) {
+		t.Errorf("OpenFile error = %v, want permission denied", err)
+	}
+}
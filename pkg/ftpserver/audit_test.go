@@ -0,0 +1,110 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authentication"
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+// captureAuditLog points the global audit logger at a temporary file for the
+// rest of the test and returns a function that closes it and reads it back
+func captureAuditLog(t *testing.T) func() string {
+	t.Helper()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := logging.NewAuditLogger(logPath, 1000000, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	oldAudit := logging.Audit
+	logging.Audit = auditLog
+	t.Cleanup(func() { logging.Audit = oldAudit })
+
+	return func() string {
+		t.Helper()
+		if err := auditLog.Close(); err != nil {
+			t.Fatalf("Failed to close audit logger: %v", err)
+		}
+		data, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatalf("Failed to read audit log: %v", err)
+		}
+		return string(data)
+	}
+}
+
+func TestAuditDeniedWrites(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = authorization.NewAuthorizer(authorization.NewMemoryAccessSource(map[string]interface{}{
+		"frodo": map[string]interface{}{
+			"shire":  int(authorization.Write),
+			"mordor": int(authorization.Read),
+		},
+	}), users.NewMemorySource(), time.Minute)
+	client := newTestClient(s, "frodo")
+	for _, dir := range []string{"shire", "mordor"} {
+		if err := os.Mkdir(filepath.Join(s.config.RootDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	auditLog := captureAuditLog(t)
+	accessLog := captureAccessLog(t)
+
+	f, err := client.Create("/shire/pipeweed.txt")
+	if err != nil {
+		t.Fatalf("Create in a writable directory failed: %v", err)
+	}
+	f.Close()
+	if _, err := client.Create("/mordor/ring.txt"); !os.IsPermission(err) {
+		t.Fatalf("Create in a read-only directory error = %v, want permission denied", err)
+	}
+	if err := client.Rename("/shire/pipeweed.txt", "/mordor/pipeweed.txt"); !os.IsPermission(err) {
+		t.Fatalf("Rename into a read-only directory error = %v, want permission denied", err)
+	}
+
+	log := auditLog()
+	for _, want := range []string{
+		"op=create user=frodo path=/mordor/ring.txt client_ip=10.0.0.1:40000 status=denied",
+		"op=rename user=frodo path=/shire/pipeweed.txt client_ip=10.0.0.1:40000 status=denied to=/mordor/pipeweed.txt",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("Expected audit log to contain %q, got:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "status=success") {
+		t.Errorf("Expected only denials in the audit log, got:\n%s", log)
+	}
+	if lines := strings.Count(log, "\n"); lines != 2 {
+		t.Errorf("Audit log has %d lines, want 2:\n%s", lines, log)
+	}
+
+	// The access log still records every operation
+	if log := accessLog(); !strings.Contains(log, "op=create user=frodo path=/shire/pipeweed.txt status=success") {
+		t.Errorf("Expected the successful create in the access log, got:\n%s", log)
+	}
+}
+
+func TestAuditFailedLogin(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authenticator = authentication.NewAuthenticator(users.NewMemorySource(), authentication.NewVerifier())
+	auditLog := captureAuditLog(t)
+
+	driver := &ftpDriver{server: s}
+	cc := newMockClient(1, "10.0.0.1")
+	if _, err := driver.ClientConnected(cc); err != nil {
+		t.Fatalf("ClientConnected failed: %v", err)
+	}
+	if _, err := driver.AuthUser(cc, "sauron", "ring"); err == nil {
+		t.Fatal("Expected login of an unknown user to fail")
+	}
+
+	if log := auditLog(); !strings.Contains(log, "op=login user=sauron path= client_ip=10.0.0.1:40000 status=failed") {
+		t.Errorf("Expected the failed login in the audit log, got:\n%s", log)
+	}
+}
@@ -0,0 +1,74 @@
+package ftpserver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// ComputeHash returns the hex digest of a file, or of the byte range
+// [startOffset, endOffset) when endOffset is positive. It backs the HASH,
+// XCRC, XMD5, XSHA1, XSHA256 and XSHA512 commands.
+// Interface: ftpserverlib.ClientDriverExtensionHasher
+func (c *ftpClient) ComputeHash(name string, algo ftpserverlib.HASHAlgo, startOffset, endOffset int64) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	// Open performs path resolution and the read check
+	file, err := c.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Checksums are not downloads, so bypass the transfer byte counter
+	if counted, ok := file.(*countingFile); ok {
+		file = counted.File
+	}
+
+	length := int64(math.MaxInt64 - startOffset)
+	if endOffset > 0 {
+		if endOffset < startOffset {
+			return "", fmt.Errorf("invalid range: end %d is before start %d", endOffset, startOffset)
+		}
+		length = endOffset - startOffset
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(file, startOffset, length)); err != nil {
+		c.logAccess(logging.OpHash, name, "error", "error", err)
+		return "", err
+	}
+
+	c.logAccess(logging.OpHash, name, "success", "algo", algo)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newHash returns a hash.Hash for a ftpserverlib hash algorithm
+func newHash(algo ftpserverlib.HASHAlgo) (hash.Hash, error) {
+	switch algo {
+	case ftpserverlib.HASHAlgoCRC32:
+		return crc32.NewIEEE(), nil
+	case ftpserverlib.HASHAlgoMD5:
+		return md5.New(), nil
+	case ftpserverlib.HASHAlgoSHA1:
+		return sha1.New(), nil
+	case ftpserverlib.HASHAlgoSHA256:
+		return sha256.New(), nil
+	case ftpserverlib.HASHAlgoSHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %v", algo)
+	}
+}
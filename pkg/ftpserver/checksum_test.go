@@ -0,0 +1,95 @@
+package ftpserver
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+	"github.com/mmcdole/viking-ftpd/pkg/metrics"
+	"github.com/spf13/afero"
+)
+
+// newTestClient returns an ftpClient for user rooted at the server's root dir
+func newTestClient(s *Server, user string) *ftpClient {
+	return &ftpClient{
+		server:   s,
+		user:     user,
+		rootPath: s.config.RootDir,
+		fs:       afero.NewBasePathFs(afero.NewOsFs(), s.config.RootDir),
+		cc:       newMockClient(1, "10.0.0.1"),
+	}
+}
+
+func TestComputeHash(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+
+	content := []byte("The Road goes ever on and on")
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "poem.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(s.config.RootDir, "secret"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "secret", "plans.txt"), content, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	md5Sum := md5.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	rangeSum := md5.Sum(content[4:8])
+
+	tests := []struct {
+		name       string
+		path       string
+		algo       ftpserverlib.HASHAlgo
+		start, end int64
+		want       string
+		wantErr    bool
+	}{
+		{"MD5", "/poem.txt", ftpserverlib.HASHAlgoMD5, 0, 0, hex.EncodeToString(md5Sum[:]), false},
+		{"SHA256", "poem.txt", ftpserverlib.HASHAlgoSHA256, 0, 0, hex.EncodeToString(sha256Sum[:]), false},
+		{"CRC32", "/poem.txt", ftpserverlib.HASHAlgoCRC32, 0, 0, fmt.Sprintf("%08x", crc32.ChecksumIEEE(content)), false},
+		{"Range", "/poem.txt", ftpserverlib.HASHAlgoMD5, 4, 8, hex.EncodeToString(rangeSum[:]), false},
+		{"InvalidRange", "/poem.txt", ftpserverlib.HASHAlgoMD5, 8, 4, "", true},
+		{"Denied", "/secret/plans.txt", ftpserverlib.HASHAlgoMD5, 0, 0, "", true},
+		{"Missing", "/missing.txt", ftpserverlib.HASHAlgoMD5, 0, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.ComputeHash(tt.path, tt.algo, tt.start, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ComputeHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ComputeHash() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeHashNotCountedAsDownload(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	before := metrics.BytesRead.Value()
+	if _, err := client.ComputeHash("/file.txt", ftpserverlib.HASHAlgoMD5, 0, 0); err != nil {
+		t.Fatalf("ComputeHash failed: %v", err)
+	}
+	if after := metrics.BytesRead.Value(); after != before {
+		t.Errorf("BytesRead changed by %d, want 0", after-before)
+	}
+}
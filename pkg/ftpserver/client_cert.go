@@ -0,0 +1,97 @@
+package ftpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+)
+
+var errClientCertRejected = errors.New("client certificate does not match user")
+
+// compileClientCertUserPattern validates the client certificate settings and
+// compiles ClientCertUserPattern. A nil pattern means the whole CN is the
+// username.
+func compileClientCertUserPattern(config *Config) (*regexp.Regexp, error) {
+	if config.RequireClientCert && config.ClientCAFile == "" {
+		return nil, fmt.Errorf("require_client_cert needs a client CA file")
+	}
+	if config.ClientCertUserPattern == "" {
+		return nil, nil
+	}
+
+	pattern, err := regexp.Compile(config.ClientCertUserPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate user pattern: %w", err)
+	}
+	if pattern.NumSubexp() < 1 {
+		return nil, fmt.Errorf("client certificate user pattern %q has no capture group", config.ClientCertUserPattern)
+	}
+	return pattern, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", path)
+	}
+	return pool, nil
+}
+
+// clientCertUsername maps a certificate CN to a username, reporting false if
+// the CN does not match ClientCertUserPattern
+func (s *Server) clientCertUsername(cn string) (string, bool) {
+	if s.clientCertUser == nil {
+		return cn, cn != ""
+	}
+	match := s.clientCertUser.FindStringSubmatch(cn)
+	if match == nil || match[1] == "" {
+		return "", false
+	}
+	return match[1], true
+}
+
+// VerifyConnection logs in TLS clients that present a trusted certificate
+// whose CN maps to the user they sent, without asking for a password. The
+// handshake has already verified the certificate against ClientCAFile.
+// Clients without a certificate fall through to password authentication.
+// Interface: ftpserverlib.MainDriverExtensionTLSVerifier
+func (d *ftpDriver) VerifyConnection(cc ftpserverlib.ClientContext, user string, tlsConn *tls.Conn) (ftpserverlib.ClientDriver, error) {
+	if d.server.config.ClientCAFile == "" || tlsConn == nil {
+		return nil, nil
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cn := state.VerifiedChains[0][0].Subject.CommonName
+
+	certUser, ok := d.server.clientCertUsername(cn)
+	if !ok || certUser != user {
+		d.logLoginRefused(cc, user, "failed", "method", "certificate", "cn", cn)
+		return nil, errClientCertRejected
+	}
+
+	// The certificate already proves who the client is, so the existence
+	// check cannot be used to enumerate characters
+	character, err := d.server.authenticator.LookupUser(certUser)
+	if err != nil {
+		d.logLoginRefused(cc, user, "failed", "method", "certificate", "cn", cn, "error", err)
+		return nil, fmt.Errorf("authentication failed")
+	}
+	if err := d.checkLevel(cc, user, character); err != nil {
+		return nil, err
+	}
+
+	return d.startSession(cc, user, nil, false, "certificate")
+}
@@ -0,0 +1,235 @@
+package ftpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authentication"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a certificate signed by the CA for cn
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeServerFiles writes the CA certificate, and a server certificate and key it
+// issued, returning their paths
+func (ca *testCA) writeServerFiles(t *testing.T, dir string) (caFile, certFile, keyFile string) {
+	t.Helper()
+	server := ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	keyDER, err := x509.MarshalECPrivateKey(server.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	files := map[string]*pem.Block{
+		"ca.pem":   {Type: "CERTIFICATE", Bytes: ca.cert.Raw},
+		"cert.pem": {Type: "CERTIFICATE", Bytes: server.Certificate[0]},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// handshake connects a client presenting clientCert (if any) to the driver's
+// TLS config over loopback and returns the server side of the connection
+func handshake(t *testing.T, driver *ftpDriver, clientCert *tls.Certificate) (*tls.Conn, error) {
+	t.Helper()
+	serverConfig, err := driver.GetTLSConfig()
+	if err != nil {
+		t.Fatalf("GetTLSConfig failed: %v", err)
+	}
+
+	clientConfig := &tls.Config{InsecureSkipVerify: true}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Read until the server closes, consuming session tickets and alerts
+		conn.Read(make([]byte, 1))
+	}()
+
+	raw, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	conn := tls.Server(raw, serverConfig)
+	t.Cleanup(func() {
+		conn.Close()
+		<-clientDone
+	})
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func TestClientCertLogin(t *testing.T) {
+	ca := newTestCA(t)
+	untrusted := newTestCA(t)
+	caFile, certFile, keyFile := ca.writeServerFiles(t, t.TempDir())
+
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: "unused", Level: users.WIZARD})
+
+	tests := []struct {
+		name        string
+		pattern     string
+		require     bool
+		cert        *tls.Certificate
+		user        string
+		wantHandErr bool
+		wantLogin   bool
+		wantErr     bool
+	}{
+		{"MappedCN", "", false, ptr(ca.issue(t, "frodo", x509.ExtKeyUsageClientAuth)), "frodo", false, true, false},
+		{"PatternCN", `^backup-(\w+)$`, false, ptr(ca.issue(t, "backup-frodo", x509.ExtKeyUsageClientAuth)), "frodo", false, true, false},
+		{"PatternMismatch", `^backup-(\w+)$`, false, ptr(ca.issue(t, "frodo", x509.ExtKeyUsageClientAuth)), "frodo", false, false, true},
+		{"OtherUser", "", false, ptr(ca.issue(t, "frodo", x509.ExtKeyUsageClientAuth)), "sam", false, false, true},
+		{"UnknownCharacter", "", false, ptr(ca.issue(t, "sam", x509.ExtKeyUsageClientAuth)), "sam", false, false, true},
+		{"UntrustedCert", "", false, ptr(untrusted.issue(t, "frodo", x509.ExtKeyUsageClientAuth)), "frodo", true, false, false},
+		{"NoCertFallsBackToPassword", "", false, nil, "frodo", false, false, false},
+		{"NoCertRequired", "", true, nil, "frodo", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+				c.ClientCAFile = caFile
+				c.RequireClientCert = tt.require
+				c.ClientCertUserPattern = tt.pattern
+			})
+			s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+			driver := &ftpDriver{server: s}
+
+			conn, err := handshake(t, driver, tt.cert)
+			if tt.wantHandErr {
+				if err == nil {
+					t.Fatal("Expected the TLS handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Handshake failed: %v", err)
+			}
+
+			cc := newMockClient(1, "10.0.0.1")
+			clientDriver, err := driver.VerifyConnection(cc, tt.user, conn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyConnection error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (clientDriver != nil) != tt.wantLogin {
+				t.Fatalf("VerifyConnection logged in = %v, want %v", clientDriver != nil, tt.wantLogin)
+			}
+			if tt.wantLogin && clientDriver.(*ftpClient).user != tt.user {
+				t.Errorf("Session user = %q, want %q", clientDriver.(*ftpClient).user, tt.user)
+			}
+		})
+	}
+}
+
+func TestClientCertConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{"RequireWithoutCA", func(c *Config) { c.RequireClientCert = true }},
+		{"InvalidPattern", func(c *Config) { c.ClientCertUserPattern = "(" }},
+		{"PatternWithoutGroup", func(c *Config) { c.ClientCertUserPattern = "^backup-" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{RootDir: t.TempDir()}
+			tt.modify(config)
+			if _, err := New(config, nil, nil, "test"); err == nil {
+				t.Error("Expected New to fail")
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
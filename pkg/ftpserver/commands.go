@@ -0,0 +1,107 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// filterableCommands are the FTP commands a commandFilter can refuse. Most
+// reach the driver, which checks the command ftpserverlib is running before
+// touching the filesystem; SYST, PORT and EPRT never do, so they are turned
+// off through ftpserverlib's settings instead. Other commands, such as USER,
+// PWD or TYPE, cannot be filtered.
+var filterableCommands = map[string]bool{
+	"APPE": true, "CDUP": true, "CWD": true, "DELE": true, "EPRT": true,
+	"HASH": true, "LIST": true, "MD5": true, "MDTM": true, "MFMT": true,
+	"MKD": true, "MLSD": true, "MLST": true, "NLST": true, "PORT": true,
+	"RETR": true, "RMD": true, "RNFR": true, "RNTO": true, "SITE": true,
+	"SIZE": true, "STAT": true, "STOR": true, "SYST": true, "XCRC": true,
+	"XSHA1": true, "XSHA256": true, "XSHA512": true,
+}
+
+// commandAliases maps alternate command names to the command they run, so
+// denying MKD also denies XMKD
+var commandAliases = map[string]string{
+	"XCWD": "CWD",
+	"XMKD": "MKD",
+	"XRMD": "RMD",
+	"XMD5": "MD5",
+	"XSHA": "XSHA1",
+}
+
+// canonicalCommand returns the upper case name of command, with aliases
+// replaced by the command they run
+func canonicalCommand(command string) string {
+	command = strings.ToUpper(command)
+	if target, ok := commandAliases[command]; ok {
+		return target
+	}
+	return command
+}
+
+// commandFilter decides which FTP commands a session may run. Deny rules win
+// over allow rules; with no allow rules every command not denied is accepted.
+type commandFilter struct {
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+// newCommandFilter builds a commandFilter from lists of command names
+func newCommandFilter(allowed, denied []string) (*commandFilter, error) {
+	f := &commandFilter{}
+	var err error
+	if f.allowed, err = parseCommands(allowed); err != nil {
+		return nil, fmt.Errorf("invalid allowed command: %w", err)
+	}
+	if f.denied, err = parseCommands(denied); err != nil {
+		return nil, fmt.Errorf("invalid denied command: %w", err)
+	}
+	return f, nil
+}
+
+func parseCommands(names []string) (map[string]bool, error) {
+	commands := make(map[string]bool, len(names))
+	for _, name := range names {
+		if err := ValidateCommand(name); err != nil {
+			return nil, err
+		}
+		commands[canonicalCommand(name)] = true
+	}
+	return commands, nil
+}
+
+// ValidateCommand checks that name, in any case, is an FTP command that
+// Config.AllowedCommands and Config.DeniedCommands can filter
+func ValidateCommand(name string) error {
+	if !filterableCommands[canonicalCommand(name)] {
+		return fmt.Errorf("%q is not a command that can be filtered", name)
+	}
+	return nil
+}
+
+// allows reports whether command may run. Commands the filter cannot refuse
+// are always allowed.
+func (f *commandFilter) allows(command string) bool {
+	command = canonicalCommand(command)
+	if !filterableCommands[command] {
+		return true
+	}
+	if f.denied[command] {
+		return false
+	}
+	return len(f.allowed) == 0 || f.allowed[command]
+}
+
+// checkCommand refuses the command the session is running if the command
+// filter denies it. Driver methods call it, through resolvePath, before any
+// filesystem work, so a denied DELE fails even where the user may write.
+func (c *ftpClient) checkCommand(name string) error {
+	command := c.cc.GetLastCommand()
+	if c.server.commands.allows(command) {
+		return nil
+	}
+	c.logAccess(logging.OpCommand, name, "denied", "command", command)
+	return permissionDenied(strings.ToLower(command), name)
+}
@@ -0,0 +1,153 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		command string
+		want    bool
+	}{
+		{"NoRules", nil, nil, "DELE", true},
+		{"Denied", nil, []string{"DELE"}, "DELE", false},
+		{"DeniedCaseInsensitive", nil, []string{"dele"}, "DELE", false},
+		{"OtherCommand", nil, []string{"DELE"}, "RETR", true},
+		{"DeniedAlias", nil, []string{"MKD"}, "XMKD", false},
+		{"Allowed", []string{"RETR"}, nil, "RETR", true},
+		{"NotAllowed", []string{"RETR"}, nil, "STOR", false},
+		{"DenyWins", []string{"DELE"}, []string{"DELE"}, "DELE", false},
+		{"UnfilterableAlwaysAllowed", []string{"RETR"}, nil, "PASS", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newCommandFilter(tt.allowed, tt.denied)
+			if err != nil {
+				t.Fatalf("newCommandFilter failed: %v", err)
+			}
+			if got := f.allows(tt.command); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Unfilterable", func(t *testing.T) {
+		if _, err := newCommandFilter(nil, []string{"USER"}); err == nil {
+			t.Error("Expected USER to be rejected")
+		}
+	})
+}
+
+func TestDeniedCommand(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.DeniedCommands = []string{"DELE", "RMD"}
+	})
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+	accessLog := captureAccessLog(t)
+
+	// frodo may write in /players/frodo, so only the command filter stops this
+	home := filepath.Join(s.config.RootDir, "players", "frodo")
+	if err := os.MkdirAll(filepath.Join(home, "old"), 0755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "ring.txt"), []byte("precious"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	client.cc.(*mockClientContext).lastCommand = "DELE"
+	if err := client.Remove("/players/frodo/ring.txt"); !os.IsPermission(err) {
+		t.Errorf("Remove error = %v, want permission denied", err)
+	}
+	if err := client.DeleteFile("/players/frodo/ring.txt"); !os.IsPermission(err) {
+		t.Errorf("DeleteFile error = %v, want permission denied", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "ring.txt")); err != nil {
+		t.Errorf("Expected ring.txt to survive: %v", err)
+	}
+
+	client.cc.(*mockClientContext).lastCommand = "XRMD"
+	if err := client.RemoveAll("/players/frodo/old"); !os.IsPermission(err) {
+		t.Errorf("RemoveAll error = %v, want permission denied", err)
+	}
+
+	// Commands that are not denied still work
+	client.cc.(*mockClientContext).lastCommand = "STOR"
+	f, err := client.Create("/players/frodo/new.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f.Close()
+
+	if log := accessLog(); !strings.Contains(log, "op=command") || !strings.Contains(log, "command=DELE") {
+		t.Errorf("Expected the refused DELE in the access log, got:\n%s", log)
+	}
+}
+
+func TestDeniedCommandSettings(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.ActiveMode = true
+		c.DeniedCommands = []string{"SYST", "site", "EPRT"}
+	})
+	settings, err := (&ftpDriver{server: s}).GetSettings()
+	if err != nil {
+		t.Fatalf("GetSettings failed: %v", err)
+	}
+
+	if !settings.DisableSYST || !settings.DisableSite {
+		t.Errorf("Expected SYST and SITE to be disabled, got DisableSYST=%v DisableSite=%v", settings.DisableSYST, settings.DisableSite)
+	}
+	if !settings.DisableActiveMode {
+		t.Error("Expected denying EPRT to disable active mode")
+	}
+	if settings.DisableMLSD || settings.DisableSTAT {
+		t.Error("Expected commands that are not denied to stay enabled")
+	}
+}
+
+// FEAT is written by ftpserverlib from the settings, so the settings decide
+// which extensions are advertised
+func TestFeatureSettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		denied     []string
+		wantMLSD   bool
+		wantMLST   bool
+		wantHASH   bool
+		wantActive bool
+	}{
+		{"AllEnabled", nil, true, true, true, true},
+		{"ListingsDenied", []string{"MLSD", "MLST"}, false, false, true, true},
+		{"HashDenied", []string{"HASH"}, true, true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.ActiveMode = true
+				c.DeniedCommands = tt.denied
+			})
+			settings, err := (&ftpDriver{server: s}).GetSettings()
+			if err != nil {
+				t.Fatalf("GetSettings failed: %v", err)
+			}
+
+			if settings.DisableMLSD == tt.wantMLSD || settings.DisableMLST == tt.wantMLST {
+				t.Errorf("DisableMLSD = %v, DisableMLST = %v; want MLSD %v, MLST %v", settings.DisableMLSD, settings.DisableMLST, tt.wantMLSD, tt.wantMLST)
+			}
+			if settings.EnableHASH != tt.wantHASH {
+				t.Errorf("EnableHASH = %v, want %v", settings.EnableHASH, tt.wantHASH)
+			}
+			if settings.DisableActiveMode == tt.wantActive {
+				t.Errorf("DisableActiveMode = %v, want active mode %v", settings.DisableActiveMode, tt.wantActive)
+			}
+		})
+	}
+}
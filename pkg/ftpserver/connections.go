@@ -0,0 +1,156 @@
+package ftpserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sync"
+)
+
+// connectionTracker counts active connections by remote IP and authenticated user
+type connectionTracker struct {
+	mu      sync.Mutex
+	clients map[uint32]*trackedClient // keyed by ftpserverlib client ID
+	byIP    map[string]int
+	byUser  map[string]int
+}
+
+// trackedClient records what a single connection contributes to the counts
+type trackedClient struct {
+	ip      string
+	user    string // empty until the client authenticates
+	session string // logged with every line the connection writes
+}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{
+		clients: make(map[uint32]*trackedClient),
+		byIP:    make(map[string]int),
+		byUser:  make(map[string]int),
+	}
+}
+
+// connect records a new connection from addr under its session ID
+func (t *connectionTracker) connect(id uint32, addr net.Addr, session string) {
+	ip := hostOf(addr)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clients[id] = &trackedClient{ip: ip, session: session}
+	t.byIP[ip]++
+}
+
+// session returns the session ID of a tracked connection, or "" if the
+// connection is not tracked
+func (t *connectionTracker) session(id uint32) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if client, ok := t.clients[id]; ok {
+		return client.session
+	}
+	return ""
+}
+
+// login attributes an existing connection to user. If limit is positive and
+// user already holds that many other connections, the connection is left as
+// it was and login returns false.
+func (t *connectionTracker) login(id uint32, user string, limit int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[id]
+	if !ok {
+		return true
+	}
+
+	held := t.byUser[user]
+	if client.user == user {
+		held--
+	}
+	if limit > 0 && held >= limit {
+		return false
+	}
+
+	// A client may re-authenticate as someone else on the same connection
+	if client.user != "" {
+		decrement(t.byUser, client.user)
+	}
+	client.user = user
+	t.byUser[user]++
+	return true
+}
+
+// disconnect removes a connection and everything it contributed, returning
+// its session ID. It reports whether the connection was being tracked.
+func (t *connectionTracker) disconnect(id uint32) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[id]
+	if !ok {
+		return "", false
+	}
+	delete(t.clients, id)
+
+	decrement(t.byIP, client.ip)
+	if client.user != "" {
+		decrement(t.byUser, client.user)
+	}
+	return client.session, true
+}
+
+// connectionsByIP returns a snapshot of active connections per remote IP
+func (t *connectionTracker) connectionsByIP() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copyCounts(t.byIP)
+}
+
+// connectionsByUser returns a snapshot of active connections per authenticated user
+func (t *connectionTracker) connectionsByUser() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copyCounts(t.byUser)
+}
+
+// decrement lowers a count, dropping the key once it reaches zero
+func decrement(counts map[string]int, key string) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	out := make(map[string]int, len(counts))
+	for k, v := range counts {
+		out[k] = v
+	}
+	return out
+}
+
+// newSessionID returns a short random ID that ties together the log lines
+// of one connection. ftpserverlib's client IDs restart with the process, so
+// they cannot be used to tell sessions apart across restarts.
+func newSessionID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b)
+}
+
+// hostOf returns the IP portion of a remote address
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,39 @@
+package ftpserver
+
+import (
+	"github.com/mmcdole/viking-ftpd/pkg/metrics"
+	"github.com/spf13/afero"
+)
+
+// countingFile wraps an afero.File and records transferred bytes in the metrics counters
+type countingFile struct {
+	afero.File
+}
+
+// Read implements io.Reader
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	metrics.BytesRead.Add(int64(n))
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	metrics.BytesRead.Add(int64(n))
+	return n, err
+}
+
+// Write implements io.Writer
+func (f *countingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	metrics.BytesWritten.Add(int64(n))
+	return n, err
+}
+
+// WriteAt implements io.WriterAt
+func (f *countingFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	metrics.BytesWritten.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,42 @@
+package ftpserver
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// dirMessageMaxSize caps how much of a directory message file is sent
+const dirMessageMaxSize = 4096
+
+// dirMessage returns the contents of the message file in dir, or "" if
+// messages are disabled, the file is missing, or the user may not read it.
+// The file is checked and opened like any other download, so the symlink
+// policy and PathAliases apply.
+func (c *ftpClient) dirMessage(dir string) string {
+	name := c.server.config.DirMessageFile
+	if name == "" {
+		return ""
+	}
+
+	path := filepath.Join(dir, name)
+	if !c.canRead(path) {
+		return ""
+	}
+
+	file, err := c.fs.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		return ""
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, dirMessageMaxSize))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(string(content), "\r\n\t ")
+}
@@ -0,0 +1,124 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+// newTestAuthorizer grants everyone read access except under /secret
+func newTestAuthorizer() *authorization.Authorizer {
+	source := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{
+			"*":      int(authorization.Read),
+			"secret": int(authorization.Revoked),
+		},
+	})
+	return authorization.NewAuthorizer(source, users.NewMemorySource(), time.Minute)
+}
+
+func TestDirMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		file     string
+		want     string
+		wantSize int
+	}{
+		{"MessagePresent", "/withmsg", ".message", "Welcome to the guild hall.", 0},
+		{"MessageMissing", "/nomsg", ".message", "", 0},
+		{"Disabled", "/withmsg", "", "", 0},
+		{"Unreadable", "/secret", ".message", "", 0},
+		{"Capped", "/bigmsg", ".message", "", dirMessageMaxSize},
+		{"LinkToDenied", "/pub/links", "secret-message", "", 0},
+		{"LinkOutsideRoot", "/pub/links", "outside-message", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.DirMessageFile = tt.file })
+			s.authorizer = newTestAuthorizer()
+			root := s.config.RootDir
+			setupSymlinkTree(t, root)
+			for _, dir := range []string{"withmsg", "nomsg", "bigmsg"} {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", dir, err)
+				}
+			}
+			write := func(path, content string) {
+				if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", path, err)
+				}
+			}
+			write("withmsg/.message", "Welcome to the guild hall.\n")
+			write("secret/.message", "classified")
+			write("bigmsg/.message", strings.Repeat("x", dirMessageMaxSize*2))
+			for link, target := range map[string]string{
+				"pub/links/secret-message":  "secret/plans.txt",
+				"pub/links/outside-message": "outside/passwd",
+			} {
+				if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+					t.Fatalf("Failed to create %s: %v", link, err)
+				}
+			}
+			client := newTestClient(s, "frodo")
+
+			got := client.dirMessage(tt.dir)
+			if tt.wantSize > 0 {
+				if len(got) != tt.wantSize {
+					t.Errorf("Message length = %d, want %d", len(got), tt.wantSize)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("dirMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostAuthMessage(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.DirMessageFile = ".message" })
+	s.authorizer = newTestAuthorizer()
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, ".message"), []byte("Read the rules.\n"), 0644); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	driver := &ftpDriver{server: s}
+	client := newTestClient(s, "frodo")
+	client.cc.SetExtra(client)
+
+	got := driver.PostAuthMessage(client.cc, "frodo", nil)
+	if got != "Read the rules.\nPassword ok, continue" {
+		t.Errorf("PostAuthMessage() = %q", got)
+	}
+
+	// Failed logins get the library's default reply
+	if got := driver.PostAuthMessage(newMockClient(2, "10.0.0.1"), "frodo", os.ErrPermission); got != "" {
+		t.Errorf("PostAuthMessage() on failure = %q, want empty", got)
+	}
+}
+
+func TestPostAuthMessageSymlink(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.DirMessageFile = ".message" })
+	s.authorizer = newTestAuthorizer()
+	setupSymlinkTree(t, s.config.RootDir)
+	if err := os.Symlink("secret/plans.txt", filepath.Join(s.config.RootDir, ".message")); err != nil {
+		t.Fatalf("Failed to link message: %v", err)
+	}
+	driver := &ftpDriver{server: s}
+	client := newTestClient(s, "frodo")
+	client.cc.SetExtra(client)
+
+	// The login reply must not show what RETR of the message would refuse
+	if _, err := client.Open("/.message"); !os.IsPermission(err) {
+		t.Fatalf("Open(/.message) error = %v, want permission denied", err)
+	}
+	if got := driver.PostAuthMessage(client.cc, "frodo", nil); got != "" {
+		t.Errorf("PostAuthMessage() with a linked message = %q, want empty", got)
+	}
+}
@@ -0,0 +1,50 @@
+package ftpserver
+
+import (
+	"errors"
+	"os"
+)
+
+// Errors returned by ftpClient are *os.PathError values naming the FTP path,
+// so the reply ftpserverlib builds from them tells the client what went
+// wrong without exposing the server's real directory layout. Their causes
+// stay testable with errors.Is (or os.IsPermission and os.IsNotExist):
+//
+//	open /secret/plan.txt: permission denied   (os.ErrPermission)
+//	open /pub/missing.txt: file does not exist (os.ErrNotExist)
+//
+// Failed logins are rejected by AuthUser, which ftpserverlib answers with 530.
+
+// Errors for paths refused by validatePath. They do not name the path, since
+// the path itself is what was refused.
+var (
+	errPathTooLong      = errors.New("path too long")
+	errPathControlChars = errors.New("path contains control characters")
+)
+
+// permissionDenied returns the error for an operation the authorizer refused
+func permissionDenied(op, path string) error {
+	return &os.PathError{Op: op, Path: path, Err: os.ErrPermission}
+}
+
+// fsError rewrites a filesystem error to name the FTP path instead of the
+// real one. Not-found errors are normalized to os.ErrNotExist; other causes
+// are kept. A nil error is returned unchanged.
+func fsError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return &os.PathError{Op: op, Path: path, Err: pathErr.Err}
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return &os.PathError{Op: op, Path: path, Err: linkErr.Err}
+	}
+	return err
+}
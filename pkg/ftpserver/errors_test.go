@@ -0,0 +1,52 @@
+package ftpserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenErrors(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+
+	if err := os.Mkdir(filepath.Join(s.config.RootDir, "secret"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "secret", "plan.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantErr  error
+		otherErr error
+		wantMsg  string
+	}{
+		{"Denied", "/secret/plan.txt", os.ErrPermission, os.ErrNotExist, "open /secret/plan.txt: permission denied"},
+		{"Missing", "/pub/missing.txt", os.ErrNotExist, os.ErrPermission, "open /pub/missing.txt: file does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Open(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open(%s) error = %v, want %v", tt.path, err, tt.wantErr)
+			}
+			if errors.Is(err, tt.otherErr) {
+				t.Errorf("Open(%s) error = %v, should not match %v", tt.path, err, tt.otherErr)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("Open(%s) message = %q, want %q", tt.path, err.Error(), tt.wantMsg)
+			}
+			// Replies must not reveal where the FTP root lives on disk
+			if strings.Contains(err.Error(), s.config.RootDir) {
+				t.Errorf("Open(%s) message %q exposes the root dir", tt.path, err.Error())
+			}
+		})
+	}
+}
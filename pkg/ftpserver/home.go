@@ -0,0 +1,138 @@
+package ftpserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/spf13/afero"
+)
+
+// ExpandHomePattern replaces the tokens in a home directory pattern:
+// %s is the username, %l its first letter in lower case and %% a literal %.
+// Other tokens are left as they are; ValidateHomePattern rejects them.
+func ExpandHomePattern(pattern, user string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 's':
+			b.WriteString(user)
+		case 'l':
+			if user != "" {
+				b.WriteString(strings.ToLower(user[0:1]))
+			}
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+// ValidateHomePattern checks that pattern contains exactly one %s and no
+// tokens other than %s, %l and %%. Errors start with the quoted pattern, for
+// the caller to prefix with the setting's name.
+func ValidateHomePattern(pattern string) error {
+	users := 0
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			continue
+		}
+		if i+1 == len(pattern) {
+			return fmt.Errorf("%q ends with a lone %%", pattern)
+		}
+		i++
+		switch pattern[i] {
+		case 's':
+			users++
+		case 'l', '%':
+		default:
+			return fmt.Errorf("%q has unknown token %%%c (expected %%s, %%l or %%%%)", pattern, pattern[i])
+		}
+	}
+	if users != 1 {
+		return fmt.Errorf("%q must contain exactly one %%s", pattern)
+	}
+	return nil
+}
+
+// expandHome returns the home directory of user relative to the FTP root,
+// whether or not it exists, or "" if no pattern is configured. A pattern
+// that expands to an absolute path inside RootDir is made relative to it;
+// any other path is taken relative to the FTP root.
+func (s *Server) expandHome(user string) string {
+	if s.config.HomePattern == "" {
+		return ""
+	}
+
+	home := filepath.Clean(ExpandHomePattern(s.config.HomePattern, user))
+	if filepath.IsAbs(home) {
+		if root, err := filepath.Abs(s.config.RootDir); err == nil {
+			if rel, err := filepath.Rel(root, home); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				home = rel
+			}
+		}
+	}
+	if home == "." {
+		return ""
+	}
+	return home
+}
+
+// homePath returns the home directory of user relative to the FTP root, or
+// "" if no pattern is configured or the directory does not exist
+func (s *Server) homePath(fs afero.Fs, user string) string {
+	home := s.expandHome(user)
+	if home == "" {
+		return ""
+	}
+	if info, err := fs.Stat(home); err != nil || !info.IsDir() {
+		return "" // Fall back to root if home doesn't exist or isn't a directory
+	}
+	return home
+}
+
+// openHome returns the home directory the session starts in. With
+// AutoCreateHome, a missing home is created if the user may write there.
+// It returns "" for the root when there is no home to use.
+func (c *ftpClient) openHome() string {
+	if home := c.server.homePath(c.fs, c.user); home != "" || !c.server.config.AutoCreateHome {
+		return home
+	}
+
+	home := c.server.expandHome(c.user)
+	if home == "" {
+		return ""
+	}
+	if _, err := c.fs.Stat(home); !errors.Is(err, os.ErrNotExist) {
+		return "" // Something other than a directory is in the way
+	}
+
+	ftpPath := path.Clean("/" + filepath.ToSlash(home))
+	if !c.canWrite(ftpPath) {
+		logging.App.Debug("Not creating home directory without write permission", "user", c.user, "path", ftpPath)
+		return ""
+	}
+
+	mode := c.server.config.HomeDirMode
+	if mode == 0 {
+		mode = DefaultHomeDirMode
+	}
+	if err := c.fs.MkdirAll(home, mode); err != nil {
+		c.logAccess(logging.OpMkdir, ftpPath, "error", "error", err, "reason", "home")
+		return ""
+	}
+	c.logAccess(logging.OpMkdir, ftpPath, "success", "reason", "home")
+	return home
+}
@@ -0,0 +1,156 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+	"github.com/spf13/afero"
+)
+
+func TestExpandHomePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		user    string
+		want    string
+	}{
+		{"players/%s", "frodo", "players/frodo"},
+		{"players/%l/%s", "frodo", "players/f/frodo"},
+		{"players/%l/%s", "Frodo", "players/f/Frodo"},
+		{"/home/%s", "frodo", "/home/frodo"},
+		{"100%%/%s", "frodo", "100%/frodo"},
+		{"players/%d/%s", "frodo", "players/%d/frodo"},
+	}
+
+	for _, tt := range tests {
+		if got := ExpandHomePattern(tt.pattern, tt.user); got != tt.want {
+			t.Errorf("ExpandHomePattern(%q, %q) = %q, want %q", tt.pattern, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestValidateHomePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"players/%s", false},
+		{"players/%l/%s", false},
+		{"/mud/lib/players/%s", false},
+		{"100%%/%s", false},
+		{"players", true},
+		{"%s/%s", true},
+		{"players/%d/%s", true},
+		{"players/%s%", true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateHomePattern(tt.pattern); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateHomePattern(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHomePath(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"players/f/frodo", "players/sam"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	fs := afero.NewBasePathFs(afero.NewOsFs(), root)
+
+	tests := []struct {
+		name    string
+		pattern string
+		user    string
+		want    string
+	}{
+		{"NoPattern", "", "frodo", ""},
+		{"Relative", "players/%s", "sam", "players/sam"},
+		{"LetterToken", "players/%l/%s", "frodo", "players/f/frodo"},
+		{"Absolute", filepath.Join(root, "players", "%l", "%s"), "frodo", "players/f/frodo"},
+		{"MissingFallsBackToRoot", "players/%l/%s", "sam", ""},
+		{"AbsoluteOutsideRoot", filepath.Join(t.TempDir(), "%s"), "frodo", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.RootDir = root
+				c.HomePattern = tt.pattern
+			})
+			if got := s.homePath(fs, tt.user); got != filepath.FromSlash(tt.want) {
+				t.Errorf("homePath(%q) = %q, want %q", tt.user, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		config := &Config{RootDir: root, HomePattern: "players/%d/%s"}
+		if _, err := New(config, nil, nil, "test"); err == nil {
+			t.Error("Expected New to reject the home pattern")
+		}
+	})
+}
+
+func TestAutoCreateHome(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		anonymous  bool
+		autoCreate bool
+		wantPath   string
+	}{
+		{"Created", "players/%s", false, true, "/players/frodo"},
+		{"NoWritePermission", "guests/%s", false, true, "/"},
+		{"Anonymous", "players/%s", true, true, "/"},
+		{"Disabled", "players/%s", false, false, "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.HomePattern = tt.pattern
+				c.AutoCreateHome = tt.autoCreate
+				c.HomeDirMode = 0750
+			})
+			// Everyone may read; players may write their own directory
+			s.authorizer = authorization.NewAuthorizer(authorization.NewMemoryAccessSource(map[string]interface{}{
+				"*": map[string]interface{}{"*": int(authorization.Read)},
+			}), users.NewMemorySource(), time.Minute)
+			driver := &ftpDriver{server: s}
+
+			cc := newMockClient(1, "10.0.0.1")
+			client, err := driver.startSession(cc, "frodo", nil, tt.anonymous, "password")
+			if err != nil {
+				t.Fatalf("startSession failed: %v", err)
+			}
+
+			if cc.Path() != tt.wantPath {
+				t.Errorf("Session path = %q, want %q", cc.Path(), tt.wantPath)
+			}
+			if want := filepath.FromSlash(tt.wantPath[1:]); client.homePath != want {
+				t.Errorf("homePath = %q, want %q", client.homePath, want)
+			}
+
+			home := filepath.Join(s.config.RootDir, filepath.FromSlash(ExpandHomePattern(tt.pattern, "frodo")))
+			info, err := os.Stat(home)
+			if tt.wantPath == "/" {
+				if err == nil {
+					t.Errorf("Expected %s not to be created", home)
+				}
+				return
+			}
+			if err != nil || !info.IsDir() {
+				t.Fatalf("Expected %s to be created: %v", home, err)
+			}
+			if perm := info.Mode().Perm(); perm != 0750 {
+				t.Errorf("Home permissions = %o, want 750", perm)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package ftpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// ipFilterReply is sent to refused clients before their connection is closed
+const ipFilterReply = "421 Connections from your address are not allowed\r\n"
+
+// ipFilter decides which remote addresses may connect. Deny rules win over
+// allow rules; with no allow rules every address not denied is accepted.
+type ipFilter struct {
+	allowed []netip.Prefix
+	denied  []netip.Prefix
+}
+
+// newIPFilter parses IPv4 and IPv6 CIDR lists into an ipFilter
+func newIPFilter(allowed, denied []string) (*ipFilter, error) {
+	f := &ipFilter{}
+	var err error
+	if f.allowed, err = parsePrefixes(allowed); err != nil {
+		return nil, fmt.Errorf("invalid allowed CIDR: %w", err)
+	}
+	if f.denied, err = parsePrefixes(denied); err != nil {
+		return nil, fmt.Errorf("invalid denied CIDR: %w", err)
+	}
+	return f, nil
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// active reports whether the filter has any rules
+func (f *ipFilter) active() bool {
+	return len(f.allowed) > 0 || len(f.denied) > 0
+}
+
+// allows reports whether a connection from addr is permitted
+func (f *ipFilter) allows(addr net.Addr) bool {
+	if len(f.allowed) == 0 && len(f.denied) == 0 {
+		return true
+	}
+
+	ip, ok := addrIP(addr)
+	if !ok {
+		// Unknown addresses can't be shown to be allowed
+		return false
+	}
+
+	for _, prefix := range f.denied {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(f.allowed) == 0 {
+		return true
+	}
+	for _, prefix := range f.allowed {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrIP extracts the IP from a net.Addr, unmapping IPv4-in-IPv6 addresses
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	if addr == nil {
+		return netip.Addr{}, false
+	}
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip, ok := netip.AddrFromSlice(tcp.IP)
+		return ip.Unmap(), ok
+	}
+	ip, err := netip.ParseAddr(hostOf(addr))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// listen opens the control connection listener for addr with the IP filter
+// applied. Refused clients are answered here because ftpserverlib replies 500
+// to an error from ClientConnected, where 421 is the reply for a refused
+// connection. Implicit FTPS clients expect a TLS handshake rather than a
+// reply, so the filter sits below TLS and their connections are only closed.
+func (d *ftpDriver) listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	filtered := &ipFilterListener{Listener: listener, filter: d.server.ipFilter, reply: !d.implicitTLS}
+	if !d.implicitTLS {
+		return filtered, nil
+	}
+
+	tlsConfig, err := d.GetTLSConfig()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return tls.NewListener(filtered, tlsConfig), nil
+}
+
+// ipFilterListener closes connections from addresses the filter does not
+// allow before ftpserverlib sees them
+type ipFilterListener struct {
+	net.Listener
+	filter *ipFilter
+	reply  bool // Send ipFilterReply before closing
+}
+
+// Accept implements net.Listener
+func (l *ipFilterListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.filter.allows(conn.RemoteAddr()) {
+			return conn, nil
+		}
+
+		session := newSessionID()
+		logging.Access.LogAccess(logging.OpConnect, "", conn.RemoteAddr().String(), "denied", "reason", "ip_filter", "session", session)
+		logging.Audit.LogEvent(logging.OpConnect, "", "", conn.RemoteAddr().String(), "denied", "reason", "ip_filter", "session", session)
+		go l.refuse(conn)
+	}
+}
+
+// refuse answers and closes a refused connection without holding up Accept
+func (l *ipFilterListener) refuse(conn net.Conn) {
+	defer conn.Close()
+	if l.reply {
+		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		_, _ = conn.Write([]byte(ipFilterReply))
+	}
+}
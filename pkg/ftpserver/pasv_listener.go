@@ -0,0 +1,61 @@
+package ftpserver
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// parsePasvListenAddr parses Config.PasvListenAddr and checks that it is an
+// address of this host by listening on it briefly. An empty address yields
+// the zero netip.Addr, meaning every interface.
+func parsePasvListenAddr(addr string) (netip.Addr, error) {
+	if addr == "" {
+		return netip.Addr{}, nil
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid passive listen address %q: %w", addr, err)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("passive listen address %q is not usable: %w", addr, err)
+	}
+	listener.Close()
+	return ip.Unmap(), nil
+}
+
+// WrapPassiveListener limits passive data connections to PasvListenAddr.
+// ftpserverlib always listens on every interface and keeps its own handle on
+// the listener for accept deadlines, so the listener cannot be rebound here.
+// Instead, connections made to any other local address are closed.
+// Interface: ftpserverlib.MainDriverExtensionPassiveWrapper
+func (d *ftpDriver) WrapPassiveListener(listener net.Listener) (net.Listener, error) {
+	if !d.server.pasvListenIP.IsValid() {
+		return listener, nil
+	}
+	return &localAddrListener{Listener: listener, ip: d.server.pasvListenIP}, nil
+}
+
+// localAddrListener accepts only connections made to one local address
+type localAddrListener struct {
+	net.Listener
+	ip netip.Addr
+}
+
+// Accept implements net.Listener
+func (l *localAddrListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if ip, ok := addrIP(conn.LocalAddr()); ok && ip == l.ip {
+			return conn, nil
+		}
+		logging.App.Warn("Refused passive connection to another local address", "local_addr", conn.LocalAddr().String(), "client_ip", conn.RemoteAddr().String())
+		conn.Close()
+	}
+}
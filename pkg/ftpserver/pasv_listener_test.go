@@ -0,0 +1,90 @@
+package ftpserver
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPasvListenAddr(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.PasvListenAddr = "127.0.0.1" })
+	if want := netip.MustParseAddr("127.0.0.1"); s.pasvListenIP != want {
+		t.Errorf("pasvListenIP = %v, want %v", s.pasvListenIP, want)
+	}
+
+	for _, addr := range []string{"eth0", "192.0.2.1"} {
+		config := &Config{RootDir: t.TempDir(), PasvListenAddr: addr}
+		if _, err := New(config, nil, nil, "test"); err == nil {
+			t.Errorf("Expected New to reject passive listen address %q", addr)
+		}
+	}
+
+	t.Run("Unset", func(t *testing.T) {
+		s := newTestServer(t, nil)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		defer listener.Close()
+
+		wrapped, err := (&ftpDriver{server: s}).WrapPassiveListener(listener)
+		if err != nil || wrapped != listener {
+			t.Errorf("Expected the listener to be returned unchanged, got %v, %v", wrapped, err)
+		}
+	})
+}
+
+func TestLocalAddrListener(t *testing.T) {
+	tests := []struct {
+		name   string
+		ip     string
+		accept bool
+	}{
+		{"Matching", "127.0.0.1", true},
+		{"OtherAddress", "192.0.2.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("Listen failed: %v", err)
+			}
+			defer tcpListener.Close()
+			// ftpserverlib bounds the wait for a data connection the same way
+			tcpListener.SetDeadline(time.Now().Add(500 * time.Millisecond))
+
+			s := newTestServer(t, nil)
+			s.pasvListenIP = netip.MustParseAddr(tt.ip)
+			listener, err := (&ftpDriver{server: s}).WrapPassiveListener(tcpListener)
+			if err != nil {
+				t.Fatalf("WrapPassiveListener failed: %v", err)
+			}
+
+			client, err := net.Dial("tcp", tcpListener.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer client.Close()
+
+			conn, err := listener.Accept()
+			if tt.accept {
+				if err != nil {
+					t.Fatalf("Accept failed: %v", err)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil {
+				conn.Close()
+				t.Fatal("Expected the connection to be refused")
+			}
+			// The refused connection was closed
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := client.Read(make([]byte, 1)); err == nil {
+				t.Error("Expected the refused connection to be closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package ftpserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// resolveProtectedPaths makes Config.ProtectedPaths absolute and resolves
+// their symlinks, so they can be compared with the real paths clients write
+func resolveProtectedPaths(paths []string) ([]string, error) {
+	resolved := make([]string, 0, len(paths))
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("resolving protected path %q: %w", p, err)
+		}
+		real, err := evalExistingSymlinks(abs)
+		if err != nil {
+			return nil, fmt.Errorf("resolving protected path %q: %w", p, err)
+		}
+		resolved = append(resolved, real)
+	}
+	return resolved, nil
+}
+
+// isProtected reports whether ftpPath is, or is inside, one of ProtectedPaths.
+// The path is compared once aliases and symlinks are resolved, so no other
+// name for a protected file gets around the check. When followLast is false
+// a symlink in the final component is not resolved, since the operation acts
+// on the link itself.
+func (c *ftpClient) isProtected(ftpPath string, followLast bool) bool {
+	if len(c.server.protectedPaths) == 0 {
+		return false
+	}
+
+	full := filepath.Join(c.server.realRoot, filepath.FromSlash(c.server.aliasPath(ftpPath)))
+	var real string
+	var err error
+	if followLast {
+		real, err = evalExistingSymlinks(full)
+	} else {
+		real, err = evalExistingSymlinks(filepath.Dir(full))
+		real = filepath.Join(real, filepath.Base(full))
+	}
+	if err != nil {
+		// A path that cannot be resolved cannot be shown to be safe
+		logging.App.Warn("Refused write to unresolvable path", "user", c.user, "path", ftpPath, "error", err, "session", c.session)
+		return true
+	}
+
+	for _, protected := range c.server.protectedPaths {
+		rel, err := filepath.Rel(protected, real)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		logging.App.Warn("Refused write to protected path", "user", c.user, "path", ftpPath, "protected", protected, "session", c.session)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+func TestProtectedPaths(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.SymlinkPolicy = SymlinkFollow
+		c.ProtectedPaths = []string{
+			filepath.Join(c.RootDir, "dgd", "sys", "data", "access.o"),
+			filepath.Join(c.RootDir, "characters"),
+		}
+	})
+	// frodo may write everywhere, so only the protection stops these writes
+	s.authorizer = authorization.NewAuthorizer(authorization.NewMemoryAccessSource(map[string]interface{}{
+		"frodo": map[string]interface{}{".": int(authorization.GrantWrite), "*": int(authorization.GrantWrite)},
+	}), users.NewMemorySource(), time.Minute)
+	client := newTestClient(s, "frodo")
+
+	root := s.config.RootDir
+	accessFile := filepath.Join(root, "dgd", "sys", "data", "access.o")
+	for _, dir := range []string{filepath.Dir(accessFile), filepath.Join(root, "characters", "f")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(accessFile, []byte("([ ])"), 0644); err != nil {
+		t.Fatalf("Failed to write access file: %v", err)
+	}
+	if err := os.Symlink(accessFile, filepath.Join(root, "access.lnk")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if _, err := client.OpenFile("/dgd/sys/data/access.o", os.O_WRONLY|os.O_TRUNC, 0644); !os.IsPermission(err) {
+		t.Errorf("Writing the access file error = %v, want permission denied", err)
+	}
+	if _, err := client.OpenFile("/access.lnk", os.O_WRONLY|os.O_TRUNC, 0644); !os.IsPermission(err) {
+		t.Errorf("Writing the access file through a symlink error = %v, want permission denied", err)
+	}
+	if err := client.Remove("/dgd/sys/data/access.o"); !os.IsPermission(err) {
+		t.Errorf("Removing the access file error = %v, want permission denied", err)
+	}
+	if _, err := client.Create("/characters/f/frodo.o"); !os.IsPermission(err) {
+		t.Errorf("Creating a character file error = %v, want permission denied", err)
+	}
+	if content, err := os.ReadFile(accessFile); err != nil || string(content) != "([ ])" {
+		t.Errorf("Expected the access file to be untouched, got %q, %v", content, err)
+	}
+
+	// Protected files can still be read
+	f, err := client.Open("/dgd/sys/data/access.o")
+	if err != nil {
+		t.Errorf("Reading the access file failed: %v", err)
+	} else {
+		f.Close()
+	}
+
+	// Removing the symlink acts on the link, not the protected file
+	if err := client.Remove("/access.lnk"); err != nil {
+		t.Errorf("Removing the symlink failed: %v", err)
+	}
+
+	// Unrelated files are written as usual
+	f, err = client.Create("/dgd/sys/data/notes.txt")
+	if err != nil {
+		t.Fatalf("Writing an unrelated file failed: %v", err)
+	}
+	f.Close()
+	if err := client.Rename("/dgd/sys/data/notes.txt", "/characters/notes.txt"); !os.IsPermission(err) {
+		t.Errorf("Moving a file into the character directory error = %v, want permission denied", err)
+	}
+}
+
+func TestNewRejectsUnresolvableProtectedPath(t *testing.T) {
+	root := t.TempDir()
+	loop := filepath.Join(root, "loop")
+	if err := os.Symlink(loop, loop); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	config := &Config{RootDir: root, ProtectedPaths: []string{loop}}
+	if _, err := New(config, nil, nil, "test"); err == nil {
+		t.Error("Expected New to reject a protected path that cannot be resolved")
+	}
+}
@@ -0,0 +1,93 @@
+package ftpserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// DefaultIPDetectURL is queried for the public address when none is configured
+const DefaultIPDetectURL = "https://api.ipify.org"
+
+// ipDetectTimeout bounds how long startup waits for address detection
+const ipDetectTimeout = 5 * time.Second
+
+// IPDetector discovers the public IP address clients should use to reach the server
+type IPDetector interface {
+	DetectIP(ctx context.Context) (string, error)
+}
+
+// HTTPIPDetector asks an HTTP endpoint that replies with the caller's IP as plain text
+type HTTPIPDetector struct {
+	URL    string
+	Client *http.Client
+}
+
+// DetectIP implements IPDetector
+func (d *HTTPIPDetector) DetectIP(ctx context.Context) (string, error) {
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	// An address never needs more than a few dozen bytes
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// resolvePasvAddress returns the address to advertise for passive mode. When
+// auto-detection is enabled the detected address wins; on failure the
+// configured PasvAddress (possibly empty) is used instead.
+func resolvePasvAddress(config *Config) string {
+	if !config.PasvAddressAutoDetect {
+		return config.PasvAddress
+	}
+
+	detector := config.PasvAddressDetector
+	if detector == nil {
+		url := config.PasvAddressDetectURL
+		if url == "" {
+			url = DefaultIPDetectURL
+		}
+		detector = &HTTPIPDetector{URL: url}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ipDetectTimeout)
+	defer cancel()
+
+	ip, err := detector.DetectIP(ctx)
+	if err == nil && net.ParseIP(ip) == nil {
+		err = fmt.Errorf("invalid IP address %q", ip)
+	}
+	if err != nil {
+		logging.App.Warn("Failed to detect public passive address, using configured address", "error", err, "pasv_address", config.PasvAddress)
+		return config.PasvAddress
+	}
+
+	logging.App.Info("Detected public passive address", "pasv_address", ip)
+	return ip
+}
@@ -0,0 +1,132 @@
+package ftpserver
+
+import (
+	"sync"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+// RecentRequest is a permission check made for a session, kept so that
+// SimulateAccess can replay it against proposed access data
+type RecentRequest struct {
+	User  string
+	Path  string
+	Write bool // Write permission was checked, rather than read
+}
+
+// Op returns "write" or "read"
+func (r RecentRequest) Op() string {
+	if r.Write {
+		return "write"
+	}
+	return "read"
+}
+
+// allowed reports whether perm grants the permission r checked
+func (r RecentRequest) allowed(perm authorization.Permission) bool {
+	if r.Write {
+		return perm.CanWrite()
+	}
+	return perm.CanRead()
+}
+
+// requestLog keeps the last permission checks in a fixed-size ring
+type requestLog struct {
+	mu      sync.Mutex
+	entries []RecentRequest
+	next    int
+	full    bool
+}
+
+// newRequestLog creates a log of size entries, or nil to keep none
+func newRequestLog(size int) *requestLog {
+	if size <= 0 {
+		return nil
+	}
+	return &requestLog{entries: make([]RecentRequest, size)}
+}
+
+// add records r, replacing the oldest entry once the log is full
+func (l *requestLog) add(r RecentRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = r
+	l.next++
+	if l.next == len(l.entries) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// snapshot returns the entries, oldest first
+func (l *requestLog) snapshot() []RecentRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]RecentRequest(nil), l.entries[:l.next]...)
+	}
+	return append(append([]RecentRequest(nil), l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// recorded wraps check so each permission check it makes is kept in the
+// server's recent request log
+func (c *ftpClient) recorded(write bool, check func(username, path string) bool) func(username, path string) bool {
+	log := c.server.recentRequests
+	if log == nil {
+		return check
+	}
+	return func(username, path string) bool {
+		log.add(RecentRequest{User: username, Path: path, Write: write})
+		return check(username, path)
+	}
+}
+
+// RecentRequests returns the last Config.RecentRequests permission checks,
+// oldest first
+func (s *Server) RecentRequests() []RecentRequest {
+	if s.recentRequests == nil {
+		return nil
+	}
+	return s.recentRequests.snapshot()
+}
+
+// AccessChange is a recent request whose outcome differs between the current
+// and proposed access data
+type AccessChange struct {
+	RecentRequest
+	Old authorization.Permission
+	New authorization.Permission
+}
+
+// SimulateAccess replays the distinct requests, as returned by
+// Server.RecentRequests, against the current and proposed access data and
+// returns those that would be answered differently, oldest first. Permission
+// changes that do not affect the outcome, such as write to grant_write on a
+// write check, are not reported.
+func SimulateAccess(recent []RecentRequest, current, proposed authorization.AccessSource, userSource users.Source) ([]AccessChange, error) {
+	var requests []RecentRequest
+	var cases []authorization.AccessCase
+	seen := make(map[RecentRequest]bool)
+	for _, r := range recent {
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		requests = append(requests, r)
+		cases = append(cases, authorization.AccessCase{User: r.User, Path: r.Path})
+	}
+
+	diffs, err := authorization.SimulateAccess(current, proposed, userSource, cases)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []AccessChange
+	for i, diff := range diffs {
+		if r := requests[i]; r.allowed(diff.Old) != r.allowed(diff.New) {
+			changes = append(changes, AccessChange{RecentRequest: r, Old: diff.Old, New: diff.New})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,78 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+func TestRequestLog(t *testing.T) {
+	log := newRequestLog(3)
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		log.add(RecentRequest{User: "frodo", Path: path})
+	}
+
+	var got []string
+	for _, r := range log.snapshot() {
+		got = append(got, r.Path)
+	}
+	if want := []string{"/b", "/c", "/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %v, want %v", got, want)
+	}
+
+	if newRequestLog(0) != nil {
+		t.Error("Expected a zero size to keep no log")
+	}
+}
+
+func TestSimulateAccess(t *testing.T) {
+	current := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{"*": int(authorization.Read)},
+	})
+	proposed := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{"*": int(authorization.Read), "secret": int(authorization.Revoked)},
+	})
+
+	s := newTestServer(t, func(c *Config) {
+		c.RecentRequests = 10
+	})
+	s.authorizer = authorization.NewAuthorizer(current, users.NewMemorySource(), 0)
+	client := newTestClient(s, "frodo")
+	if err := os.MkdirAll(filepath.Join(s.config.RootDir, "secret"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	// Two reads of /secret, a read of the root and a refused write
+	for i := 0; i < 2; i++ {
+		if _, err := client.ReadDir("/secret"); err != nil {
+			t.Fatalf("ReadDir(/secret) failed: %v", err)
+		}
+	}
+	if _, err := client.ReadDir("/"); err != nil {
+		t.Fatalf("ReadDir(/) failed: %v", err)
+	}
+	if _, err := client.Create("/notes.txt"); !os.IsPermission(err) {
+		t.Fatalf("Create error = %v, want permission denied", err)
+	}
+
+	if got := len(s.RecentRequests()); got != 4 {
+		t.Errorf("Expected 4 recent requests, got %d: %v", got, s.RecentRequests())
+	}
+
+	changes, err := SimulateAccess(s.RecentRequests(), current, proposed, users.NewMemorySource())
+	if err != nil {
+		t.Fatalf("SimulateAccess failed: %v", err)
+	}
+	want := []AccessChange{{
+		RecentRequest: RecentRequest{User: "frodo", Path: "/secret"},
+		Old:           authorization.Read,
+		New:           authorization.Revoked,
+	}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("SimulateAccess() = %+v, want %+v", changes, want)
+	}
+}
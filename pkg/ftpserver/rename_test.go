@@ -0,0 +1,143 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+)
+
+func TestRename(t *testing.T) {
+	// Everyone can read, /incoming is a drop box, and one file in it is locked
+	source := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{
+			"*": int(authorization.Read),
+			"incoming": map[string]interface{}{
+				"*":          int(authorization.Write),
+				"locked.txt": int(authorization.Read),
+			},
+			// The directory is writable but new entries in it are not
+			"sealed": map[string]interface{}{
+				".": int(authorization.Write),
+				"*": int(authorization.Read),
+			},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr bool
+	}{
+		{"WithinHome", "/players/frodo/draft.txt", "/players/frodo/final.txt", false},
+		{"HomeToSubdir", "/players/frodo/draft.txt", "/players/frodo/done/draft.txt", false},
+		{"HomeToDropBox", "/players/frodo/draft.txt", "/incoming/draft.txt", false},
+		{"DropBoxToHome", "/incoming/upload.txt", "/players/frodo/upload.txt", false},
+		{"ToReadOnlyDir", "/players/frodo/draft.txt", "/pub/draft.txt", true},
+		{"FromReadOnlyDir", "/pub/readme.txt", "/players/frodo/readme.txt", true},
+		{"OverLockedFile", "/players/frodo/draft.txt", "/incoming/locked.txt", true},
+		{"IntoOtherHome", "/players/frodo/draft.txt", "/players/sam/draft.txt", true},
+		{"IntoSealedDir", "/players/frodo/draft.txt", "/sealed/draft.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			s.authorizer = authorization.NewAuthorizer(source, users.NewMemorySource(), time.Minute)
+			client := newTestClient(s, "frodo")
+
+			root := s.config.RootDir
+			for _, dir := range []string{"players/frodo/done", "players/sam", "incoming", "pub", "sealed"} {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", dir, err)
+				}
+			}
+			for _, file := range []string{"players/frodo/draft.txt", "incoming/upload.txt", "incoming/locked.txt", "pub/readme.txt"} {
+				if err := os.WriteFile(filepath.Join(root, file), []byte(file), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", file, err)
+				}
+			}
+
+			err := client.Rename(tt.from, tt.to)
+			if tt.wantErr {
+				if !os.IsPermission(err) {
+					t.Errorf("Rename(%s, %s) error = %v, want permission denied", tt.from, tt.to, err)
+				}
+				if _, err := os.Stat(filepath.Join(root, tt.from)); err != nil {
+					t.Errorf("Source was moved despite denial: %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Rename(%s, %s) failed: %v", tt.from, tt.to, err)
+			}
+			if _, err := os.Stat(filepath.Join(root, tt.to)); err != nil {
+				t.Errorf("Destination missing after rename: %v", err)
+			}
+		})
+	}
+}
+
+// TestRenameMatchesUpload checks that a rename cannot create an entry that
+// an upload to the same path would be refused
+func TestRenameMatchesUpload(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = authorization.NewAuthorizer(authorization.NewMemoryAccessSource(map[string]interface{}{
+		"frodo": map[string]interface{}{
+			"home": int(authorization.Write),
+			"incoming": map[string]interface{}{
+				".": int(authorization.Write),
+				"*": int(authorization.Read),
+			},
+		},
+	}), users.NewMemorySource(), time.Minute)
+	client := newTestClient(s, "frodo")
+
+	root := s.config.RootDir
+	for _, dir := range []string{"home", "incoming"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "home", "x"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := client.Create("/incoming/y"); !os.IsPermission(err) {
+		t.Fatalf("Create(/incoming/y) error = %v, want permission denied", err)
+	}
+	if err := client.Rename("/home/x", "/incoming/y"); !os.IsPermission(err) {
+		t.Errorf("Rename(/home/x, /incoming/y) error = %v, want permission denied", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "incoming", "y")); !os.IsNotExist(err) {
+		t.Errorf("Destination exists after denied rename: %v", err)
+	}
+}
+
+func TestRenameLogsBothPaths(t *testing.T) {
+	accessLog := captureAccessLog(t)
+
+	source := authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{"*": int(authorization.Write)},
+	})
+	s := newTestServer(t, nil)
+	s.authorizer = authorization.NewAuthorizer(source, users.NewMemorySource(), time.Minute)
+	client := newTestClient(s, "frodo")
+
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "draft.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write draft.txt: %v", err)
+	}
+	if err := client.Rename("/draft.txt", "/final.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	want := "op=rename user=frodo from=/draft.txt to=/final.txt status=success"
+	if log := accessLog(); !strings.Contains(log, want) {
+		t.Errorf("Expected access log to contain %q, got:\n%s", want, log)
+	}
+}
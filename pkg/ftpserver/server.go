@@ -4,41 +4,113 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
 
 	ftpserverlib "github.com/fclairamb/ftpserverlib"
 	"github.com/mmcdole/viking-ftpd/pkg/authentication"
 	"github.com/mmcdole/viking-ftpd/pkg/authorization"
 	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
 	"github.com/spf13/afero"
 )
 
 // Config holds the server configuration
 type Config struct {
-	ListenAddr    string // Address to listen on
-	Port          int    // Port to listen on
-	RootDir       string // Root directory that FTP users will be restricted to
-	HomePattern   string // Pattern for user home directories (e.g., "/home/%s")
-	TLSCertFile   string // Path to TLS certificate file
-	TLSKeyFile    string // Path to TLS private key file
-	PasvPortRange [2]int // Range of ports for passive mode transfers
-	PasvAddress   string // Public IP for passive mode connections
-	PasvIPVerify  bool   // Whether to verify data connection IPs
+	ListenAddr            string            // Address to listen on
+	Port                  int               // Port to listen on
+	RootDir               string            // Root directory that FTP users will be restricted to
+	HomePattern           string            // Pattern for user home directories (e.g., "/home/%s" or "players/%l/%s")
+	TLSCertFile           string            // Path to TLS certificate file
+	TLSKeyFile            string            // Path to TLS private key file
+	TLSMinVersion         string            // Minimum TLS version, "1.2" (default) or "1.3"
+	TLSCipherSuites       []string          // Allowed TLS 1.2 cipher suites by name (default: crypto/tls defaults)
+	ImplicitTLSPort       int               // If set, also listen on this port for implicit FTPS (TLS from connect)
+	RequireTLSControl     bool              // Refuse logins on plaintext control connections
+	RequireTLSData        bool              // Refuse plaintext data transfers after login (clients must send PROT P)
+	PasvPortRange         [2]int            // Range of ports for passive mode transfers
+	PasvAddress           string            // Public IP for passive mode connections
+	PasvListenAddr        string            // Local IP passive data connections must arrive on (default: any)
+	PasvAddressAutoDetect bool              // Detect the public IP at startup, falling back to PasvAddress
+	PasvAddressDetectURL  string            // Endpoint queried for the public IP (default DefaultIPDetectURL)
+	PasvAddressDetector   IPDetector        // Overrides the HTTP detector when set
+	PasvIPVerify          bool              // Whether to verify data connection IPs
+	ActiveMode            bool              // Whether to allow active (PORT/EPRT) data connections
+	AllowedCIDRs          []string          // If set, only clients in these networks may connect
+	DeniedCIDRs           []string          // Clients in these networks are always rejected
+	AllowedCommands       []string          // If set, only these FTP commands may run
+	DeniedCommands        []string          // FTP commands that are always refused
+	WelcomeMessage        string            // Banner template; supports {version}, {hostname} and {time}
+	DirMessageFile        string            // Name of a per-directory message file shown to clients (e.g. ".message")
+	SymlinkPolicy         SymlinkPolicy     // How paths through symlinks are authorized (default SymlinkAuthorize)
+	AllowAnonymous        bool              // Allow read-only logins as "anonymous" or "ftp" with any password
+	AnonymousUser         string            // Username anonymous sessions are authorized as (default DefaultAnonymousUser)
+	ClientCAFile          string            // PEM file of CAs trusted to sign client certificates; enables certificate logins
+	RequireClientCert     bool              // Refuse TLS handshakes that do not present a trusted client certificate
+	ClientCertUserPattern string            // Regexp whose first group extracts the username from a certificate CN (default: the whole CN)
+	AutoCreateHome        bool              // Create a missing home directory at login if the user may write there
+	FileMode              os.FileMode       // Permissions of created files, before the umask (default: 0666, or as the client library requests)
+	DirMode               os.FileMode       // Permissions of created directories, before the umask (default: 0755, or as the client library requests)
+	HomeDirMode           os.FileMode       // Permissions of created home directories (default DefaultHomeDirMode)
+	DefaultTransferType   string            // Transfer type before the client sends TYPE, "ascii" (default) or "binary"
+	LogTransferSizes      bool              // Stat files opened for reading to log their size
+	MaxPathLength         int               // Longest FTP path accepted, in bytes (default DefaultMaxPathLength)
+	MaxConnectionsPerUser int               // Most sessions one user may hold at once (0 for no limit)
+	AllowedUsers          []string          // If set, only these users may log in (anonymous logins are unaffected)
+	MinLoginLevel         int               // Lowest character level that may log in (0 for any; users.WIZARD is typical)
+	PathAliases           map[string]string // FTP path prefixes served from another directory, both relative to RootDir
+	ProtectedPaths        []string          // Files and directories no client may write, whatever the authorizer allows
+	RecentRequests        int               // Permission checks kept for SimulateAccess (0 to keep none)
+	MaxUploadBytes        int64             // Largest file an upload may produce, in bytes (0 for no limit)
 }
 
+// DefaultWelcomeMessage is the banner used when Config.WelcomeMessage is empty
+const DefaultWelcomeMessage = "Welcome to Viking FTP server ({version})"
+
+// DefaultHomeDirMode is the permissions of home directories created when
+// Config.HomeDirMode is zero
+const DefaultHomeDirMode os.FileMode = 0755
+
+// DefaultMaxPathLength is the longest FTP path accepted when
+// Config.MaxPathLength is zero
+const DefaultMaxPathLength = 4096
+
+// DefaultAnonymousUser is the identity used when Config.AnonymousUser is empty
+const DefaultAnonymousUser = "anonymous"
+
 // Server wraps the FTP server with our custom auth
 type Server struct {
 	config            *Config
 	authenticator     *authentication.Authenticator
 	authorizer        *authorization.Authorizer
 	server            *ftpserverlib.FtpServer
+	implicitServer    *ftpserverlib.FtpServer // Implicit FTPS listener, nil unless ImplicitTLSPort is set
 	version           string
 	activeConnections atomic.Int32
 	totalConnections  atomic.Int64
+	connections       *connectionTracker
+	ipFilter          *ipFilter
+	commands          *commandFilter
+	allowedUsers      map[string]bool // Lower-cased AllowedUsers, nil to allow everyone
+	pasvAddress       string          // Public IP advertised for passive mode, resolved once in New
+	pasvListenIP      netip.Addr      // Parsed PasvListenAddr, invalid for any address
+	aliases           []pathAlias     // Parsed PathAliases, longest first
+	protectedPaths    []string        // ProtectedPaths, absolute with symlinks resolved
+	recentRequests    *requestLog     // Last RecentRequests permission checks, nil to keep none
+	realRoot          string          // RootDir with symlinks resolved, for symlink policy checks
+	symlinkPolicy     SymlinkPolicy
+	clientCertUser    *regexp.Regexp            // Compiled ClientCertUserPattern, nil for the whole CN
+	transferType      ftpserverlib.TransferType // Parsed DefaultTransferType
+	tlsMinVersion     uint16
+	tlsCipherSuites   []uint16
 	startTime         time.Time
 }
 
@@ -49,30 +121,140 @@ func New(config *Config, authorizer *authorization.Authorizer, authenticator *au
 		return nil, fmt.Errorf("root directory does not exist: %w", err)
 	}
 
+	filter, err := newIPFilter(config.AllowedCIDRs, config.DeniedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	commands, err := newCommandFilter(config.AllowedCommands, config.DeniedCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	pasvListenIP, err := parsePasvListenAddr(config.PasvListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := parsePathAliases(config.PathAliases)
+	if err != nil {
+		return nil, err
+	}
+
+	symlinkPolicy, err := ParseSymlinkPolicy(string(config.SymlinkPolicy))
+	if err != nil {
+		return nil, err
+	}
+	clientCertUser, err := compileClientCertUserPattern(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.HomePattern != "" {
+		if err := ValidateHomePattern(config.HomePattern); err != nil {
+			return nil, fmt.Errorf("home pattern %w", err)
+		}
+	}
+	if config.ImplicitTLSPort != 0 && (config.TLSCertFile == "" || config.TLSKeyFile == "") {
+		return nil, fmt.Errorf("implicit TLS port requires a TLS certificate and key")
+	}
+	if (config.RequireTLSControl || config.RequireTLSData) && (config.TLSCertFile == "" || config.TLSKeyFile == "") {
+		return nil, fmt.Errorf("requiring TLS needs a TLS certificate and key")
+	}
+	if config.MaxPathLength < 0 {
+		return nil, fmt.Errorf("max path length must not be negative")
+	}
+	if config.RecentRequests < 0 {
+		return nil, fmt.Errorf("recent requests must not be negative")
+	}
+	transferType, err := ParseTransferType(config.DefaultTransferType)
+	if err != nil {
+		return nil, err
+	}
+	tlsMinVersion, err := ParseTLSVersion(config.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsCipherSuites, err := ParseCipherSuites(config.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	realRoot, err := filepath.EvalSymlinks(config.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving root directory: %w", err)
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return nil, fmt.Errorf("resolving root directory: %w", err)
+	}
+	protectedPaths, err := resolveProtectedPaths(config.ProtectedPaths)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		config:        config,
-		authorizer:    authorizer,
-		authenticator: authenticator,
-		version:       version,
-		startTime:     time.Now(),
+		config:          config,
+		authorizer:      authorizer,
+		authenticator:   authenticator,
+		version:         version,
+		connections:     newConnectionTracker(),
+		ipFilter:        filter,
+		commands:        commands,
+		allowedUsers:    lowerSet(config.AllowedUsers),
+		pasvAddress:     resolvePasvAddress(config),
+		pasvListenIP:    pasvListenIP,
+		aliases:         aliases,
+		realRoot:        realRoot,
+		protectedPaths:  protectedPaths,
+		recentRequests:  newRequestLog(config.RecentRequests),
+		symlinkPolicy:   symlinkPolicy,
+		clientCertUser:  clientCertUser,
+		transferType:    transferType,
+		tlsMinVersion:   tlsMinVersion,
+		tlsCipherSuites: tlsCipherSuites,
+		startTime:       time.Now(),
 	}
 
 	driver := &ftpDriver{server: s}
 	s.server = ftpserverlib.NewFtpServer(driver)
 
-	// Set our AppLogger as the FTP server's logger
-	s.server.Logger = logging.App
+	// Route the FTP server's logging through our AppLogger. The forwarder
+	// follows logging.App, so a logging reload also applies to the library.
+	s.server.Logger = logging.Forwarder()
+
+	// Implicit FTPS runs as a second ftpserverlib server sharing the same
+	// Server state, since TLS mode is a per-listener setting
+	if config.ImplicitTLSPort != 0 {
+		s.implicitServer = ftpserverlib.NewFtpServer(&ftpDriver{server: s, implicitTLS: true})
+		s.implicitServer.Logger = logging.Forwarder()
+	}
 
 	return s, nil
 }
 
-// ListenAndServe starts the server
+// ListenAndServe starts the server, and the implicit FTPS listener if one is
+// configured. It returns when the main listener stops.
 func (s *Server) ListenAndServe() error {
+	if s.implicitServer != nil {
+		if err := s.implicitServer.Listen(); err != nil {
+			return fmt.Errorf("implicit TLS listener: %w", err)
+		}
+		go func() {
+			if err := s.implicitServer.Serve(); err != nil {
+				logging.App.Error("Implicit TLS listener stopped", "error", err)
+			}
+		}()
+		logging.App.Info("Listening for implicit FTPS", "port", s.config.ImplicitTLSPort)
+	}
 	return s.server.ListenAndServe()
 }
 
 // Stop stops the server
 func (s *Server) Stop() error {
+	if s.implicitServer != nil {
+		if err := s.implicitServer.Stop(); err != nil {
+			logging.App.Warn("Failed to stop implicit TLS listener", "error", err)
+		}
+	}
 	return s.server.Stop()
 }
 
@@ -86,33 +268,151 @@ func (s *Server) GetTotalConnections() int64 {
 	return s.totalConnections.Load()
 }
 
+// GetConnectionsByUser returns the number of active connections per authenticated user
+func (s *Server) GetConnectionsByUser() map[string]int {
+	return s.connections.connectionsByUser()
+}
+
+// GetConnectionsByIP returns the number of active connections per remote IP
+func (s *Server) GetConnectionsByIP() map[string]int {
+	return s.connections.connectionsByIP()
+}
+
 // GetStartTime returns the server start time
 func (s *Server) GetStartTime() time.Time {
 	return s.startTime
 }
 
+// Ready reports why the server cannot serve logins yet: the access trees
+// have never loaded or the FTP root is not an accessible directory
+func (s *Server) Ready() error {
+	if s.authorizer != nil && !s.authorizer.Loaded() {
+		if _, err := s.authorizer.LastRefresh(); err != nil {
+			return fmt.Errorf("access trees not loaded: %w", err)
+		}
+		return fmt.Errorf("access trees not loaded")
+	}
+	info, err := os.Stat(s.config.RootDir)
+	if err != nil {
+		return fmt.Errorf("root directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("root directory %s is not a directory", s.config.RootDir)
+	}
+	return nil
+}
+
+// welcomeMessage expands the configured banner template for a new connection
+func (s *Server) welcomeMessage(now time.Time) string {
+	message := s.config.WelcomeMessage
+	if message == "" {
+		message = DefaultWelcomeMessage
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return strings.NewReplacer(
+		"{version}", s.version,
+		"{hostname}", hostname,
+		"{time}", now.Format("Mon Jan 02 15:04:05 2006"),
+	).Replace(message)
+}
+
+// anonymousIdentity returns the username an anonymous login is authorized
+// as, and whether user is an anonymous login at all
+func (s *Server) anonymousIdentity(user string) (string, bool) {
+	if !s.config.AllowAnonymous {
+		return "", false
+	}
+	switch strings.ToLower(user) {
+	case "anonymous", "ftp":
+	default:
+		return "", false
+	}
+
+	if s.config.AnonymousUser != "" {
+		return s.config.AnonymousUser, true
+	}
+	return DefaultAnonymousUser, true
+}
+
+// userAllowed reports whether AllowedUsers lets user log in
+func (s *Server) userAllowed(user string) bool {
+	return s.allowedUsers == nil || s.allowedUsers[strings.ToLower(user)]
+}
+
+// lowerSet returns the lower-cased names as a set, or nil if there are none
+func lowerSet(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
 // ftpDriver implements ftpserverlib.MainDriver
 type ftpDriver struct {
-	server *Server
+	server      *Server
+	implicitTLS bool // Serves the implicit FTPS listener
 }
 
-var errNoTLS = errors.New("TLS is not configured")
+var (
+	errNoTLS          = errors.New("TLS is not configured")
+	errUserLimit      = errors.New("too many sessions for this user")
+	errUserNotAllowed = errors.New("user is not allowed to log in")
+	errLevelTooLow    = errors.New("character level is too low for FTP access")
+)
 
 // GetSettings returns server settings
 // Interface: ftpserverlib.MainDriver
 func (d *ftpDriver) GetSettings() (*ftpserverlib.Settings, error) {
+	port, tlsRequired := d.server.config.Port, ftpserverlib.ClearOrEncrypted
+	if d.implicitTLS {
+		port, tlsRequired = d.server.config.ImplicitTLSPort, ftpserverlib.ImplicitEncryption
+	}
+
 	settings := &ftpserverlib.Settings{
-		ListenAddr: fmt.Sprintf("%s:%d", d.server.config.ListenAddr, d.server.config.Port),
+		ListenAddr: fmt.Sprintf("%s:%d", d.server.config.ListenAddr, port),
 		PassiveTransferPortRange: &ftpserverlib.PortRange{
 			Start: d.server.config.PasvPortRange[0],
 			End:   d.server.config.PasvPortRange[1],
 		},
-		TLSRequired:       ftpserverlib.ClearOrEncrypted,
-		DisableActiveMode: true,
+		TLSRequired:       tlsRequired,
+		DisableActiveMode: !d.server.config.ActiveMode,
+		// Active connections may only target the client's own IP, which
+		// prevents PORT from being used to bounce connections to third parties.
+		// PasvIPVerify has no effect on active mode.
+		ActiveConnectionsCheck: ftpserverlib.IPMatchRequired,
+		DefaultTransferType:    d.server.transferType,
 	}
 
-	if d.server.config.PasvAddress != "" {
-		settings.PublicHost = d.server.config.PasvAddress
+	// Commands that never reach the driver are refused by ftpserverlib itself.
+	// The others are checked by the driver too, but disabling them here also
+	// keeps them out of the FEAT reply, which ftpserverlib builds from these
+	// settings. It always lists SIZE, MDTM and REST STREAM, and cannot be
+	// made to list anything it does not implement, such as TVFS.
+	commands := d.server.commands
+	if !commands.allows("PORT") || !commands.allows("EPRT") {
+		settings.DisableActiveMode = true
+	}
+	settings.DisableSYST = !commands.allows("SYST")
+	settings.DisableSite = !commands.allows("SITE")
+	settings.DisableSTAT = !commands.allows("STAT")
+	settings.DisableMLSD = !commands.allows("MLSD")
+	settings.DisableMLST = !commands.allows("MLST")
+	settings.DisableMFMT = !commands.allows("MFMT")
+	// One switch covers HASH and the XCRC/XMD5/XSHA* commands, served by
+	// ComputeHash, so refusing HASH refuses them all
+	settings.EnableHASH = commands.allows("HASH")
+
+	if d.server.pasvAddress != "" {
+		settings.PublicHost = d.server.pasvAddress
 	}
 
 	if d.server.config.PasvIPVerify {
@@ -121,70 +421,178 @@ func (d *ftpDriver) GetSettings() (*ftpserverlib.Settings, error) {
 		settings.PasvConnectionsCheck = ftpserverlib.IPMatchDisabled
 	}
 
+	// The IP filter is applied by our own listener, so that refused clients
+	// never reach ClientConnected
+	if d.server.ipFilter.active() {
+		listener, err := d.listen(settings.ListenAddr)
+		if err != nil {
+			return nil, err
+		}
+		settings.Listener = listener
+	}
+
 	return settings, nil
 }
 
 // ClientConnected is called when a client connects
 // Interface: ftpserverlib.MainDriver
 func (d *ftpDriver) ClientConnected(cc ftpserverlib.ClientContext) (string, error) {
+	session := newSessionID()
+
 	// Increment active connection counter
 	d.server.activeConnections.Add(1)
 	// Increment total connection counter
 	d.server.totalConnections.Add(1)
+	d.server.connections.connect(cc.ID(), cc.RemoteAddr(), session)
 
 	// Enable debug logging if log level is debug
 	if logging.App.IsDebug() {
 		cc.SetDebug(true)
 	}
-	logging.Access.LogAccess("connect", "", cc.RemoteAddr().String(), "success")
-	return fmt.Sprintf("Welcome to Viking FTP server (%s)", d.server.version), nil
+	logging.Access.LogAccess(logging.OpConnect, "", cc.RemoteAddr().String(), "success", "session", session)
+	return d.server.welcomeMessage(time.Now()), nil
 }
 
 // ClientDisconnected is called when a client disconnects
 // Interface: ftpserverlib.MainDriver
 func (d *ftpDriver) ClientDisconnected(cc ftpserverlib.ClientContext) {
+	// Clients that were never counted have nothing to remove
+	session, ok := d.server.connections.disconnect(cc.ID())
+	if !ok {
+		return
+	}
+
 	// Decrement active connection counter
 	d.server.activeConnections.Add(-1)
 
-	logging.Access.LogAccess("disconnect", "", cc.RemoteAddr().String(), "success")
+	logging.Access.LogAccess(logging.OpDisconnect, "", cc.RemoteAddr().String(), "success", "session", session)
 }
 
 // AuthUser authenticates the user and returns a ClientDriver
 // Interface: ftpserverlib.MainDriver
 func (d *ftpDriver) AuthUser(cc ftpserverlib.ClientContext, user, pass string) (ftpserverlib.ClientDriver, error) {
-	// Authenticate user
-	_, err := d.server.authenticator.Authenticate(user, pass)
+	// Anonymous logins skip authentication and are authorized, read-only,
+	// as the configured identity
+	identity, anonymous := d.server.anonymousIdentity(user)
+	if anonymous {
+		logging.App.Debug("Anonymous login", "login", user, "identity", identity)
+		return d.startSession(cc, identity, nil, true, "anonymous")
+	}
+
+	character, err := d.server.authenticator.Authenticate(user, pass)
 	if err != nil {
-		logging.Access.LogAuth("login", user, "failed", "error", err, "client_ip", cc.RemoteAddr().String())
+		d.logLoginRefused(cc, user, "failed", "error", err)
 		return nil, fmt.Errorf("authentication failed")
 	}
 
+	if err := d.checkLevel(cc, user, character); err != nil {
+		return nil, err
+	}
+
+	return d.startSession(cc, user, character, false, "password")
+}
+
+// checkLevel refuses characters below MinLoginLevel
+func (d *ftpDriver) checkLevel(cc ftpserverlib.ClientContext, user string, character *users.User) error {
+	if character.Level >= d.server.config.MinLoginLevel {
+		return nil
+	}
+	d.logLoginRefused(cc, user, "denied", "reason", "level", "level", character.Level)
+	return errLevelTooLow
+}
+
+// logLoginRefused writes a failed or refused login to the access log and
+// the audit log, with the client's address and session
+func (d *ftpDriver) logLoginRefused(cc ftpserverlib.ClientContext, user, status string, details ...interface{}) {
+	clientIP := cc.RemoteAddr().String()
+	details = append(details, "session", d.server.connections.session(cc.ID()))
+	logging.Access.LogAuth(logging.OpLogin, user, status, append([]interface{}{"client_ip", clientIP}, details...)...)
+	logging.Audit.LogEvent(logging.OpLogin, user, "", clientIP, status, details...)
+}
+
+// startSession creates the ClientDriver for an authenticated user, starting
+// them in their home directory if it exists or can be created. method is recorded in the
+// access log, along with the character's level and display name when
+// character is known. It fails if AllowedUsers does not list the user or the
+// user already holds MaxConnectionsPerUser sessions.
+func (d *ftpDriver) startSession(cc ftpserverlib.ClientContext, user string, character *users.User, anonymous bool, method string) (*ftpClient, error) {
+	if !anonymous && !d.server.userAllowed(user) {
+		d.logLoginRefused(cc, user, "denied", "reason", "not_allowed")
+		return nil, errUserNotAllowed
+	}
+	if !d.server.connections.login(cc.ID(), user, d.server.config.MaxConnectionsPerUser) {
+		d.logLoginRefused(cc, user, "denied", "reason", "user_limit")
+		return nil, errUserLimit
+	}
+
 	// Create filesystem with root already handled
-	fs := afero.NewBasePathFs(afero.NewOsFs(), d.server.config.RootDir)
-
-	// Set home directory if pattern is configured and directory exists
-	var homePath string
-	if d.server.config.HomePattern != "" {
-		homePath = filepath.Clean(fmt.Sprintf(d.server.config.HomePattern, user))
-		if info, err := fs.Stat(homePath); err != nil || !info.IsDir() {
-			homePath = "" // Fall back to root if home doesn't exist or isn't a directory
-		}
+	var fs afero.Fs = afero.NewBasePathFs(afero.NewOsFs(), d.server.config.RootDir)
+	if len(d.server.aliases) > 0 {
+		fs = &aliasFs{Fs: fs, server: d.server}
 	}
 
-	// Set initial path (home or root)
-	cc.SetPath(filepath.Join("/", homePath))
+	// ftpserverlib checks a client's requirement at USER and before opening
+	// each transfer. Set after USER, it only applies to the data channel.
+	if d.server.config.RequireTLSData {
+		if err := cc.SetTLSRequirement(ftpserverlib.MandatoryEncryption); err != nil {
+			logging.App.Warn("Failed to require TLS for transfers", "user", user, "error", err)
+		}
+	}
 
 	cc.SetDebug(logging.App.IsDebug())
 
-	logging.Access.LogAuth("login", user, "success", "client_ip", cc.RemoteAddr().String())
-	return &ftpClient{
+	client := &ftpClient{
 		server:   d.server,
 		user:     user,
-		homePath: homePath,
 		rootPath: d.server.config.RootDir,
 		fs:       fs,
 		cc:       cc,
-	}, nil
+		readOnly: anonymous,
+		session:  d.server.connections.session(cc.ID()),
+		level:    -1,
+	}
+
+	// Start in the home directory if one is configured, creating it when
+	// AutoCreateHome allows, and in the root otherwise
+	client.homePath = client.openHome()
+	cc.SetPath(filepath.Join("/", client.homePath))
+	// Kept for PostAuthMessage, which ftpserverlib calls with only the context
+	cc.SetExtra(client)
+
+	details := []interface{}{"client_ip", client.clientIP(), "anonymous", anonymous, "method", method}
+	if character != nil {
+		client.level = character.Level
+		client.displayName = character.CapName
+		if client.displayName == "" {
+			client.displayName = user
+		}
+		details = append(details, "level", client.level, "name", client.displayName)
+	}
+	details = append(details, "session", client.session)
+
+	logging.Access.LogAuth(logging.OpLogin, user, "success", details...)
+	return client, nil
+}
+
+// PostAuthMessage returns the reply to a successful or failed login. On
+// success it includes the message file of the directory the user starts in.
+// ftpserverlib's CWD reply cannot be extended by the driver, so this is the
+// only place a directory message can be shown.
+// Interface: ftpserverlib.MainDriverExtensionPostAuthMessage
+func (d *ftpDriver) PostAuthMessage(cc ftpserverlib.ClientContext, user string, authErr error) string {
+	if authErr != nil {
+		return ""
+	}
+	client, ok := cc.Extra().(*ftpClient)
+	if !ok {
+		return ""
+	}
+
+	message := client.dirMessage(cc.Path())
+	if message == "" {
+		return ""
+	}
+	return message + "\nPassword ok, continue"
 }
 
 // GetTLSConfig returns TLS config
@@ -200,10 +608,25 @@ func (d *ftpDriver) GetTLSConfig() (*tls.Config, error) {
 		return nil, fmt.Errorf("loading TLS cert/key pair: %v", err)
 	}
 
-	return &tls.Config{
+	config := &tls.Config{
 		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}, nil
+		MinVersion:   d.server.tlsMinVersion,
+		CipherSuites: d.server.tlsCipherSuites,
+	}
+
+	if d.server.config.ClientCAFile != "" {
+		pool, err := loadCertPool(d.server.config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if d.server.config.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
 }
 
 // ftpClient implements ftpserverlib.ClientDriver and afero.Fs
@@ -214,10 +637,95 @@ type ftpClient struct {
 	homePath string                     // User's home directory path (relative to root)
 	rootPath string                     // Server's root directory absolute path
 	cc       ftpserverlib.ClientContext // Current client context
+	readOnly bool                       // Anonymous sessions may never write
+	session  string                     // Connection's session ID, logged with every access
+
+	remoteOnce sync.Once
+	remoteIP   string // Client's address, set by clientIP
+
+	// The character the session logged in as; level is -1 and displayName
+	// empty when no character was loaded (anonymous and certificate logins)
+	level       int
+	displayName string
+}
+
+// clientIP returns the client's address as logged with each access. It is
+// read from the client context once per session.
+func (c *ftpClient) clientIP() string {
+	c.remoteOnce.Do(func() {
+		c.remoteIP = c.cc.RemoteAddr().String()
+	})
+	return c.remoteIP
+}
+
+// logAccess writes an access log line for this session, and an audit log
+// line if the operation was denied
+func (c *ftpClient) logAccess(operation logging.Operation, path, status string, details ...interface{}) {
+	logging.Access.LogAccess(operation, c.user, path, status, append(details, "client_ip", c.clientIP(), "session", c.session)...)
+	if status == "denied" {
+		logging.Audit.LogEvent(operation, c.user, path, c.clientIP(), status, append(details, "session", c.session)...)
+	}
+}
+
+// logRename writes a rename access log line for this session, and an audit
+// log line if the rename was denied. The audit line's path is the source.
+func (c *ftpClient) logRename(fromPath, toPath, status string, details ...interface{}) {
+	logging.Access.LogRename(c.user, fromPath, toPath, status, append(details, "client_ip", c.clientIP(), "session", c.session)...)
+	if status == "denied" {
+		logging.Audit.LogEvent(logging.OpRename, c.user, fromPath, c.clientIP(), status, append(append([]interface{}{"to", toPath}, details...), "session", c.session)...)
+	}
 }
 
-// resolvePath converts FTP protocol paths to filesystem paths
+// logOpen logs a file opened for reading, with its size if LogTransferSizes
+// is set. Finding the size costs an extra Stat on every open.
+func (c *ftpClient) logOpen(path string, file afero.File) {
+	if !c.server.config.LogTransferSizes {
+		c.logAccess(logging.OpOpen, path, "success")
+		return
+	}
+	var size int64
+	if fi, err := file.Stat(); err == nil {
+		size = fi.Size()
+	}
+	c.logAccess(logging.OpOpen, path, "success", "size", size)
+}
+
+// fileMode returns the configured permissions for new files, or perm if
+// none are configured
+func (c *ftpClient) fileMode(perm os.FileMode) os.FileMode {
+	if c.server.config.FileMode != 0 {
+		return c.server.config.FileMode
+	}
+	return perm
+}
+
+// dirMode returns the configured permissions for new directories, or perm
+// if none are configured
+func (c *ftpClient) dirMode(perm os.FileMode) os.FileMode {
+	if c.server.config.DirMode != 0 {
+		return c.server.config.DirMode
+	}
+	return perm
+}
+
+// resolvePath converts FTP protocol paths to filesystem paths. It fails if
+// the name is refused by validatePath or the command being run is denied
+// by AllowedCommands or DeniedCommands.
+//
+// The result is the path users see, which is what the authorizer checks.
+// PathAliases are applied after that, by the session's filesystem.
+//
+// ftpserverlib joins relative names onto the working directory before the
+// driver sees them, so ~ cannot be expanded to the home directory here: it
+// arrives as an ordinary path component, such as /players/frodo/~/notes.
 func (c *ftpClient) resolvePath(name string) (string, error) {
+	if err := c.validatePath(name); err != nil {
+		return "", err
+	}
+	if err := c.checkCommand(name); err != nil {
+		return "", err
+	}
+
 	// If path is absolute, it's relative to root
 	if filepath.IsAbs(name) {
 		return filepath.Clean(name), nil
@@ -228,6 +736,27 @@ func (c *ftpClient) resolvePath(name string) (string, error) {
 	return filepath.Clean(filepath.Join(currentPath, name)), nil
 }
 
+// validatePath refuses FTP paths longer than MaxPathLength or containing NUL
+// or other control characters, which filesystems treat inconsistently. The
+// path is not echoed in the error or the log, since it is what was refused.
+func (c *ftpClient) validatePath(name string) error {
+	maxLength := c.server.config.MaxPathLength
+	if maxLength == 0 {
+		maxLength = DefaultMaxPathLength
+	}
+	if len(name) > maxLength {
+		logging.App.Debug("Refused over-length path", "user", c.user, "length", len(name), "session", c.session)
+		return errPathTooLong
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			logging.App.Debug("Refused path with control characters", "user", c.user, "session", c.session)
+			return errPathControlChars
+		}
+	}
+	return nil
+}
+
 // GetFS returns the filesystem
 // Interface: ftpserverlib.ClientDriver
 func (c *ftpClient) GetFS() afero.Fs {
@@ -237,11 +766,17 @@ func (c *ftpClient) GetFS() afero.Fs {
 // ChangeCwd implements directory change
 // Interface: ftpserverlib.ClientDriver
 func (c *ftpClient) ChangeCwd(path string) error {
-	if !c.server.authorizer.CanRead(c.user, path) {
-		logging.Access.LogAccess("chdir", c.user, path, "denied")
-		return os.ErrPermission
+	if err := c.validatePath(path); err != nil {
+		return err
+	}
+	if err := c.checkCommand(path); err != nil {
+		return err
+	}
+	if !c.canRead(path) {
+		c.logAccess(logging.OpChdir, path, "denied")
+		return permissionDenied("chdir", path)
 	}
-	logging.Access.LogAccess("chdir", c.user, path, "success")
+	c.logAccess(logging.OpChdir, path, "success")
 	return nil
 }
 
@@ -253,14 +788,14 @@ func (c *ftpClient) ReadDir(name string) ([]os.FileInfo, error) {
 		return nil, err
 	}
 
-	if !c.server.authorizer.CanRead(c.user, path) {
-		logging.Access.LogAccess("readdir", c.user, path, "denied", "error", os.ErrPermission)
-		return nil, os.ErrPermission
+	if !c.canRead(path) {
+		c.logAccess(logging.OpReaddir, path, "denied", "error", os.ErrPermission)
+		return nil, permissionDenied("readdir", path)
 	}
 
 	f, err := c.fs.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, fsError("readdir", path, err)
 	}
 	defer f.Close()
 
@@ -273,7 +808,7 @@ func (c *ftpClient) ReadDir(name string) ([]os.FileInfo, error) {
 
 	entries, err := readDirIface.Readdir(-1)
 	if err != nil {
-		return nil, err
+		return nil, fsError("readdir", path, err)
 	}
 
 	// Sort entries alphabetically by name
@@ -281,7 +816,7 @@ func (c *ftpClient) ReadDir(name string) ([]os.FileInfo, error) {
 		return entries[i].Name() < entries[j].Name()
 	})
 
-	logging.Access.LogAccess("readdir", c.user, path, "success", "count", len(entries))
+	c.logAccess(logging.OpReaddir, path, "success", "count", len(entries))
 	return entries, nil
 }
 
@@ -293,34 +828,39 @@ func (c *ftpClient) DeleteFile(name string) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, path) {
-		logging.Access.LogAccess("remove", c.user, name, "denied", "error", err)
-		return os.ErrPermission
+	if !c.canWriteEntry(path) {
+		c.logAccess(logging.OpRemove, name, "denied", "error", err)
+		return permissionDenied("remove", path)
 	}
 
 	if err := c.fs.Remove(path); err != nil {
-		logging.Access.LogAccess("remove", c.user, name, "error", "error", err)
-		return err
+		c.logAccess(logging.OpRemove, name, "error", "error", err)
+		return fsError("remove", path, err)
 	}
 
-	logging.Access.LogAccess("remove", c.user, name, "success")
+	c.logAccess(logging.OpRemove, name, "success")
 	return nil
 }
 
 // MakeDirectory implements directory creation
 // Interface: ftpserverlib.ClientDriver
 func (c *ftpClient) MakeDirectory(name string) error {
-	if !c.server.authorizer.CanWrite(c.user, name) {
-		logging.Access.LogAccess("mkdir", c.user, name, "denied", "error", os.ErrPermission)
-		return os.ErrPermission
+	path, err := c.resolvePath(name)
+	if err != nil {
+		return err
 	}
 
-	if err := c.fs.Mkdir(name, 0755); err != nil {
-		logging.Access.LogAccess("mkdir", c.user, name, "error", "error", err)
-		return err
+	if !c.canWrite(path) {
+		c.logAccess(logging.OpMkdir, path, "denied", "error", os.ErrPermission)
+		return permissionDenied("mkdir", path)
 	}
 
-	logging.Access.LogAccess("mkdir", c.user, name, "success")
+	if err := c.fs.Mkdir(path, c.dirMode(0755)); err != nil {
+		c.logAccess(logging.OpMkdir, path, "error", "error", err)
+		return fsError("mkdir", path, err)
+	}
+
+	c.logAccess(logging.OpMkdir, path, "success")
 	return nil
 }
 
@@ -332,24 +872,19 @@ func (c *ftpClient) Open(name string) (afero.File, error) {
 		return nil, err
 	}
 
-	if !c.server.authorizer.CanRead(c.user, path) {
-		logging.Access.LogAccess("open", c.user, path, "denied", "error", os.ErrPermission)
-		return nil, os.ErrPermission
+	if !c.canRead(path) {
+		c.logAccess(logging.OpOpen, path, "denied", "error", os.ErrPermission)
+		return nil, permissionDenied("open", path)
 	}
 
 	file, err := c.fs.Open(path)
 	if err != nil {
-		logging.Access.LogAccess("open", c.user, path, "error", "error", err)
-		return nil, err
+		c.logAccess(logging.OpOpen, path, "error", "error", err)
+		return nil, fsError("open", path, err)
 	}
 
-	// Get file size for logging
-	if fi, err := file.Stat(); err == nil {
-		logging.Access.LogAccess("open", c.user, path, "success", "size", fi.Size())
-	} else {
-		logging.Access.LogAccess("open", c.user, path, "success", "size", 0)
-	}
-	return file, nil
+	c.logOpen(path, file)
+	return &countingFile{File: file}, nil
 }
 
 // OpenFile opens a file using the given flags and mode
@@ -360,37 +895,53 @@ func (c *ftpClient) OpenFile(name string, flag int, perm os.FileMode) (afero.Fil
 		return nil, err
 	}
 
+	// APPE adds to the end of a file (creating it if needed) and must never
+	// truncate existing content, whatever flags the library passes
+	if c.cc.GetLastCommand() == "APPE" {
+		flag = (flag | os.O_WRONLY | os.O_APPEND | os.O_CREATE) &^ os.O_RDWR
+	}
+	if flag&os.O_APPEND != 0 {
+		flag &^= os.O_TRUNC
+	}
+
 	// Check write permission if file is being created or modified
 	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-		if !c.server.authorizer.CanWrite(c.user, path) {
-			logging.Access.LogAccess("open", c.user, path, "denied", "error", os.ErrPermission)
-			return nil, os.ErrPermission
+		mode := "write"
+		if flag&os.O_APPEND != 0 {
+			mode = "append"
+		}
+		if !c.canWrite(path) {
+			c.logAccess(logging.OpOpen, path, "denied", "error", os.ErrPermission, "mode", mode)
+			return nil, permissionDenied("open", path)
 		}
-		logging.Access.LogAccess("open", c.user, path, "success", "mode", "write")
-	} else if !c.server.authorizer.CanRead(c.user, path) {
-		logging.Access.LogAccess("open", c.user, path, "denied", "error", os.ErrPermission)
-		return nil, os.ErrPermission
+		c.logAccess(logging.OpOpen, path, "success", "mode", mode)
+	} else if !c.canRead(path) {
+		c.logAccess(logging.OpOpen, path, "denied", "error", os.ErrPermission)
+		return nil, permissionDenied("open", path)
 	}
 
-	file, err := c.fs.OpenFile(path, flag, perm)
+	file, err := c.fs.OpenFile(path, flag, c.fileMode(perm))
 	if err != nil {
 		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-			logging.Access.LogAccess("open", c.user, path, "error", "mode", "write")
+			c.logAccess(logging.OpOpen, path, "error", "mode", "write")
 		} else {
-			logging.Access.LogAccess("open", c.user, path, "error", "mode", "read")
+			c.logAccess(logging.OpOpen, path, "error", "mode", "read")
 		}
-		return nil, err
+		return nil, fsError("open", path, err)
 	}
 
-	// Only log size for read operations
+	// Writes were logged before opening
 	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
-		if fi, err := file.Stat(); err == nil {
-			logging.Access.LogAccess("open", c.user, path, "success", "size", fi.Size())
-		} else {
-			logging.Access.LogAccess("open", c.user, path, "success", "size", 0)
-		}
+		c.logOpen(path, file)
+		return &countingFile{File: file}, nil
 	}
-	return file, nil
+
+	limited, err := c.limitUpload(logging.OpOpen, path, file, flag)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &countingFile{File: limited}, nil
 }
 
 // Create creates a new file
@@ -401,19 +952,25 @@ func (c *ftpClient) Create(name string) (afero.File, error) {
 		return nil, err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, path) {
-		logging.Access.LogAccess("create", c.user, path, "denied", "error", os.ErrPermission)
-		return nil, os.ErrPermission
+	if !c.canWrite(path) {
+		c.logAccess(logging.OpCreate, path, "denied", "error", os.ErrPermission)
+		return nil, permissionDenied("create", path)
+	}
+
+	file, err := c.fs.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, c.fileMode(0666))
+	if err != nil {
+		c.logAccess(logging.OpCreate, path, "error", "error", err)
+		return nil, fsError("create", path, err)
 	}
 
-	file, err := c.fs.Create(path)
+	limited, err := c.limitUpload(logging.OpCreate, path, file, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
 	if err != nil {
-		logging.Access.LogAccess("create", c.user, path, "error", "error", err)
+		file.Close()
 		return nil, err
 	}
 
-	logging.Access.LogAccess("create", c.user, path, "success", "mode", "write")
-	return file, nil
+	c.logAccess(logging.OpCreate, path, "success", "mode", "write")
+	return &countingFile{File: limited}, nil
 }
 
 // Mkdir creates a directory
@@ -424,13 +981,13 @@ func (c *ftpClient) Mkdir(name string, perm os.FileMode) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, path) {
-		logging.Access.LogAccess("mkdir", c.user, path, "denied", "error", os.ErrPermission)
-		return os.ErrPermission
+	if !c.canWrite(path) {
+		c.logAccess(logging.OpMkdir, path, "denied", "error", os.ErrPermission)
+		return permissionDenied("mkdir", path)
 	}
-	err = c.fs.Mkdir(name, perm)
-	logging.Access.LogAccess("mkdir", c.user, path, "success", "mode", "write")
-	return err
+	err = c.fs.Mkdir(path, c.dirMode(perm))
+	c.logAccess(logging.OpMkdir, path, "success", "mode", "write")
+	return fsError("mkdir", path, err)
 }
 
 // MkdirAll creates a directory and all parent directories
@@ -441,13 +998,13 @@ func (c *ftpClient) MkdirAll(path string, perm os.FileMode) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, resolvedPath) {
-		logging.Access.LogAccess("mkdir", c.user, resolvedPath, "denied", "error", os.ErrPermission)
-		return os.ErrPermission
+	if !c.canWrite(resolvedPath) {
+		c.logAccess(logging.OpMkdir, resolvedPath, "denied", "error", os.ErrPermission)
+		return permissionDenied("mkdir", resolvedPath)
 	}
-	err = c.fs.MkdirAll(resolvedPath, perm)
-	logging.Access.LogAccess("mkdir", c.user, resolvedPath, "success", "mode", "write")
-	return err
+	err = c.fs.MkdirAll(resolvedPath, c.dirMode(perm))
+	c.logAccess(logging.OpMkdir, resolvedPath, "success", "mode", "write")
+	return fsError("mkdir", resolvedPath, err)
 }
 
 // Remove removes a file
@@ -458,17 +1015,17 @@ func (c *ftpClient) Remove(name string) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, path) {
-		logging.Access.LogAccess("remove", c.user, path, "denied", "error", os.ErrPermission)
-		return os.ErrPermission
+	if !c.canWriteEntry(path) {
+		c.logAccess(logging.OpRemove, path, "denied", "error", os.ErrPermission)
+		return permissionDenied("remove", path)
 	}
 
 	if err := c.fs.Remove(path); err != nil {
-		logging.Access.LogAccess("remove", c.user, path, "error", "error", err)
-		return err
+		c.logAccess(logging.OpRemove, path, "error", "error", err)
+		return fsError("remove", path, err)
 	}
 
-	logging.Access.LogAccess("remove", c.user, path, "success", "mode", "write")
+	c.logAccess(logging.OpRemove, path, "success", "mode", "write")
 	return nil
 }
 
@@ -480,21 +1037,25 @@ func (c *ftpClient) RemoveAll(path string) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, resolvedPath) {
-		logging.Access.LogAccess("remove", c.user, resolvedPath, "denied", "error", os.ErrPermission)
-		return os.ErrPermission
+	if !c.canWriteEntry(resolvedPath) {
+		c.logAccess(logging.OpRemove, resolvedPath, "denied", "error", os.ErrPermission)
+		return permissionDenied("remove", resolvedPath)
 	}
 
 	if err := c.fs.RemoveAll(resolvedPath); err != nil {
-		logging.Access.LogAccess("remove", c.user, resolvedPath, "error", "error", err)
-		return err
+		c.logAccess(logging.OpRemove, resolvedPath, "error", "error", err)
+		return fsError("remove", resolvedPath, err)
 	}
 
-	logging.Access.LogAccess("remove", c.user, resolvedPath, "success", "mode", "write")
+	c.logAccess(logging.OpRemove, resolvedPath, "success", "mode", "write")
 	return nil
 }
 
-// Rename renames a file
+// Rename renames or moves a file. The source must be writable, since it is
+// removed from its directory, and the destination's parent directory must be
+// writable, since the new entry is created there. The destination itself
+// must also be writable, as for an upload to the same path; a path with no
+// rule of its own takes its parent's "*" rule.
 // Interface: afero.Fs
 func (c *ftpClient) Rename(oldname, newname string) error {
 	oldPath, err := c.resolvePath(oldname)
@@ -506,21 +1067,25 @@ func (c *ftpClient) Rename(oldname, newname string) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, oldPath) ||
-		!c.server.authorizer.CanWrite(c.user, newPath) {
-		logging.Access.LogAccess("rename", c.user, oldPath, "denied", "error", os.ErrPermission)
-		return os.ErrPermission
+	if !c.canRenameTo(oldPath, newPath) {
+		c.logRename(oldPath, newPath, "denied", "error", os.ErrPermission)
+		return permissionDenied("rename", oldPath)
 	}
 
 	if err := c.fs.Rename(oldPath, newPath); err != nil {
-		logging.Access.LogAccess("rename", c.user, oldPath, "error", "error", err)
-		return err
+		c.logRename(oldPath, newPath, "error", "error", err)
+		return fsError("rename", oldPath, err)
 	}
 
-	logging.Access.LogAccess("rename", c.user, oldPath, "success", "mode", "write")
+	c.logRename(oldPath, newPath, "success", "mode", "write")
 	return nil
 }
 
+// canRenameTo reports whether the user may move oldPath to newPath
+func (c *ftpClient) canRenameTo(oldPath, newPath string) bool {
+	return c.canWriteEntry(oldPath) && c.canWrite(filepath.Dir(newPath)) && c.canWriteEntry(newPath)
+}
+
 // Stat returns file info
 // Interface: afero.Fs
 func (c *ftpClient) Stat(name string) (os.FileInfo, error) {
@@ -529,10 +1094,14 @@ func (c *ftpClient) Stat(name string) (os.FileInfo, error) {
 		return nil, err
 	}
 
-	if !c.server.authorizer.CanRead(c.user, path) {
-		return nil, os.ErrPermission
+	if !c.canRead(path) {
+		return nil, permissionDenied("stat", path)
 	}
-	return c.fs.Stat(path)
+	info, err := c.fs.Stat(path)
+	if err != nil {
+		return nil, fsError("stat", path, err)
+	}
+	return info, nil
 }
 
 // Name returns the name of the filesystem
@@ -549,10 +1118,10 @@ func (c *ftpClient) Chmod(name string, mode os.FileMode) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, path) {
-		return os.ErrPermission
+	if !c.canWrite(path) {
+		return permissionDenied("chmod", path)
 	}
-	return c.fs.Chmod(path, mode)
+	return fsError("chmod", path, c.fs.Chmod(path, mode))
 }
 
 // Chown changes file owner
@@ -563,17 +1132,22 @@ func (c *ftpClient) Chown(name string, uid, gid int) error {
 		return err
 	}
 
-	if !c.server.authorizer.CanWrite(c.user, path) {
-		return os.ErrPermission
+	if !c.canWrite(path) {
+		return permissionDenied("chown", path)
 	}
-	return c.fs.Chown(path, uid, gid)
+	return fsError("chown", path, c.fs.Chown(path, uid, gid))
 }
 
 // Chtimes changes file times
 // Interface: afero.Fs
 func (c *ftpClient) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	if !c.server.authorizer.CanWrite(c.user, name) {
-		return os.ErrPermission
+	path, err := c.resolvePath(name)
+	if err != nil {
+		return err
+	}
+
+	if !c.canWrite(path) {
+		return permissionDenied("chtimes", path)
 	}
-	return c.fs.Chtimes(name, atime, mtime)
+	return fsError("chtimes", path, c.fs.Chtimes(path, atime, mtime))
 }
@@ -0,0 +1,1079 @@
+package ftpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+	"github.com/mmcdole/viking-ftpd/pkg/authentication"
+	"github.com/mmcdole/viking-ftpd/pkg/authorization"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/users"
+	"github.com/spf13/afero"
+)
+
+// newTestServer creates a Server rooted in a temp dir with the given config tweaks
+func newTestServer(t *testing.T, modify func(c *Config)) *Server {
+	t.Helper()
+
+	config := &Config{
+		ListenAddr:    "127.0.0.1",
+		Port:          2121,
+		RootDir:       t.TempDir(),
+		PasvPortRange: [2]int{2122, 2150},
+	}
+	if modify != nil {
+		modify(config)
+	}
+
+	s, err := New(config, nil, nil, "test")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return s
+}
+
+// captureAccessLog sends the access log to a file for the rest of the test.
+// The returned function closes the log and returns its contents.
+func captureAccessLog(t *testing.T) func() string {
+	t.Helper()
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := logging.NewAccessLogger(logPath, 1000000, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Failed to create access logger: %v", err)
+	}
+	oldAccess := logging.Access
+	logging.Access = accessLog
+	t.Cleanup(func() { logging.Access = oldAccess })
+
+	return func() string {
+		t.Helper()
+		if err := accessLog.Close(); err != nil {
+			t.Fatalf("Failed to close access logger: %v", err)
+		}
+		data, err := os.ReadFile(logPath)
+		if err != nil {
+			t.Fatalf("Failed to read access log: %v", err)
+		}
+		return string(data)
+	}
+}
+
+func TestGetSettingsActiveMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		activeMode  bool
+		wantDisable bool
+	}{
+		{"DefaultDisabled", false, true},
+		{"Enabled", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.ActiveMode = tt.activeMode })
+			driver := &ftpDriver{server: s}
+
+			settings, err := driver.GetSettings()
+			if err != nil {
+				t.Fatalf("GetSettings failed: %v", err)
+			}
+
+			if settings.DisableActiveMode != tt.wantDisable {
+				t.Errorf("DisableActiveMode = %v, want %v", settings.DisableActiveMode, tt.wantDisable)
+			}
+			if settings.ActiveConnectionsCheck != ftpserverlib.IPMatchRequired {
+				t.Errorf("ActiveConnectionsCheck = %v, want IPMatchRequired", settings.ActiveConnectionsCheck)
+			}
+		})
+	}
+}
+
+// fakeDetector is an IPDetector returning a fixed result
+type fakeDetector struct {
+	ip  string
+	err error
+}
+
+func (d *fakeDetector) DetectIP(ctx context.Context) (string, error) {
+	return d.ip, d.err
+}
+
+func TestPasvAddressAutoDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoDetect bool
+		detector   *fakeDetector
+		configured string
+		want       string
+	}{
+		{"Disabled", false, &fakeDetector{ip: "203.0.113.7"}, "198.51.100.1", "198.51.100.1"},
+		{"Detected", true, &fakeDetector{ip: "203.0.113.7"}, "198.51.100.1", "203.0.113.7"},
+		{"FailureFallsBack", true, &fakeDetector{err: errors.New("timeout")}, "198.51.100.1", "198.51.100.1"},
+		{"FailureWithoutFallback", true, &fakeDetector{err: errors.New("timeout")}, "", ""},
+		{"InvalidResponseFallsBack", true, &fakeDetector{ip: "<html>"}, "198.51.100.1", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.PasvAddress = tt.configured
+				c.PasvAddressAutoDetect = tt.autoDetect
+				c.PasvAddressDetector = tt.detector
+			})
+
+			settings, err := (&ftpDriver{server: s}).GetSettings()
+			if err != nil {
+				t.Fatalf("GetSettings failed: %v", err)
+			}
+			if settings.PublicHost != tt.want {
+				t.Errorf("PublicHost = %q, want %q", settings.PublicHost, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPIPDetector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer srv.Close()
+
+	ip, err := (&HTTPIPDetector{URL: srv.URL}).DetectIP(context.Background())
+	if err != nil {
+		t.Fatalf("DetectIP failed: %v", err)
+	}
+	if ip != "203.0.113.7" {
+		t.Errorf("DetectIP = %q, want 203.0.113.7", ip)
+	}
+}
+
+// mockClientContext implements the parts of ftpserverlib.ClientContext the
+// driver uses. Calling any other method panics on the nil embedded interface.
+type mockClientContext struct {
+	ftpserverlib.ClientContext
+	id          uint32
+	addr        net.Addr
+	path        string
+	lastCommand string
+	tlsControl  bool
+	tlsRequired ftpserverlib.TLSRequirement
+	extra       any
+}
+
+func (m *mockClientContext) ID() uint32           { return m.id }
+func (m *mockClientContext) RemoteAddr() net.Addr { return m.addr }
+func (m *mockClientContext) SetDebug(bool)        {}
+func (m *mockClientContext) Path() string         { return m.path }
+func (m *mockClientContext) SetPath(path string)  { m.path = path }
+func (m *mockClientContext) GetLastCommand() string {
+	return m.lastCommand
+}
+func (m *mockClientContext) HasTLSForControl() bool { return m.tlsControl }
+func (m *mockClientContext) SetExtra(extra any)     { m.extra = extra }
+func (m *mockClientContext) Extra() any             { return m.extra }
+func (m *mockClientContext) SetTLSRequirement(requirement ftpserverlib.TLSRequirement) error {
+	m.tlsRequired = requirement
+	return nil
+}
+
+func newMockClient(id uint32, ip string) *mockClientContext {
+	return &mockClientContext{
+		id:   id,
+		addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000},
+		path: "/",
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		ip      string
+		wantOK  bool
+	}{
+		{"NoListsAllowsAll", nil, nil, "203.0.113.7", true},
+		{"InAllowList", []string{"10.0.0.0/8"}, nil, "10.1.2.3", true},
+		{"NotInAllowList", []string{"10.0.0.0/8"}, nil, "203.0.113.7", false},
+		{"InDenyList", nil, []string{"203.0.113.0/24"}, "203.0.113.7", false},
+		{"NotInDenyList", nil, []string{"203.0.113.0/24"}, "198.51.100.1", true},
+		{"DenyWinsOverAllow", []string{"10.0.0.0/8"}, []string{"10.6.0.0/16"}, "10.6.0.1", false},
+		{"IPv6Allowed", []string{"2001:db8::/32"}, nil, "2001:db8::1", true},
+		{"IPv6Denied", nil, []string{"2001:db8::/32"}, "2001:db8::1", false},
+		{"MappedIPv4MatchesIPv4Rule", []string{"10.0.0.0/8"}, nil, "::ffff:10.1.2.3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newIPFilter(tt.allowed, tt.denied)
+			if err != nil {
+				t.Fatalf("newIPFilter failed: %v", err)
+			}
+			addr := &net.TCPAddr{IP: net.ParseIP(tt.ip), Port: 40000}
+			if got := filter.allows(addr); got != tt.wantOK {
+				t.Errorf("allows(%s) = %v, want %v", tt.ip, got, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIPFilterReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		want    int
+	}{
+		{"Denied", nil, []string{"127.0.0.0/8"}, 421},
+		{"NotAllowed", []string{"10.0.0.0/8"}, nil, 421},
+		{"Allowed", []string{"127.0.0.0/8"}, nil, 220},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.Port = 0
+				c.AllowedCIDRs = tt.allowed
+				c.DeniedCIDRs = tt.denied
+			})
+			auditLog := captureAuditLog(t)
+			if err := s.server.Listen(); err != nil {
+				t.Fatalf("Listen failed: %v", err)
+			}
+			go s.server.Serve()
+			t.Cleanup(func() { s.Stop() })
+
+			conn, err := textproto.Dial("tcp", s.server.Addr())
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+
+			code, message, err := conn.ReadResponse(tt.want)
+			if err != nil {
+				t.Fatalf("Reply = %d %q, want %d: %v", code, message, tt.want, err)
+			}
+			if tt.want == 220 {
+				_, _ = conn.Cmd("QUIT")
+				_, _ = io.Copy(io.Discard, conn.R)
+				return
+			}
+
+			// The server hangs up without counting the client
+			if _, err := conn.ReadLine(); err != io.EOF {
+				t.Errorf("Expected the connection to be closed, got %v", err)
+			}
+			if got := s.GetActiveConnections(); got != 0 {
+				t.Errorf("Active connections = %d, want 0", got)
+			}
+			if log := auditLog(); !strings.Contains(log, "op=connect user= path= client_ip=127.0.0.1:") || !strings.Contains(log, "status=denied reason=ip_filter") {
+				t.Errorf("Expected the refused connection in the audit log, got:\n%s", log)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidCIDR(t *testing.T) {
+	config := &Config{RootDir: t.TempDir(), DeniedCIDRs: []string{"not-a-cidr"}}
+	if _, err := New(config, nil, nil, "test"); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestLoginLogsCharacter(t *testing.T) {
+	hash, err := authentication.NewArgon2ID().Hash("mellon")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: hash, Level: users.WIZARD, CapName: "Frodo"})
+	source.AddUser(&users.User{Username: "sam", PasswordHash: hash, Level: 12})
+
+	tests := []struct {
+		user string
+		want string
+	}{
+		{"frodo", fmt.Sprintf("user=frodo status=success client_ip=10.0.0.1:40000 anonymous=false method=password level=%d name=Frodo", users.WIZARD)},
+		// Without a cap_name the username is the display name
+		{"sam", "user=sam status=success client_ip=10.0.0.1:40000 anonymous=false method=password level=12 name=sam"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			accessLog := captureAccessLog(t)
+			s := newTestServer(t, nil)
+			s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+			driver := &ftpDriver{server: s}
+
+			clientDriver, err := driver.AuthUser(newMockClient(1, "10.0.0.1"), tt.user, "mellon")
+			if err != nil {
+				t.Fatalf("AuthUser failed: %v", err)
+			}
+			client := clientDriver.(*ftpClient)
+			if client.level < 0 || client.displayName == "" {
+				t.Errorf("Session character not recorded: level %d, name %q", client.level, client.displayName)
+			}
+
+			if log := accessLog(); !strings.Contains(log, tt.want) {
+				t.Errorf("Expected login line containing %q, got:\n%s", tt.want, log)
+			}
+		})
+	}
+}
+
+func TestSessionIDs(t *testing.T) {
+	hash, err := authentication.NewArgon2ID().Hash("mellon")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: hash, Level: 12})
+
+	s := newTestServer(t, nil)
+	s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+	s.authorizer = authorization.NewAuthorizer(authorization.NewMemoryAccessSource(map[string]interface{}{
+		"*": map[string]interface{}{"*": int(authorization.Read)},
+	}), users.NewMemorySource(), time.Minute)
+	driver := &ftpDriver{server: s}
+	sessionPattern := regexp.MustCompile(`session=(\S*)`)
+
+	// session runs one connection through login, a few operations and
+	// disconnect, returning the single session ID its log lines carry
+	session := func(id uint32) string {
+		accessLog := captureAccessLog(t)
+		cc := newMockClient(id, "10.0.0.1")
+		if _, err := driver.ClientConnected(cc); err != nil {
+			t.Fatalf("ClientConnected failed: %v", err)
+		}
+		if _, err := driver.AuthUser(cc, "frodo", "wrong"); err == nil {
+			t.Fatal("Expected AuthUser with a bad password to fail")
+		}
+		clientDriver, err := driver.AuthUser(cc, "frodo", "mellon")
+		if err != nil {
+			t.Fatalf("AuthUser failed: %v", err)
+		}
+		client := clientDriver.(*ftpClient)
+		if err := client.ChangeCwd("/"); err != nil {
+			t.Fatalf("ChangeCwd failed: %v", err)
+		}
+		if _, err := client.ReadDir("/"); err != nil {
+			t.Fatalf("ReadDir failed: %v", err)
+		}
+		driver.ClientDisconnected(cc)
+
+		lines := strings.Split(strings.TrimSpace(accessLog()), "\n")
+		if len(lines) != 6 {
+			t.Fatalf("Expected 6 log lines, got %d:\n%s", len(lines), strings.Join(lines, "\n"))
+		}
+		var id0 string
+		for i, line := range lines {
+			match := sessionPattern.FindStringSubmatch(line)
+			if match == nil || match[1] == "" {
+				t.Fatalf("Line has no session ID: %s", line)
+			}
+			if i == 0 {
+				id0 = match[1]
+			} else if match[1] != id0 {
+				t.Errorf("Session ID changed from %s to %s: %s", id0, match[1], line)
+			}
+		}
+		return id0
+	}
+
+	first, second := session(1), session(2)
+	if first == second {
+		t.Errorf("Expected separate sessions to have different IDs, both got %s", first)
+	}
+}
+
+func TestMaxConnectionsPerUser(t *testing.T) {
+	hash, err := authentication.NewArgon2ID().Hash("mellon")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: hash, Level: 12})
+	source.AddUser(&users.User{Username: "sam", PasswordHash: hash, Level: 12})
+
+	s := newTestServer(t, func(c *Config) { c.MaxConnectionsPerUser = 2 })
+	s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+	driver := &ftpDriver{server: s}
+	accessLog := captureAccessLog(t)
+
+	connect := func(id uint32) *mockClientContext {
+		cc := newMockClient(id, "10.0.0.1")
+		if _, err := driver.ClientConnected(cc); err != nil {
+			t.Fatalf("ClientConnected failed: %v", err)
+		}
+		return cc
+	}
+
+	first, second, third := connect(1), connect(2), connect(3)
+	for _, cc := range []*mockClientContext{first, second} {
+		if _, err := driver.AuthUser(cc, "frodo", "mellon"); err != nil {
+			t.Fatalf("AuthUser failed: %v", err)
+		}
+	}
+	if _, err := driver.AuthUser(third, "frodo", "mellon"); !errors.Is(err, errUserLimit) {
+		t.Fatalf("AuthUser over the limit error = %v, want %v", err, errUserLimit)
+	}
+
+	// Re-authenticating an existing session does not count twice, and the
+	// limit is per user
+	if _, err := driver.AuthUser(second, "frodo", "mellon"); err != nil {
+		t.Errorf("AuthUser on an existing session failed: %v", err)
+	}
+	if _, err := driver.AuthUser(connect(4), "sam", "mellon"); err != nil {
+		t.Errorf("AuthUser for another user failed: %v", err)
+	}
+
+	// A disconnect, however the session ended, releases its slot
+	driver.ClientDisconnected(first)
+	if _, err := driver.AuthUser(third, "frodo", "mellon"); err != nil {
+		t.Errorf("AuthUser after a disconnect failed: %v", err)
+	}
+	if got := s.GetConnectionsByUser()["frodo"]; got != 2 {
+		t.Errorf("frodo has %d connections, want 2", got)
+	}
+
+	if log := accessLog(); !strings.Contains(log, "user=frodo status=denied client_ip=10.0.0.1:40000 reason=user_limit") {
+		t.Errorf("Expected the refused login in the access log, got:\n%s", log)
+	}
+}
+
+func TestAllowedUsers(t *testing.T) {
+	hash, err := authentication.NewArgon2ID().Hash("mellon")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: hash, Level: users.WIZARD})
+	source.AddUser(&users.User{Username: "sam", PasswordHash: hash, Level: users.WIZARD})
+
+	s := newTestServer(t, func(c *Config) {
+		c.AllowedUsers = []string{"Frodo"}
+		c.AllowAnonymous = true
+	})
+	s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+	driver := &ftpDriver{server: s}
+	accessLog := captureAccessLog(t)
+
+	tests := []struct {
+		user    string
+		pass    string
+		wantErr error
+	}{
+		{"frodo", "mellon", nil},
+		{"sam", "mellon", errUserNotAllowed},
+		{"anonymous", "guest", nil},
+	}
+
+	for i, tt := range tests {
+		cc := newMockClient(uint32(i+1), "10.0.0.1")
+		if _, err := driver.ClientConnected(cc); err != nil {
+			t.Fatalf("ClientConnected failed: %v", err)
+		}
+		if _, err := driver.AuthUser(cc, tt.user, tt.pass); !errors.Is(err, tt.wantErr) {
+			t.Errorf("AuthUser(%q) error = %v, want %v", tt.user, err, tt.wantErr)
+		}
+	}
+
+	// The allowlist is only consulted once the credentials are good
+	if _, err := driver.AuthUser(newMockClient(9, "10.0.0.1"), "sam", "wrong"); err == nil || errors.Is(err, errUserNotAllowed) {
+		t.Errorf("AuthUser with a bad password error = %v, want an authentication failure", err)
+	}
+
+	if log := accessLog(); !strings.Contains(log, "user=sam status=denied client_ip=10.0.0.1:40000 reason=not_allowed") {
+		t.Errorf("Expected the refused login in the access log, got:\n%s", log)
+	}
+}
+
+func TestMinLoginLevel(t *testing.T) {
+	hash, err := authentication.NewArgon2ID().Hash("mellon")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: hash, Level: users.WIZARD})
+	source.AddUser(&users.User{Username: "pippin", PasswordHash: hash, Level: 12})
+
+	s := newTestServer(t, func(c *Config) { c.MinLoginLevel = users.WIZARD })
+	s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+	driver := &ftpDriver{server: s}
+	accessLog := captureAccessLog(t)
+
+	if _, err := driver.AuthUser(newMockClient(1, "10.0.0.1"), "frodo", "mellon"); err != nil {
+		t.Errorf("AuthUser for a wizard failed: %v", err)
+	}
+	if _, err := driver.AuthUser(newMockClient(2, "10.0.0.1"), "pippin", "mellon"); !errors.Is(err, errLevelTooLow) {
+		t.Errorf("AuthUser for a mortal error = %v, want %v", err, errLevelTooLow)
+	}
+
+	if log := accessLog(); !strings.Contains(log, "user=pippin status=denied client_ip=10.0.0.1:40000 reason=level level=12") {
+		t.Errorf("Expected the refused login in the access log, got:\n%s", log)
+	}
+}
+
+func TestReady(t *testing.T) {
+	s := newTestServer(t, nil)
+	source := authorization.NewMemoryAccessSource(map[string]interface{}{"*": map[string]interface{}{"*": int(authorization.Read)}})
+	s.authorizer = authorization.NewAuthorizer(source, users.NewMemorySource(), time.Minute)
+
+	if err := s.Ready(); err == nil {
+		t.Error("Expected not ready before the access trees load")
+	}
+	if err := s.authorizer.Warm(); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	if err := s.Ready(); err != nil {
+		t.Errorf("Expected ready, got %v", err)
+	}
+
+	if err := os.Remove(s.config.RootDir); err != nil {
+		t.Fatalf("Failed to remove root: %v", err)
+	}
+	if err := s.Ready(); err == nil {
+		t.Error("Expected not ready without a root directory")
+	}
+}
+
+func TestWelcomeMessage(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("Hostname unavailable: %v", err)
+	}
+	now := time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"Default", "", "Welcome to Viking FTP server (test)"},
+		{"Version", "VikingMUD {version}", "VikingMUD test"},
+		{"AllTokens", "{hostname} at {time} running {version}", hostname + " at Fri Mar 01 12:30:00 2024 running test"},
+		{"NoTokens", "Authorized use only", "Authorized use only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.WelcomeMessage = tt.template })
+			if got := s.welcomeMessage(now); got != tt.want {
+				t.Errorf("welcomeMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// serveFTP starts s on a free local port and returns a control connection to
+// it that has read the greeting
+func serveFTP(t *testing.T, s *Server) *textproto.Conn {
+	t.Helper()
+	if err := s.server.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go s.server.Serve()
+	t.Cleanup(func() { s.Stop() })
+
+	conn, err := textproto.Dial("tcp", s.server.Addr())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() {
+		// The server closes the connection once the session has logged its
+		// end, so nothing is left logging into the next test
+		_, _ = conn.Cmd("QUIT")
+		_, _ = io.Copy(io.Discard, conn.R)
+		conn.Close()
+	})
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("Greeting: %v", err)
+	}
+	return conn
+}
+
+// ftpCommand sends a command and returns the reply, which must have code want
+func ftpCommand(t *testing.T, conn *textproto.Conn, want int, format string, args ...interface{}) string {
+	t.Helper()
+	if err := conn.PrintfLine(format, args...); err != nil {
+		t.Fatalf("Sending %q failed: %v", format, err)
+	}
+	_, msg, err := conn.ReadResponse(want)
+	if err != nil {
+		t.Fatalf("%s: %v", fmt.Sprintf(format, args...), err)
+	}
+	return msg
+}
+
+// ftpRetrieve downloads name over an extended passive data connection
+func ftpRetrieve(t *testing.T, conn *textproto.Conn, name string) string {
+	t.Helper()
+	reply := ftpCommand(t, conn, 229, "EPSV")
+	var port int
+	if _, err := fmt.Sscanf(reply[strings.Index(reply, "(|||"):], "(|||%d|)", &port); err != nil {
+		t.Fatalf("Parsing EPSV reply %q: %v", reply, err)
+	}
+	data, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Data connection failed: %v", err)
+	}
+	defer data.Close()
+
+	ftpCommand(t, conn, 150, "RETR %s", name)
+	content, err := io.ReadAll(data)
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", name, err)
+	}
+	if _, _, err := conn.ReadResponse(226); err != nil {
+		t.Fatalf("RETR %s: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestTildeIsLiteral(t *testing.T) {
+	hash, err := authentication.NewArgon2ID().Hash("mellon")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	source := users.NewMemorySource()
+	source.AddUser(&users.User{Username: "frodo", PasswordHash: hash, Level: 12})
+
+	s := newTestServer(t, func(c *Config) {
+		c.Port = 0
+		c.HomePattern = "players/%s"
+	})
+	s.authorizer = newTestAuthorizer()
+	s.authenticator = authentication.NewAuthenticator(source, authentication.NewVerifier())
+	for dir, content := range map[string]string{
+		"players/frodo":   "home notes",
+		"players/frodo/~": "tilde notes",
+	} {
+		if err := os.MkdirAll(filepath.Join(s.config.RootDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(s.config.RootDir, dir, "notes.txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write notes: %v", err)
+		}
+	}
+
+	conn := serveFTP(t, s)
+	ftpCommand(t, conn, 331, "USER frodo")
+	ftpCommand(t, conn, 230, "PASS mellon")
+
+	// ftpserverlib joins ~ onto the working directory before the driver
+	// sees it, so it names the directory called ~ rather than the home
+	if got := ftpRetrieve(t, conn, "~/notes.txt"); got != "tilde notes" {
+		t.Errorf("RETR ~/notes.txt = %q, want %q", got, "tilde notes")
+	}
+	ftpCommand(t, conn, 250, "CWD ~")
+	if got := ftpCommand(t, conn, 257, "PWD"); !strings.Contains(got, `"/players/frodo/~"`) {
+		t.Errorf("PWD after CWD ~ = %q, want /players/frodo/~", got)
+	}
+	ftpCommand(t, conn, 550, "CWD ~/missing")
+}
+
+func TestResolvePathValidation(t *testing.T) {
+	s := newTestServer(t, func(c *Config) { c.MaxPathLength = 64 })
+	client := newTestClient(s, "frodo")
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"AtLimit", "/" + strings.Repeat("a", 63), nil},
+		{"OverLength", "/" + strings.Repeat("a", 64), errPathTooLong},
+		{"NUL", "/pub/ring.txt\x00.jpg", errPathControlChars},
+		{"Newline", "/pub/ring.txt\nop=remove", errPathControlChars},
+		{"Unicode", "/pub/Barad-dûr.txt", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := client.resolvePath(tt.path); !errors.Is(err, tt.wantErr) {
+				t.Errorf("resolvePath error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Operations fail before touching the filesystem
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "ring.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := client.Stat("/ring.txt\x00"); !errors.Is(err, errPathControlChars) {
+		t.Errorf("Stat error = %v, want %v", err, errPathControlChars)
+	}
+}
+
+func TestCreateModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileMode os.FileMode
+		dirMode  os.FileMode
+		wantFile os.FileMode
+		wantDir  os.FileMode
+	}{
+		{"Configured", 0640, 0750, 0640, 0750},
+		{"Defaults", 0, 0, 0666, 0755},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Modes are requested before the umask; assume the common 022
+			umask := os.FileMode(0022)
+			s := newTestServer(t, func(c *Config) {
+				c.FileMode = tt.fileMode
+				c.DirMode = tt.dirMode
+			})
+			s.authorizer = newTestAuthorizer()
+			client := newTestClient(s, "frodo")
+			if err := os.MkdirAll(filepath.Join(s.config.RootDir, "players", "frodo"), 0755); err != nil {
+				t.Fatalf("Failed to create home: %v", err)
+			}
+
+			check := func(path string, want os.FileMode) {
+				t.Helper()
+				info, err := os.Stat(filepath.Join(s.config.RootDir, filepath.FromSlash(path)))
+				if err != nil {
+					t.Fatalf("Stat(%s) failed: %v", path, err)
+				}
+				if got := info.Mode().Perm(); got != want&^umask {
+					t.Errorf("%s mode = %o, want %o", path, got, want&^umask)
+				}
+			}
+
+			file, err := client.Create("/players/frodo/created.txt")
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			file.Close()
+			check("/players/frodo/created.txt", tt.wantFile)
+
+			file, err = client.OpenFile("/players/frodo/opened.txt", os.O_WRONLY|os.O_CREATE, 0600)
+			if err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			file.Close()
+			if tt.fileMode != 0 {
+				check("/players/frodo/opened.txt", tt.wantFile)
+			} else {
+				check("/players/frodo/opened.txt", 0600)
+			}
+
+			if err := client.MakeDirectory("/players/frodo/made"); err != nil {
+				t.Fatalf("MakeDirectory failed: %v", err)
+			}
+			check("/players/frodo/made", tt.wantDir)
+
+			if err := client.Mkdir("/players/frodo/mkdir", 0755); err != nil {
+				t.Fatalf("Mkdir failed: %v", err)
+			}
+			check("/players/frodo/mkdir", tt.wantDir)
+
+			if err := client.MkdirAll("/players/frodo/deep/er", 0755); err != nil {
+				t.Fatalf("MkdirAll failed: %v", err)
+			}
+			check("/players/frodo/deep/er", tt.wantDir)
+		})
+	}
+}
+
+func TestMkdirRelativeToCwd(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+	home := filepath.Join(s.config.RootDir, "players", "frodo")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+	client.cc.SetPath("/players/frodo")
+
+	if err := client.MakeDirectory("made"); err != nil {
+		t.Fatalf("MakeDirectory failed: %v", err)
+	}
+	if err := client.Mkdir("mkdir", 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	for _, name := range []string{"made", "mkdir"} {
+		if info, err := os.Stat(filepath.Join(home, name)); err != nil || !info.IsDir() {
+			t.Errorf("Expected %s under the cwd: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(s.config.RootDir, name)); err == nil {
+			t.Errorf("Expected %s not to be created at the root", name)
+		}
+	}
+
+	// At the root, where frodo may only read, the same names are refused
+	client.cc.SetPath("/")
+	if err := client.MakeDirectory("made"); err == nil {
+		t.Error("Expected MakeDirectory at the root to be denied")
+	}
+}
+
+func TestChtimesRelativeToCwd(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+	home := filepath.Join(s.config.RootDir, "players", "frodo")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+	for _, path := range []string{filepath.Join(home, "notes.txt"), filepath.Join(s.config.RootDir, "notes.txt")} {
+		if err := os.WriteFile(path, []byte("notes"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	// frodo may write their home but only read the root, so the check
+	// passes only if the relative name is resolved against the cwd
+	client.cc.SetPath("/players/frodo")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := client.Chtimes("notes.txt", mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(home, "notes.txt"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), mtime)
+	}
+	if info, err := os.Stat(filepath.Join(s.config.RootDir, "notes.txt")); err != nil || info.ModTime().Equal(mtime) {
+		t.Errorf("Expected the root's notes.txt to be untouched: %v", err)
+	}
+
+	client.cc.SetPath("/")
+	if err := client.Chtimes("notes.txt", mtime, mtime); err == nil {
+		t.Error("Expected Chtimes at the root to be denied")
+	}
+}
+
+func TestDefaultTransferType(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    ftpserverlib.TransferType
+		wantErr bool
+	}{
+		{"DefaultASCII", "", ftpserverlib.TransferTypeASCII, false},
+		{"Binary", "binary", ftpserverlib.TransferTypeBinary, false},
+		{"ASCII", "ASCII", ftpserverlib.TransferTypeASCII, false},
+		{"Unsupported", "ebcdic", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{RootDir: t.TempDir(), DefaultTransferType: tt.config}
+			s, err := New(config, nil, nil, "test")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected New to reject the transfer type")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			settings, err := (&ftpDriver{server: s}).GetSettings()
+			if err != nil {
+				t.Fatalf("GetSettings failed: %v", err)
+			}
+			if settings.DefaultTransferType != tt.want {
+				t.Errorf("DefaultTransferType = %v, want %v", settings.DefaultTransferType, tt.want)
+			}
+		})
+	}
+}
+
+// statCountingFs counts Stat calls on the files it opens
+type statCountingFs struct {
+	afero.Fs
+	stats int
+}
+
+func (fs *statCountingFs) Open(name string) (afero.File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &statCountingFile{File: f, fs: fs}, nil
+}
+
+type statCountingFile struct {
+	afero.File
+	fs *statCountingFs
+}
+
+func (f *statCountingFile) Stat() (os.FileInfo, error) {
+	f.fs.stats++
+	return f.File.Stat()
+}
+
+func TestLogTransferSizes(t *testing.T) {
+	tests := []struct {
+		name      string
+		logSizes  bool
+		wantStats int
+		wantLog   string
+	}{
+		{"Enabled", true, 1, "path=/poem.txt status=success size=28"},
+		{"Disabled", false, 0, "path=/poem.txt status=success client_ip=10.0.0.1:40000 session="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.LogTransferSizes = tt.logSizes })
+			s.authorizer = newTestAuthorizer()
+			if err := os.WriteFile(filepath.Join(s.config.RootDir, "poem.txt"), []byte("The Road goes ever on and on"), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			client := newTestClient(s, "frodo")
+			fs := &statCountingFs{Fs: client.fs}
+			client.fs = fs
+			accessLog := captureAccessLog(t)
+
+			f, err := client.Open("/poem.txt")
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			f.Close()
+
+			if fs.stats != tt.wantStats {
+				t.Errorf("Open made %d stats, want %d", fs.stats, tt.wantStats)
+			}
+			if log := accessLog(); !strings.Contains(log, tt.wantLog) {
+				t.Errorf("Expected open line containing %q, got:\n%s", tt.wantLog, log)
+			}
+		})
+	}
+}
+
+func TestAccessLogClientIP(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	if err := os.WriteFile(filepath.Join(s.config.RootDir, "poem.txt"), []byte("The Road goes ever on and on"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	client := newTestClient(s, "frodo")
+	accessLog := captureAccessLog(t)
+
+	if _, err := client.ReadDir("/"); err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	f, err := client.Open("/poem.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	f.Close()
+	// Refused operations carry the address too
+	if err := client.Mkdir("/dir", 0755); !os.IsPermission(err) {
+		t.Fatalf("Mkdir error = %v, want permission denied", err)
+	}
+	if err := client.Rename("/poem.txt", "/song.txt"); !os.IsPermission(err) {
+		t.Fatalf("Rename error = %v, want permission denied", err)
+	}
+
+	log := strings.TrimSpace(accessLog())
+	lines := strings.Split(log, "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 access log lines, got:\n%s", log)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, " client_ip=10.0.0.1:40000 session=") {
+			t.Errorf("Expected client_ip in access log line %q", line)
+		}
+	}
+}
+
+// BenchmarkOpen reports the file stats each Open makes with and without
+// LogTransferSizes
+func BenchmarkOpen(b *testing.B) {
+	for _, logSizes := range []bool{true, false} {
+		b.Run(fmt.Sprintf("LogTransferSizes=%v", logSizes), func(b *testing.B) {
+			root := b.TempDir()
+			if err := os.WriteFile(filepath.Join(root, "poem.txt"), []byte("The Road goes ever on and on"), 0644); err != nil {
+				b.Fatalf("Failed to write file: %v", err)
+			}
+			s, err := New(&Config{RootDir: root, LogTransferSizes: logSizes}, nil, nil, "test")
+			if err != nil {
+				b.Fatalf("New failed: %v", err)
+			}
+			s.authorizer = newTestAuthorizer()
+			client := newTestClient(s, "frodo")
+			fs := &statCountingFs{Fs: client.fs}
+			client.fs = fs
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f, err := client.Open("/poem.txt")
+				if err != nil {
+					b.Fatalf("Open failed: %v", err)
+				}
+				f.Close()
+			}
+			b.ReportMetric(float64(fs.stats)/float64(b.N), "stats/op")
+		})
+	}
+}
+
+// Names are passed through byte for byte, so UTF-8 names survive a round trip
+// through upload, listing and download
+func TestUTF8Filenames(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+	if err := os.MkdirAll(filepath.Join(s.config.RootDir, "players", "frodo"), 0755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+
+	const name = "Ëowyn-Nazgûl-指輪.txt"
+	content := []byte("I am no man")
+	ftpPath := "/players/frodo/" + name
+
+	client.cc.(*mockClientContext).lastCommand = "STOR"
+	f, err := client.Create(ftpPath)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	f.Close()
+
+	client.cc.(*mockClientContext).lastCommand = "LIST"
+	entries, err := client.ReadDir("/players/frodo")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != name {
+		t.Fatalf("Expected a single entry %q, got %v", name, entries)
+	}
+
+	client.cc.(*mockClientContext).lastCommand = "RETR"
+	f, err = client.Open(ftpPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	got := make([]byte, 64)
+	n, _ := f.Read(got)
+	if string(got[:n]) != string(content) {
+		t.Errorf("Read %q, want %q", got[:n], content)
+	}
+}
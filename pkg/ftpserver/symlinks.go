@@ -0,0 +1,145 @@
+package ftpserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// SymlinkPolicy controls how paths that pass through symlinks are authorized
+type SymlinkPolicy string
+
+const (
+	// SymlinkAuthorize checks permissions on both the requested path and the
+	// path its symlinks resolve to, and refuses targets outside the root (default)
+	SymlinkAuthorize SymlinkPolicy = "authorize"
+	// SymlinkRefuse refuses any path that passes through a symlink
+	SymlinkRefuse SymlinkPolicy = "refuse"
+	// SymlinkFollow follows symlinks and only checks the requested path
+	SymlinkFollow SymlinkPolicy = "follow"
+)
+
+// ParseSymlinkPolicy converts a policy name into a SymlinkPolicy. An empty
+// name selects SymlinkAuthorize.
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	switch SymlinkPolicy(name) {
+	case "", SymlinkAuthorize:
+		return SymlinkAuthorize, nil
+	case SymlinkRefuse:
+		return SymlinkRefuse, nil
+	case SymlinkFollow:
+		return SymlinkFollow, nil
+	default:
+		return "", fmt.Errorf("unknown symlink policy %q (expected %q, %q or %q)", name, SymlinkAuthorize, SymlinkRefuse, SymlinkFollow)
+	}
+}
+
+var errSymlinkEscape = errors.New("symlink target is outside the FTP root")
+
+// canRead reports whether the user may read path under the symlink policy
+func (c *ftpClient) canRead(path string) bool {
+	return c.authorize(path, true, c.recorded(false, c.server.authorizer.CanRead))
+}
+
+// canWrite reports whether the user may write path under the symlink policy.
+// Paths in ProtectedPaths are never writable.
+func (c *ftpClient) canWrite(path string) bool {
+	if c.readOnly || c.isProtected(path, true) {
+		return false
+	}
+	return c.authorize(path, true, c.recorded(true, c.server.authorizer.CanWrite))
+}
+
+// canWriteEntry is canWrite for operations on a directory entry itself, such
+// as delete and rename, where a final symlink is acted on rather than followed
+func (c *ftpClient) canWriteEntry(path string) bool {
+	if c.readOnly || c.isProtected(path, false) {
+		return false
+	}
+	return c.authorize(path, false, c.recorded(true, c.server.authorizer.CanWrite))
+}
+
+// authorize applies check to ftpPath and, depending on the symlink policy, to
+// the path it resolves to
+func (c *ftpClient) authorize(ftpPath string, followLast bool, check func(username, path string) bool) bool {
+	if !check(c.user, ftpPath) {
+		return false
+	}
+
+	policy := c.server.symlinkPolicy
+	if policy == SymlinkFollow {
+		return true
+	}
+
+	target, err := c.symlinkTarget(ftpPath, followLast)
+	if err != nil {
+		logging.App.Debug("Symlink resolution refused", "user", c.user, "path", ftpPath, "error", err)
+		return false
+	}
+	if target == path.Clean("/"+filepath.ToSlash(c.server.aliasPath(ftpPath))) {
+		return true
+	}
+
+	if policy == SymlinkRefuse {
+		logging.App.Debug("Refused path through symlink", "user", c.user, "path", ftpPath, "target", target)
+		return false
+	}
+	return check(c.user, target)
+}
+
+// symlinkTarget resolves symlinks in an FTP path and returns the resulting FTP
+// path. Components that do not exist yet are kept as given. When followLast is
+// false a symlink in the final component is not resolved. A path under one of
+// PathAliases resolves to its alias target even without symlinks.
+func (c *ftpClient) symlinkTarget(ftpPath string, followLast bool) (string, error) {
+	root := c.server.realRoot
+	full := filepath.Join(root, filepath.FromSlash(c.server.aliasPath(ftpPath)))
+
+	var real string
+	var err error
+	if followLast {
+		real, err = evalExistingSymlinks(full)
+	} else {
+		real, err = evalExistingSymlinks(filepath.Dir(full))
+		real = filepath.Join(real, filepath.Base(full))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, real)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errSymlinkEscape
+	}
+	return path.Clean("/" + filepath.ToSlash(rel)), nil
+}
+
+// evalExistingSymlinks is filepath.EvalSymlinks for paths whose trailing
+// components may not exist yet, such as files about to be created
+func evalExistingSymlinks(p string) (string, error) {
+	real, err := filepath.EvalSymlinks(p)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	parent := filepath.Dir(p)
+	if parent == p {
+		return p, nil
+	}
+	realParent, err := evalExistingSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(realParent, filepath.Base(p)), nil
+}
@@ -0,0 +1,109 @@
+package ftpserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupSymlinkTree creates readable /pub and denied /secret directories with
+// symlinks to each from /pub/links, plus one escaping the root entirely
+func setupSymlinkTree(t *testing.T, root string) {
+	t.Helper()
+
+	outside := t.TempDir()
+	for _, dir := range []string{"pub/links", "pub/docs", "secret"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, file := range []string{"pub/docs/readme.txt", "secret/plans.txt", filepath.Join(outside, "passwd")} {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(root, file)
+		}
+		if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+
+	links := map[string]string{
+		"pub/links/docs":    "../docs",
+		"pub/links/secret":  "../../secret",
+		"pub/links/outside": outside,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("Symlinks unsupported: %v", err)
+		}
+	}
+}
+
+func TestSymlinkPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SymlinkPolicy
+		path   string
+		want   bool
+	}{
+		{"AuthorizePlainPath", SymlinkAuthorize, "/pub/docs/readme.txt", true},
+		{"AuthorizeLinkToAllowed", SymlinkAuthorize, "/pub/links/docs/readme.txt", true},
+		{"AuthorizeLinkToDenied", SymlinkAuthorize, "/pub/links/secret/plans.txt", false},
+		{"AuthorizeLinkOutsideRoot", SymlinkAuthorize, "/pub/links/outside/passwd", false},
+		{"AuthorizeNewFileUnderLink", SymlinkAuthorize, "/pub/links/secret/new.txt", false},
+		{"RefuseLinkToAllowed", SymlinkRefuse, "/pub/links/docs/readme.txt", false},
+		{"RefusePlainPath", SymlinkRefuse, "/pub/docs/readme.txt", true},
+		{"FollowLinkToDenied", SymlinkFollow, "/pub/links/secret/plans.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.SymlinkPolicy = tt.policy })
+			s.authorizer = newTestAuthorizer()
+			setupSymlinkTree(t, s.config.RootDir)
+			client := newTestClient(s, "frodo")
+
+			if got := client.canRead(tt.path); got != tt.want {
+				t.Errorf("canRead(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+
+			// Open must agree with the permission check
+			f, err := client.Open(tt.path)
+			if err == nil {
+				f.Close()
+			}
+			if tt.want && err != nil && !os.IsNotExist(err) {
+				t.Errorf("Open(%q) unexpected error: %v", tt.path, err)
+			}
+			if !tt.want && !os.IsPermission(err) {
+				t.Errorf("Open(%q) error = %v, want permission denied", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestSymlinkEntryNotFollowed(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	setupSymlinkTree(t, s.config.RootDir)
+	client := newTestClient(s, "frodo")
+
+	// The link itself lives in a readable area even though its target doesn't
+	if !client.authorize("/pub/links/secret", false, s.authorizer.CanRead) {
+		t.Error("Expected the link entry itself to be authorized")
+	}
+	if client.canRead("/pub/links/secret") {
+		t.Error("Expected following the link to a denied target to be refused")
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for name, want := range map[string]SymlinkPolicy{"": SymlinkAuthorize, "authorize": SymlinkAuthorize, "refuse": SymlinkRefuse, "follow": SymlinkFollow} {
+		got, err := ParseSymlinkPolicy(name)
+		if err != nil || got != want {
+			t.Errorf("ParseSymlinkPolicy(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("sometimes"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
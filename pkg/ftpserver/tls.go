@@ -0,0 +1,79 @@
+package ftpserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+)
+
+var errTLSRequired = errors.New("TLS is required, use AUTH TLS")
+
+// tlsVersions maps the names accepted for Config.TLSMinVersion to versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion converts a minimum TLS version name ("1.2" or "1.3") into
+// a crypto/tls version. An empty name selects TLS 1.2.
+func ParseTLSVersion(name string) (uint16, error) {
+	if name == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(name), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (expected \"1.2\" or \"1.3\")", name)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites converts cipher suite names, as listed by
+// tls.CipherSuites, into IDs. Suites Go considers insecure are refused, as
+// are TLS 1.3 suites, which Go does not allow to be configured. An empty
+// list yields nil, leaving the choice to crypto/tls.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]*tls.CipherSuite)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+		}
+		if !supportsTLS12(suite) {
+			return nil, fmt.Errorf("TLS cipher suite %q is TLS 1.3 only; TLS 1.3 suites cannot be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
+
+// PreAuthUser refuses USER on a plaintext control connection when
+// RequireTLSControl is set. ftpserverlib replies 530 and disconnects.
+// Interface: ftpserverlib.MainDriverExtensionUserVerifier
+func (d *ftpDriver) PreAuthUser(cc ftpserverlib.ClientContext, user string) error {
+	if d.server.config.RequireTLSControl && !cc.HasTLSForControl() {
+		d.logLoginRefused(cc, user, "denied", "reason", "tls_required")
+		return errTLSRequired
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package ftpserver
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+)
+
+func TestGetTLSConfigVersionAndSuites(t *testing.T) {
+	_, certFile, keyFile := newTestCA(t).writeServerFiles(t, t.TempDir())
+
+	tests := []struct {
+		name        string
+		minVersion  string
+		suites      []string
+		wantVersion uint16
+		wantSuites  []uint16
+	}{
+		{"Default", "", nil, tls.VersionTLS12, nil},
+		{"TLS12", "1.2", nil, tls.VersionTLS12, nil},
+		{"TLS13", "1.3", nil, tls.VersionTLS13, nil},
+		{"TLS13Prefixed", "TLS1.3", nil, tls.VersionTLS13, nil},
+		{"Suites", "1.2", []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, tls.VersionTLS12,
+			[]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+				c.TLSMinVersion = tt.minVersion
+				c.TLSCipherSuites = tt.suites
+			})
+
+			config, err := (&ftpDriver{server: s}).GetTLSConfig()
+			if err != nil {
+				t.Fatalf("GetTLSConfig failed: %v", err)
+			}
+			if config.MinVersion != tt.wantVersion {
+				t.Errorf("MinVersion = %x, want %x", config.MinVersion, tt.wantVersion)
+			}
+			if !reflect.DeepEqual(config.CipherSuites, tt.wantSuites) {
+				t.Errorf("CipherSuites = %v, want %v", config.CipherSuites, tt.wantSuites)
+			}
+		})
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{"UnknownVersion", func(c *Config) { c.TLSMinVersion = "1.1" }},
+		{"UnknownSuite", func(c *Config) { c.TLSCipherSuites = []string{"TLS_MADE_UP"} }},
+		{"InsecureSuite", func(c *Config) { c.TLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }},
+		{"TLS13Suite", func(c *Config) { c.TLSCipherSuites = []string{"TLS_AES_128_GCM_SHA256"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{RootDir: t.TempDir()}
+			tt.modify(config)
+			if _, err := New(config, nil, nil, "test"); err == nil {
+				t.Error("Expected New to fail")
+			}
+		})
+	}
+}
+
+func TestImplicitTLSListener(t *testing.T) {
+	_, certFile, keyFile := newTestCA(t).writeServerFiles(t, t.TempDir())
+	s := newTestServer(t, func(c *Config) {
+		c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+		c.ImplicitTLSPort = 990
+	})
+	if s.implicitServer == nil {
+		t.Fatal("Expected an implicit TLS listener")
+	}
+
+	tests := []struct {
+		name     string
+		driver   *ftpDriver
+		wantAddr string
+		wantTLS  ftpserverlib.TLSRequirement
+	}{
+		// Explicit FTPS stays the default on the main port
+		{"Main", &ftpDriver{server: s}, "127.0.0.1:2121", ftpserverlib.ClearOrEncrypted},
+		// ImplicitEncryption makes ftpserverlib wrap the listener in TLS, so
+		// the handshake happens before the welcome banner
+		{"Implicit", &ftpDriver{server: s, implicitTLS: true}, "127.0.0.1:990", ftpserverlib.ImplicitEncryption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, err := tt.driver.GetSettings()
+			if err != nil {
+				t.Fatalf("GetSettings failed: %v", err)
+			}
+			if settings.ListenAddr != tt.wantAddr {
+				t.Errorf("ListenAddr = %s, want %s", settings.ListenAddr, tt.wantAddr)
+			}
+			if settings.TLSRequired != tt.wantTLS {
+				t.Errorf("TLSRequired = %v, want %v", settings.TLSRequired, tt.wantTLS)
+			}
+		})
+	}
+
+	// No implicit listener unless a port is configured
+	if newTestServer(t, nil).implicitServer != nil {
+		t.Error("Expected no implicit TLS listener by default")
+	}
+	// Implicit FTPS needs a certificate
+	if _, err := New(&Config{RootDir: t.TempDir(), ImplicitTLSPort: 990}, nil, nil, "test"); err == nil {
+		t.Error("Expected New to fail without a TLS certificate")
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	_, certFile, keyFile := newTestCA(t).writeServerFiles(t, t.TempDir())
+
+	tests := []struct {
+		name         string
+		control      bool
+		data         bool
+		tlsControl   bool
+		wantUserOK   bool
+		wantRequired ftpserverlib.TLSRequirement
+	}{
+		{"Permissive", false, false, false, true, ftpserverlib.ClearOrEncrypted},
+		{"ControlPlaintext", true, false, false, false, ftpserverlib.ClearOrEncrypted},
+		{"ControlTLS", true, false, true, true, ftpserverlib.ClearOrEncrypted},
+		// Plaintext transfers are refused by ftpserverlib before the
+		// transfer connection is opened
+		{"DataPlaintext", false, true, false, true, ftpserverlib.MandatoryEncryption},
+		{"Both", true, true, true, true, ftpserverlib.MandatoryEncryption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+				c.RequireTLSControl = tt.control
+				c.RequireTLSData = tt.data
+				c.AllowAnonymous = true
+			})
+			driver := &ftpDriver{server: s}
+			cc := newMockClient(1, "10.0.0.1")
+			cc.tlsControl = tt.tlsControl
+
+			err := driver.PreAuthUser(cc, "anonymous")
+			if (err == nil) != tt.wantUserOK {
+				t.Fatalf("PreAuthUser error = %v, want ok %v", err, tt.wantUserOK)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err := driver.AuthUser(cc, "anonymous", "me@example.com"); err != nil {
+				t.Fatalf("AuthUser failed: %v", err)
+			}
+			if cc.tlsRequired != tt.wantRequired {
+				t.Errorf("Transfer TLS requirement = %v, want %v", cc.tlsRequired, tt.wantRequired)
+			}
+		})
+	}
+
+	// Requiring TLS needs a certificate
+	if _, err := New(&Config{RootDir: t.TempDir(), RequireTLSData: true}, nil, nil, "test"); err == nil {
+		t.Error("Expected New to fail without a TLS certificate")
+	}
+}
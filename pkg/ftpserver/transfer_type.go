@@ -0,0 +1,27 @@
+package ftpserver
+
+import (
+	"fmt"
+	"strings"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+)
+
+// ParseTransferType converts the name of the transfer type used before a
+// client sends TYPE ("binary" or "ascii") into an ftpserverlib transfer
+// type. An empty name selects ASCII, the default in RFC 959.
+//
+// TYPE itself is handled by ftpserverlib: TYPE I and TYPE L 8 select binary,
+// TYPE A selects ASCII, with line endings translated on upload and download,
+// and other types are refused with 504. SIZE and REST are refused in ASCII
+// mode, since the translated size is not known in advance.
+func ParseTransferType(name string) (ftpserverlib.TransferType, error) {
+	switch strings.ToLower(name) {
+	case "binary":
+		return ftpserverlib.TransferTypeBinary, nil
+	case "", "ascii":
+		return ftpserverlib.TransferTypeASCII, nil
+	default:
+		return 0, fmt.Errorf("unknown transfer type %q (expected \"binary\" or \"ascii\")", name)
+	}
+}
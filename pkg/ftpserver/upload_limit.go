@@ -0,0 +1,113 @@
+package ftpserver
+
+import (
+	"fmt"
+	"os"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/spf13/afero"
+)
+
+// errUploadTooLarge is returned by writes that would take a file past
+// MaxUploadBytes. ftpserverlib answers ErrStorageExceeded with 552.
+var errUploadTooLarge = fmt.Errorf("upload size limit exceeded: %w", ftpserverlib.ErrStorageExceeded)
+
+// limitedFile refuses writes that would make the file larger than limit
+// bytes. The first refused write cuts the file back to the size it had when
+// opened, and if that was empty the file is removed on Close, so an
+// oversized upload leaves nothing behind.
+type limitedFile struct {
+	afero.File
+	client   *ftpClient
+	op       logging.Operation
+	path     string // FTP path, for errors, logs and removal
+	limit    int64
+	initial  int64 // Size when opened
+	offset   int64 // Where the next Write lands
+	exceeded bool
+}
+
+// limitUpload wraps a file opened for writing with flag in a limitedFile if
+// MaxUploadBytes is set
+func (c *ftpClient) limitUpload(op logging.Operation, path string, file afero.File, flag int) (afero.File, error) {
+	limit := c.server.config.MaxUploadBytes
+	if limit <= 0 {
+		return file, nil
+	}
+
+	limited := &limitedFile{File: file, client: c, op: op, path: path, limit: limit}
+	if flag&os.O_TRUNC == 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fsError("open", path, err)
+		}
+		limited.initial = info.Size()
+	}
+	if flag&os.O_APPEND != 0 {
+		limited.offset = limited.initial
+	}
+	return limited, nil
+}
+
+// Write implements io.Writer
+func (f *limitedFile) Write(p []byte) (int, error) {
+	if err := f.reserve(f.offset, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := f.File.Write(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt
+func (f *limitedFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.reserve(off, len(p)); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// WriteString implements io.StringWriter
+func (f *limitedFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Seek implements io.Seeker, tracking the offset of the next Write
+func (f *limitedFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil {
+		f.offset = pos
+	}
+	return pos, err
+}
+
+// reserve checks that n bytes written at off stay within the limit. The
+// first write that does not is logged and the file is cut back.
+func (f *limitedFile) reserve(off int64, n int) error {
+	if f.exceeded {
+		return &os.PathError{Op: "write", Path: f.path, Err: errUploadTooLarge}
+	}
+	if off+int64(n) <= f.limit {
+		return nil
+	}
+
+	f.exceeded = true
+	f.client.logAccess(f.op, f.path, "denied", "reason", "size_limit", "limit", f.limit)
+	if err := f.File.Truncate(f.initial); err != nil {
+		logging.App.Warn("Failed to truncate oversized upload", "user", f.client.user, "path", f.path, "error", err)
+	}
+	return &os.PathError{Op: "write", Path: f.path, Err: errUploadTooLarge}
+}
+
+// Close implements io.Closer, removing the file if an upload that started
+// from an empty file went over the limit
+func (f *limitedFile) Close() error {
+	err := f.File.Close()
+	if f.exceeded && f.initial == 0 {
+		if removeErr := f.client.fs.Remove(f.path); removeErr != nil {
+			logging.App.Warn("Failed to remove oversized upload", "user", f.client.user, "path", f.path, "error", removeErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package ftpserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ftpserverlib "github.com/fclairamb/ftpserverlib"
+)
+
+func TestMaxUploadBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastCommand string
+		flag        int
+		existing    string // Content before the upload, "" for no file
+		writes      []string
+		wantErr     bool
+		wantContent string // "" when the file should be gone
+	}{
+		{"UnderLimit", "STOR", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, "", []string{"one ring ", "to rule"}, false, "one ring to rule"},
+		{"AtLimit", "STOR", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, "", []string{"0123456789abcdef"}, false, "0123456789abcdef"},
+		{"OverLimit", "STOR", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, "", []string{"one ring ", "to rule them"}, true, ""},
+		{"OverwriteOverLimit", "STOR", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, "old", []string{"one ring to rule them all"}, true, ""},
+		{"AppendUnderLimit", "APPE", os.O_WRONLY | os.O_CREATE | os.O_APPEND, "existing ", []string{"log"}, false, "existing log"},
+		{"AppendOverLimit", "APPE", os.O_WRONLY | os.O_CREATE | os.O_APPEND, "existing ", []string{"appended"}, true, "existing "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.MaxUploadBytes = 16 })
+			s.authorizer = newTestAuthorizer()
+			client := newTestClient(s, "frodo")
+			client.cc.(*mockClientContext).lastCommand = tt.lastCommand
+			accessLog := captureAccessLog(t)
+
+			path := filepath.Join(s.config.RootDir, "players", "frodo", "upload.txt")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("Failed to create home: %v", err)
+			}
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatalf("Failed to write file: %v", err)
+				}
+			}
+
+			f, err := client.OpenFile("/players/frodo/upload.txt", tt.flag, 0644)
+			if err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			var writeErr error
+			for _, w := range tt.writes {
+				if _, writeErr = f.Write([]byte(w)); writeErr != nil {
+					break
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+
+			if !tt.wantErr {
+				if writeErr != nil {
+					t.Errorf("Write failed: %v", writeErr)
+				}
+			} else {
+				// ftpserverlib answers ErrStorageExceeded with 552
+				if !errors.Is(writeErr, ftpserverlib.ErrStorageExceeded) {
+					t.Errorf("Write error = %v, want ErrStorageExceeded", writeErr)
+				}
+				if log := accessLog(); !strings.Contains(log, "path=/players/frodo/upload.txt status=denied reason=size_limit limit=16") {
+					t.Errorf("Expected the refused upload in the access log, got:\n%s", log)
+				}
+			}
+
+			content, err := os.ReadFile(path)
+			if tt.wantContent == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Expected the oversized upload to be removed, got %q, %v", content, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.wantContent {
+				t.Errorf("File content = %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestMaxUploadBytesUnlimited(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.authorizer = newTestAuthorizer()
+	client := newTestClient(s, "frodo")
+	if err := os.MkdirAll(filepath.Join(s.config.RootDir, "players", "frodo"), 0755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+
+	f, err := client.Create("/players/frodo/big.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(make([]byte, 1<<20)); err != nil {
+		t.Errorf("Write without a limit failed: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package health serves liveness and readiness probes for load balancers.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// ReadyFunc reports why the server cannot take logins yet, or nil if it can
+type ReadyFunc func() error
+
+// Server serves /healthz and /readyz over HTTP
+type Server struct {
+	addr     string
+	ready    ReadyFunc
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewServer creates a health server listening on addr. /healthz succeeds
+// while the process is serving; /readyz succeeds only while ready returns
+// nil.
+func NewServer(addr string, ready ReadyFunc) *Server {
+	s := &Server{
+		addr:  addr,
+		ready: ready,
+	}
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Handler returns the handler for both probes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	return mux
+}
+
+// Start binds the listen address and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.addr, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.App.Error("Health server error", "error", err)
+		}
+	}()
+
+	logging.App.Info("Started health server", "addr", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the address the server is listening on, or the configured
+// address if it has not been started
+func (s *Server) Addr() string {
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.addr
+}
+
+// Shutdown stops the server, waiting for in-flight probes to finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// handleHealthz answers as long as the process can serve HTTP
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz answers 503 with the reason while the server is not ready
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if s.ready != nil {
+		if err := s.ready(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
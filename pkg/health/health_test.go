@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	notReady := errors.New("access trees not loaded")
+
+	tests := []struct {
+		name       string
+		path       string
+		ready      ReadyFunc
+		wantStatus int
+		wantBody   string
+	}{
+		{"HealthzWhenNotReady", "/healthz", func() error { return notReady }, http.StatusOK, "ok"},
+		{"ReadyzWhenReady", "/readyz", func() error { return nil }, http.StatusOK, "ok"},
+		{"ReadyzWhenNotReady", "/readyz", func() error { return notReady }, http.StatusServiceUnavailable, "access trees not loaded"},
+		{"ReadyzWithoutCheck", "/readyz", nil, http.StatusOK, "ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewServer("", tt.ready).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body containing %q, got %q", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	var ready atomic.Bool
+	server := NewServer("127.0.0.1:0", func() error {
+		if !ready.Load() {
+			return errors.New("starting")
+		}
+		return nil
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start health server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	get := func(path string) int {
+		resp, err := http.Get("http://" + server.Addr() + path)
+		if err != nil {
+			t.Fatalf("Failed to probe %s: %v", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := get("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before ready, got %d", got)
+	}
+	ready.Store(true)
+	if got := get("/readyz"); got != http.StatusOK {
+		t.Errorf("Expected 200 once ready, got %d", got)
+	}
+	if got := get("/healthz"); got != http.StatusOK {
+		t.Errorf("Expected 200 from /healthz, got %d", got)
+	}
+}
@@ -8,44 +8,71 @@ import (
 	"time"
 )
 
+// Operation is the op= token of an access log line
+type Operation string
+
+// Access log operations
+const (
+	OpConnect    Operation = "connect"
+	OpDisconnect Operation = "disconnect"
+	OpLogin      Operation = "login"
+	OpChdir      Operation = "chdir"
+	OpReaddir    Operation = "readdir"
+	OpOpen       Operation = "open"
+	OpCreate     Operation = "create"
+	OpMkdir      Operation = "mkdir"
+	OpRemove     Operation = "remove"
+	OpRename     Operation = "rename"
+	OpHash       Operation = "hash"
+	OpCommand    Operation = "command"
+)
+
+// String returns the operation as written in the log
+func (o Operation) String() string {
+	return string(o)
+}
+
 // AccessLogger defines the interface for FTP operation logging
 type AccessLogger interface {
 	// LogAccess logs FTP operations
-	LogAccess(operation string, user string, path string, status string, details ...interface{})
+	LogAccess(operation Operation, user string, path string, status string, details ...interface{})
+	// LogRename logs a rename or move with both its source and destination
+	LogRename(user string, fromPath string, toPath string, status string, details ...interface{})
 	// LogAuth logs authentication operations
-	LogAuth(operation string, user string, status string, details ...interface{})
+	LogAuth(operation Operation, user string, status string, details ...interface{})
 	// Close closes the logger and stops background rotation
 	Close() error
 }
 
 type accessLogger struct {
-	logger *log.Logger
-	writer *RotatingWriter // nil if logging to io.Discard
+	out *output
 }
 
-// NewAccessLogger creates a new access logger
-func NewAccessLogger(logPath string, maxSize int64, verifyInterval time.Duration) (AccessLogger, error) {
-	var writer io.Writer
-	var rotatingWriter *RotatingWriter
-
-	if logPath == "" {
-		writer = io.Discard
-	} else {
-		rw, err := NewRotatingWriter(logPath, maxSize, verifyInterval)
-		if err != nil {
-			return nil, fmt.Errorf("creating rotating writer: %w", err)
-		}
-		writer = rw
-		rotatingWriter = rw
+// NewAccessLogger creates a new access logger. Lines are also written to
+// mirror if it is not nil; with neither a path nor a mirror they are
+// discarded.
+func NewAccessLogger(logPath string, maxSize int64, verifyInterval time.Duration, mirror io.Writer) (AccessLogger, error) {
+	return newAccessLogger(logPath, maxSize, verifyInterval, mirror, nil)
+}
+
+// newAccessLogger creates an access logger that also sends lines to, and
+// closes, syslog if it is not nil
+func newAccessLogger(logPath string, maxSize int64, verifyInterval time.Duration, mirror io.Writer, syslog io.WriteCloser) (*accessLogger, error) {
+	writer, rotatingWriter, err := openWriter(logPath, maxSize, verifyInterval, io.Discard, mirror, syslog)
+	if err != nil {
+		return nil, err
 	}
 
 	return &accessLogger{
-		logger: log.New(writer, "", 0), // No flags, we'll handle formatting ourselves
-		writer: rotatingWriter,
+		out: &output{
+			logger: log.New(writer, "", 0), // No flags, we'll handle formatting ourselves
+			writer: rotatingWriter,
+			syslog: syslog,
+		},
 	}, nil
 }
 
-func (l *accessLogger) LogAccess(operation string, user string, path string, status string, details ...interface{}) {
+func (l *accessLogger) LogAccess(operation Operation, user string, path string, status string, details ...interface{}) {
 	var parts []string
 	parts = append(parts, fmt.Sprintf("op=%s", formatValue(operation)))
 	if user != "" {
@@ -62,11 +89,29 @@ func (l *accessLogger) LogAccess(operation string, user string, path string, sta
 		}
 	}
 
-	timestamp := time.Now().UTC().Format("2006-01-02 15:04:05 -0700")
-	l.logger.Printf("%s %s", timestamp, strings.Join(parts, " "))
+	l.out.printf("%s %s", timestamp(), strings.Join(parts, " "))
 }
 
-func (l *accessLogger) LogAuth(operation string, user string, status string, details ...interface{}) {
+func (l *accessLogger) LogRename(user string, fromPath string, toPath string, status string, details ...interface{}) {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("op=%s", OpRename))
+	if user != "" {
+		parts = append(parts, fmt.Sprintf("user=%s", formatValue(user)))
+	}
+	parts = append(parts, fmt.Sprintf("from=%s", formatValue(fromPath)))
+	parts = append(parts, fmt.Sprintf("to=%s", formatValue(toPath)))
+	parts = append(parts, fmt.Sprintf("status=%s", formatValue(status)))
+
+	for i := 0; i < len(details); i += 2 {
+		if i+1 < len(details) {
+			parts = append(parts, fmt.Sprintf("%v=%s", details[i], formatValue(details[i+1])))
+		}
+	}
+
+	l.out.printf("%s %s", timestamp(), strings.Join(parts, " "))
+}
+
+func (l *accessLogger) LogAuth(operation Operation, user string, status string, details ...interface{}) {
 	var parts []string
 	parts = append(parts, fmt.Sprintf("op=%s", formatValue(operation)))
 	if user != "" {
@@ -80,14 +125,10 @@ func (l *accessLogger) LogAuth(operation string, user string, status string, det
 		}
 	}
 
-	timestamp := time.Now().UTC().Format("2006-01-02 15:04:05 -0700")
-	l.logger.Printf("%s %s", timestamp, strings.Join(parts, " "))
+	l.out.printf("%s %s", timestamp(), strings.Join(parts, " "))
 }
 
 // Close closes the logger and stops background rotation
 func (l *accessLogger) Close() error {
-	if l.writer != nil {
-		return l.writer.Close()
-	}
-	return nil
+	return l.out.close()
 }
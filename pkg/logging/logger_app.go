@@ -13,49 +13,68 @@ import (
 
 // AppLogger implements the go-log.Logger interface
 type AppLogger struct {
-	level  LogLevel
-	logger *log.Logger
-	writer *RotatingWriter // nil if logging to stdout
+	out     *output // Shared with loggers derived with With
+	derived bool    // Derived with With, so Close leaves out open
+	prefix  string  // Pre-formatted key/values added by With
 }
 
-// NewAppLogger creates a new application logger
-func NewAppLogger(logPath string, level LogLevel, maxSize int64, verifyInterval time.Duration) (*AppLogger, error) {
-	var writer io.Writer = os.Stdout
-	var rotatingWriter *RotatingWriter
+// NewAppLogger creates a new application logger. Lines are also written to
+// mirror if it is not nil; with neither a path nor a mirror they go to
+// stdout.
+func NewAppLogger(logPath string, level LogLevel, maxSize int64, verifyInterval time.Duration, mirror io.Writer) (*AppLogger, error) {
+	return newAppLogger(logPath, level, maxSize, verifyInterval, mirror, nil)
+}
 
-	if logPath != "" {
-		rw, err := NewRotatingWriter(logPath, maxSize, verifyInterval)
-		if err != nil {
-			return nil, fmt.Errorf("creating rotating writer: %w", err)
-		}
-		writer = rw
-		rotatingWriter = rw
+// newAppLogger creates an application logger that also sends lines to, and
+// closes, syslog if it is not nil
+func newAppLogger(logPath string, level LogLevel, maxSize int64, verifyInterval time.Duration, mirror io.Writer, syslog io.WriteCloser) (*AppLogger, error) {
+	writer, rotatingWriter, err := openWriter(logPath, maxSize, verifyInterval, os.Stdout, mirror, syslog)
+	if err != nil {
+		return nil, err
 	}
 
 	return &AppLogger{
-		level:  level,
-		logger: log.New(writer, "", 0), // No flags, we'll handle formatting ourselves
-		writer: rotatingWriter,
+		out: &output{
+			level:  level,
+			logger: log.New(writer, "", 0), // No flags, we'll handle formatting ourselves
+			writer: rotatingWriter,
+			syslog: syslog,
+		},
 	}, nil
 }
 
+// logLevelOrder ranks levels from least to most severe
+var logLevelOrder = map[LogLevel]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+	LogLevelPanic: 4,
+}
+
+// shouldLog reports whether lines at level are written. The caller holds
+// l.out.mu.
 func (l *AppLogger) shouldLog(level LogLevel) bool {
-	levels := map[LogLevel]int{
-		LogLevelDebug: 0,
-		LogLevelInfo:  1,
-		LogLevelWarn:  2,
-		LogLevelError: 3,
-		LogLevelPanic: 4,
-	}
-	return levels[level] >= levels[l.level]
+	return logLevelOrder[level] >= logLevelOrder[l.out.level]
 }
 
 func (l *AppLogger) log(level LogLevel, message string, keyvals ...interface{}) {
+	l.out.mu.RLock()
+	defer l.out.mu.RUnlock()
 	if !l.shouldLog(level) {
 		return
 	}
 
-	// Format key-value pairs
+	kvStr := formatKeyvals(keyvals)
+	if l.prefix != "" {
+		kvStr = strings.TrimSuffix(l.prefix+" "+kvStr, " ")
+	}
+
+	l.out.logger.Printf("%s %s: %s %s", timestamp(), level, message, kvStr)
+}
+
+// formatKeyvals formats key-value pairs as space-separated key=value
+func formatKeyvals(keyvals []interface{}) string {
 	var kvStrings []string
 	for i := 0; i < len(keyvals); i += 2 {
 		if i+1 < len(keyvals) {
@@ -64,10 +83,7 @@ func (l *AppLogger) log(level LogLevel, message string, keyvals ...interface{})
 			kvStrings = append(kvStrings, fmt.Sprintf("%s=%s", key, formatValue(value)))
 		}
 	}
-	kvStr := strings.Join(kvStrings, " ")
-
-	timestamp := time.Now().UTC().Format("2006-01-02 15:04:05 -0700")
-	l.logger.Printf("%s %s: %s %s", timestamp, level, message, kvStr)
+	return strings.Join(kvStrings, " ")
 }
 
 func toString(v interface{}) string {
@@ -110,22 +126,83 @@ func (l *AppLogger) Panic(message string, keyvals ...interface{}) {
 	l.log(LogLevelPanic, message, keyvals...)
 }
 
-// With implements go-log.Logger
+// With implements go-log.Logger. The returned *AppLogger writes to the same
+// destination, following it across reloads, and adds keyvals to every line,
+// ahead of the per-call ones. Closing it does not close the parent's file.
 func (l *AppLogger) With(keyvals ...interface{}) golog.Logger {
-	// For simplicity, we'll just return the same logger
-	// In a more complex implementation, we could create a new logger with context
-	return l
+	prefix := formatKeyvals(keyvals)
+	if l.prefix != "" {
+		prefix = strings.TrimSuffix(l.prefix+" "+prefix, " ")
+	}
+	return &AppLogger{
+		out:     l.out,
+		derived: true,
+		prefix:  prefix,
+	}
 }
 
 // IsDebug returns true if the logger is at debug level
 func (l *AppLogger) IsDebug() bool {
-	return l.level == LogLevelDebug
+	l.out.mu.RLock()
+	defer l.out.mu.RUnlock()
+	return l.out.level == LogLevelDebug
 }
 
 // Close closes the logger and stops background rotation
 func (l *AppLogger) Close() error {
-	if l.writer != nil {
-		return l.writer.Close()
+	if l.derived {
+		return nil
+	}
+	return l.out.close()
+}
+
+// appForwarder implements go-log.Logger by forwarding to the current App
+// logger, adding the key/values collected by With
+type appForwarder struct {
+	keyvals []interface{}
+}
+
+// Forwarder returns a go-log.Logger that always writes through the global App
+// logger, so long-lived holders keep working after Initialize replaces it
+func Forwarder() golog.Logger {
+	return appForwarder{}
+}
+
+// Debug implements go-log.Logger
+func (f appForwarder) Debug(message string, keyvals ...interface{}) {
+	App.Debug(message, f.with(keyvals)...)
+}
+
+// Info implements go-log.Logger
+func (f appForwarder) Info(message string, keyvals ...interface{}) {
+	App.Info(message, f.with(keyvals)...)
+}
+
+// Warn implements go-log.Logger
+func (f appForwarder) Warn(message string, keyvals ...interface{}) {
+	App.Warn(message, f.with(keyvals)...)
+}
+
+// Error implements go-log.Logger
+func (f appForwarder) Error(message string, keyvals ...interface{}) {
+	App.Error(message, f.with(keyvals)...)
+}
+
+// Panic implements go-log.Logger
+func (f appForwarder) Panic(message string, keyvals ...interface{}) {
+	App.Panic(message, f.with(keyvals)...)
+}
+
+// With implements go-log.Logger
+func (f appForwarder) With(keyvals ...interface{}) golog.Logger {
+	return appForwarder{keyvals: f.with(keyvals)}
+}
+
+// with returns the forwarder's key/values followed by keyvals
+func (f appForwarder) with(keyvals []interface{}) []interface{} {
+	if len(f.keyvals) == 0 {
+		return keyvals
 	}
-	return nil
+	combined := make([]interface{}, 0, len(f.keyvals)+len(keyvals))
+	return append(append(combined, f.keyvals...), keyvals...)
 }
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func newBufferLogger(level LogLevel) (*AppLogger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return &AppLogger{out: &output{level: level, logger: log.New(&buf, "", 0)}}, &buf
+}
+
+func TestAppLoggerWith(t *testing.T) {
+	logger, buf := newBufferLogger(LogLevelDebug)
+
+	conn := logger.With("conn", "abc")
+	conn.Info("opened", "user", "frodo")
+	conn.With("op", "list").Debug("listing")
+	conn.Info("no fields")
+	logger.Info("parent")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %d:\n%s", len(lines), buf.String())
+	}
+
+	wants := []string{
+		"info: opened conn=abc user=frodo",
+		"debug: listing conn=abc op=list",
+		"info: no fields conn=abc",
+		"info: parent",
+	}
+	for i, want := range wants {
+		if !strings.HasSuffix(lines[i], want) {
+			t.Errorf("Line %d = %q, want suffix %q", i, lines[i], want)
+		}
+	}
+	if strings.Contains(lines[3], "conn=") {
+		t.Errorf("With changed the parent logger: %q", lines[3])
+	}
+}
+
+func TestAppLoggerWithKeepsLevel(t *testing.T) {
+	logger, buf := newBufferLogger(LogLevelInfo)
+
+	logger.With("conn", "abc").Debug("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("Derived logger ignored the level: %q", buf.String())
+	}
+}
+
+func TestForwarderWith(t *testing.T) {
+	logger, buf := newBufferLogger(LogLevelDebug)
+	oldApp := App
+	App = logger
+	defer func() { App = oldApp }()
+
+	Forwarder().With("conn", "abc").With("op", "stor").Warn("slow", "bytes", 10)
+
+	if want := "warn: slow conn=abc op=stor bytes=10"; !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestForwarderFormatVerbs(t *testing.T) {
+	logger, buf := newBufferLogger(LogLevelDebug)
+	oldApp := App
+	App = logger
+	defer func() { App = oldApp }()
+
+	// ftpserverlib passes client-controlled text, such as paths, in messages
+	Forwarder().Error("could not open 100%s.txt", "path", "/100%d")
+	Forwarder().Panic("stuck at %v")
+
+	for _, want := range []string{"error: could not open 100%s.txt path=/100%d", "panic: stuck at %v"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q verbatim, got %q", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "MISSING") {
+		t.Errorf("Message was used as a format string: %q", buf.String())
+	}
+}
+
+func TestForwarderLevels(t *testing.T) {
+	logger, buf := newBufferLogger(LogLevelDebug)
+	oldApp := App
+	App = logger
+	defer func() { App = oldApp }()
+
+	forwarder := Forwarder()
+	forwarder.Debug("lib debug")
+	forwarder.Info("lib info")
+	forwarder.Warn("lib warn")
+	forwarder.Error("lib error")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	wants := []string{"debug: lib debug", "info: lib info", "warn: lib warn", "error: lib error"}
+	if len(lines) != len(wants) {
+		t.Fatalf("Expected %d lines, got %d:\n%s", len(wants), len(lines), buf.String())
+	}
+	for i, want := range wants {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("Line %d = %q, want %q", i, lines[i], want)
+		}
+	}
+
+	// The forwarder honors the App logger's level
+	buf.Reset()
+	logger.out.level = LogLevelWarn
+	forwarder.Info("dropped")
+	forwarder.Error("kept")
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "error: kept") {
+		t.Errorf("Expected only the error at warn level, got %q", buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// AuditLogger defines the interface for the audit log, which records only
+// refused operations and failed logins for security tooling
+type AuditLogger interface {
+	// LogEvent logs a refused operation or login. Every line carries op, user,
+	// path, client_ip and status in that order, empty when unknown, followed
+	// by details.
+	LogEvent(operation Operation, user string, path string, clientIP string, status string, details ...interface{})
+	// Close closes the logger and stops background rotation
+	Close() error
+}
+
+type auditLogger struct {
+	out *output
+}
+
+// NewAuditLogger creates a new audit logger. With no path, events are
+// discarded.
+func NewAuditLogger(logPath string, maxSize int64, verifyInterval time.Duration) (AuditLogger, error) {
+	return newAuditLogger(logPath, maxSize, verifyInterval)
+}
+
+func newAuditLogger(logPath string, maxSize int64, verifyInterval time.Duration) (*auditLogger, error) {
+	writer, rotatingWriter, err := openWriter(logPath, maxSize, verifyInterval, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLogger{
+		out: &output{
+			logger: log.New(writer, "", 0),
+			writer: rotatingWriter,
+		},
+	}, nil
+}
+
+func (l *auditLogger) LogEvent(operation Operation, user string, path string, clientIP string, status string, details ...interface{}) {
+	parts := []string{
+		fmt.Sprintf("op=%s", formatValue(operation)),
+		fmt.Sprintf("user=%s", formatValue(user)),
+		fmt.Sprintf("path=%s", formatValue(path)),
+		fmt.Sprintf("client_ip=%s", formatValue(clientIP)),
+		fmt.Sprintf("status=%s", formatValue(status)),
+	}
+
+	for i := 0; i < len(details); i += 2 {
+		if i+1 < len(details) {
+			parts = append(parts, fmt.Sprintf("%v=%s", details[i], formatValue(details[i+1])))
+		}
+	}
+
+	l.out.printf("%s %s", timestamp(), strings.Join(parts, " "))
+}
+
+// Close closes the logger and stops background rotation
+func (l *auditLogger) Close() error {
+	return l.out.close()
+}
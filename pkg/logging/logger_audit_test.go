@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLoggerFields(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLogger(logPath, 1000000, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+
+	audit.LogEvent(OpCreate, "frodo", "/players/sam/ring.txt", "10.0.0.1:40000", "denied", "session", "abc")
+	// Unknown fields are still written, so every line has the same layout
+	audit.LogEvent(OpConnect, "", "", "10.0.0.2:40000", "denied", "reason", "ip_filter")
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Failed to close audit logger: %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	for _, want := range []string{
+		"op=create user=frodo path=/players/sam/ring.txt client_ip=10.0.0.1:40000 status=denied session=abc\n",
+		"op=connect user= path= client_ip=10.0.0.2:40000 status=denied reason=ip_filter\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected audit log to contain %q, got:\n%s", want, content)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+// output is where a logger's lines go. The global loggers keep their output
+// for the life of the process and Initialize replaces what is inside it, so
+// sessions logging during a reload, and loggers derived with With, carry on
+// into the new files and no line is written to a closed one.
+type output struct {
+	mu     sync.RWMutex
+	level  LogLevel // Least severe level written, for app loggers
+	logger *log.Logger
+	writer *RotatingWriter // nil if not logging to a file
+	syslog io.Closer       // nil if not logging to syslog
+}
+
+// printf writes a line. During a replace it waits and writes to the new
+// destination.
+func (o *output) printf(format string, args ...interface{}) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	o.logger.Printf(format, args...)
+}
+
+// replace takes over next's destination and closes the old one once the
+// lines being written to it are done. next must not be used afterwards.
+func (o *output) replace(next *output) {
+	o.mu.Lock()
+	oldWriter, oldSyslog := o.writer, o.syslog
+	o.level, o.logger, o.writer, o.syslog = next.level, next.logger, next.writer, next.syslog
+	o.mu.Unlock()
+
+	closeDestination(oldWriter, oldSyslog)
+}
+
+// close closes the output's file and syslog connection
+func (o *output) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return closeDestination(o.writer, o.syslog)
+}
+
+// closeDestination closes whichever of writer and syslog are not nil,
+// returning the file's error
+func closeDestination(writer *RotatingWriter, syslog io.Closer) error {
+	if syslog != nil {
+		_ = syslog.Close()
+	}
+	if writer != nil {
+		return writer.Close()
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -21,6 +22,24 @@ type RotatingWriter struct {
 	verifyInterval time.Duration
 	stopCh         chan struct{}
 	wg             sync.WaitGroup
+	closeOnce      sync.Once
+
+	// buf batches writes when buffering is enabled. It writes through
+	// fileWriter, so it always targets the currently open file.
+	buf *bufio.Writer
+}
+
+// fileWriter writes to whichever file the RotatingWriter has open. It is
+// only used with the writer's mutex held.
+type fileWriter struct {
+	w *RotatingWriter
+}
+
+func (fw fileWriter) Write(p []byte) (int, error) {
+	if fw.w.f == nil {
+		return 0, os.ErrClosed
+	}
+	return fw.w.f.Write(p)
 }
 
 // NewRotatingWriter creates a new rotating writer that:
@@ -70,33 +89,96 @@ func NewRotatingWriter(path string, maxSize int64, verifyInterval time.Duration)
 	return w, nil
 }
 
+// EnableBuffering batches writes in a buffer of size bytes that is flushed
+// when full, every flushInterval, before rotating and on Close. Lines may
+// reach the file up to flushInterval late, and are lost if the process dies
+// without closing the writer.
+func (w *RotatingWriter) EnableBuffering(size int, flushInterval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf != nil {
+		return
+	}
+	w.buf = bufio.NewWriterSize(fileWriter{w}, size)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.mu.Lock()
+				_ = w.flushLocked()
+				w.mu.Unlock()
+			case <-w.stopCh:
+				return
+			}
+		}
+	}()
+}
+
 // Write implements io.Writer
 func (w *RotatingWriter) Write(p []byte) (int, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Size-based rotation uses internal counter
+	// Size-based rotation uses internal counter, which includes buffered bytes
 	if w.approxSize+int64(len(p)) >= w.maxSize {
 		if err := w.rotateLocked(); err != nil {
 			return 0, err
 		}
 	}
 
-	n, err := w.f.Write(p)
+	var n int
+	var err error
+	if w.buf != nil {
+		n, err = w.buf.Write(p)
+	} else {
+		n, err = w.f.Write(p)
+	}
 	w.approxSize += int64(n)
 	return n, err
 }
 
-// Close stops the background verifier and closes the file
-func (w *RotatingWriter) Close() error {
-	close(w.stopCh)
-	w.wg.Wait()
+// Flush writes any buffered data to the file
+func (w *RotatingWriter) Flush() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	if w.f != nil {
-		return w.f.Close()
+	return w.flushLocked()
+}
+
+// flushLocked writes buffered data to the open file. After a failed write
+// the buffer is reset, dropping its contents, so later writes can recover.
+func (w *RotatingWriter) flushLocked() error {
+	if w.buf == nil || w.buf.Buffered() == 0 {
+		return nil
 	}
-	return nil
+	err := w.buf.Flush()
+	if err != nil {
+		w.buf.Reset(fileWriter{w})
+	}
+	return err
+}
+
+// Close stops the background goroutines, flushes and closes the file.
+// Calling Close more than once is safe; later calls are no-ops.
+func (w *RotatingWriter) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.stopCh)
+		w.wg.Wait()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.f != nil {
+			err = w.flushLocked()
+			if closeErr := w.f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
 }
 
 // openForAppendLocked opens the file for appending and initializes state
@@ -127,6 +209,9 @@ func (w *RotatingWriter) openForAppendLocked() error {
 // rotateLocked rotates the current log file to an archive with timestamp
 // Format: old/<basename>.YYYYMMDD-HHMMSS (matching MUD's log rotation)
 func (w *RotatingWriter) rotateLocked() error {
+	// Buffered lines belong to the file being archived
+	_ = w.flushLocked()
+
 	// Close current file
 	if w.f != nil {
 		_ = w.f.Close()
@@ -179,7 +264,11 @@ func (w *RotatingWriter) verifyLocked() error {
 		return w.reopenLocked()
 	}
 
+	// Buffered bytes are counted but not yet on disk
 	realSize := fiOpen.Size()
+	if w.buf != nil {
+		realSize += int64(w.buf.Buffered())
+	}
 	// If drift exceeds 8KB, sync with actual size
 	if abs64(realSize-w.approxSize) > 8*1024 {
 		w.approxSize = realSize
@@ -190,6 +279,9 @@ func (w *RotatingWriter) verifyLocked() error {
 
 // reopenLocked closes and reopens the file
 func (w *RotatingWriter) reopenLocked() error {
+	// Buffered lines were written before the file was moved, so they
+	// follow it
+	_ = w.flushLocked()
 	if w.f != nil {
 		_ = w.f.Close()
 		w.f = nil
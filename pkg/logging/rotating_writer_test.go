@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLine returns a 100 byte log line numbered i
+func testLine(i int) []byte {
+	prefix := fmt.Sprintf("line %04d ", i)
+	return []byte(prefix + strings.Repeat("x", 99-len(prefix)) + "\n")
+}
+
+func TestRotatingWriterBufferedRotation(t *testing.T) {
+	for _, buffered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Buffered=%v", buffered), func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "access.log")
+			w, err := NewRotatingWriter(path, 1000, time.Hour)
+			if err != nil {
+				t.Fatalf("Failed to create writer: %v", err)
+			}
+			if buffered {
+				w.EnableBuffering(256, time.Hour)
+			}
+
+			// The 10th line would reach maxSize, so lines 0-8 are archived
+			// and 9-14 stay in the current file
+			for i := 0; i < 15; i++ {
+				if _, err := w.Write(testLine(i)); err != nil {
+					t.Fatalf("Write %d failed: %v", i, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			archives, err := filepath.Glob(filepath.Join(dir, "old", "access.log.*"))
+			if err != nil || len(archives) != 1 {
+				t.Fatalf("Expected one archive, got %v (%v)", archives, err)
+			}
+
+			var want strings.Builder
+			for i := 0; i < 9; i++ {
+				want.Write(testLine(i))
+			}
+			assertContent(t, archives[0], want.String())
+
+			want.Reset()
+			for i := 9; i < 15; i++ {
+				want.Write(testLine(i))
+			}
+			assertContent(t, path, want.String())
+		})
+	}
+}
+
+func TestRotatingWriterFlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := NewRotatingWriter(path, 1000000, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer w.Close()
+	w.EnableBuffering(4096, 20*time.Millisecond)
+
+	if _, err := w.Write(testLine(1)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read log: %v", err)
+		}
+		if string(content) == string(testLine(1)) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Buffered line was not flushed, file contains %q", content)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if string(content) != want {
+		t.Errorf("%s contains %d bytes, want %d:\n%s", filepath.Base(path), len(content), len(want), content)
+	}
+}
+
+func BenchmarkRotatingWriter(b *testing.B) {
+	for _, buffered := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Buffered=%v", buffered), func(b *testing.B) {
+			w, err := NewRotatingWriter(filepath.Join(b.TempDir(), "access.log"), 1<<40, time.Hour)
+			if err != nil {
+				b.Fatalf("Failed to create writer: %v", err)
+			}
+			defer w.Close()
+			if buffered {
+				w.EnableBuffering(64*1024, time.Second)
+			}
+
+			line := testLine(0)
+			b.SetBytes(int64(len(line)))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := w.Write(line); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
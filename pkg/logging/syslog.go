@@ -0,0 +1,66 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// syslogFacilities maps the names accepted for SyslogConfig.Facility to
+// syslog facilities
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// NewSyslogWriter connects to syslog. Every line written is sent as one
+// message at info severity.
+func NewSyslogWriter(config SyslogConfig) (io.WriteCloser, error) {
+	facility, err := parseFacility(config.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := syslog.Dial(config.Network, config.Address, facility|syslog.LOG_INFO, config.tag())
+	if err != nil {
+		return nil, fmt.Errorf("connecting to syslog: %w", err)
+	}
+	return w, nil
+}
+
+// ValidateSyslogFacility reports whether name is a known syslog facility
+func ValidateSyslogFacility(name string) error {
+	_, err := parseFacility(name)
+	return err
+}
+
+func parseFacility(name string) (syslog.Priority, error) {
+	if name == "" {
+		return syslog.LOG_DAEMON, nil
+	}
+	facility, ok := syslogFacilities[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return facility, nil
+}
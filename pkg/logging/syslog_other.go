@@ -0,0 +1,29 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// NewSyslogWriter falls back to stderr, as syslog is not available on this
+// platform
+func NewSyslogWriter(config SyslogConfig) (io.WriteCloser, error) {
+	fmt.Fprintln(os.Stderr, "warning: syslog is not supported on this platform, logging to stderr instead")
+	return nopCloser{os.Stderr}, nil
+}
+
+// ValidateSyslogFacility accepts any facility, as there is no syslog to
+// send to
+func ValidateSyslogFacility(name string) error {
+	return nil
+}
+
+// nopCloser keeps stderr open when the logger is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,106 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenSyslog starts a fake syslog daemon on a unixgram socket and returns
+// its address and a channel of received messages
+func listenSyslog(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	addr := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+	return addr, messages
+}
+
+func receive(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a syslog message")
+		return ""
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	addr, messages := listenSyslog(t)
+	t.Cleanup(Shutdown)
+
+	config := &SyslogConfig{Network: "unixgram", Address: addr, Facility: "local3", Tag: "ftpd-test"}
+	if err := Initialize("", "", "", LogLevelInfo, 1000000, time.Minute, nil, config); err != nil {
+		t.Fatalf("Failed to initialize logging: %v", err)
+	}
+
+	Access.LogAuth("login", "frodo", "success")
+	msg := receive(t, messages)
+	// local3 (19) * 8 + info (6) = 158
+	if !strings.HasPrefix(msg, "<158>") {
+		t.Errorf("Expected local3.info priority, got %q", msg)
+	}
+	if !strings.Contains(msg, "ftpd-test") || !strings.Contains(msg, "op=login user=frodo status=success") {
+		t.Errorf("Unexpected access message %q", msg)
+	}
+
+	App.Info("Server started", "port", 2121)
+	if msg := receive(t, messages); !strings.Contains(msg, "info: Server started port=2121") {
+		t.Errorf("Unexpected app message %q", msg)
+	}
+}
+
+func TestSyslogWithFile(t *testing.T) {
+	addr, messages := listenSyslog(t)
+	t.Cleanup(Shutdown)
+
+	accessLog := filepath.Join(t.TempDir(), "access.log")
+	config := &SyslogConfig{Network: "unixgram", Address: addr}
+	if err := Initialize(accessLog, "", "", LogLevelInfo, 1000000, time.Minute, nil, config); err != nil {
+		t.Fatalf("Failed to initialize logging: %v", err)
+	}
+
+	Access.LogAccess("mkdir", "frodo", "/tmp", "success")
+	if msg := receive(t, messages); !strings.Contains(msg, "vkftpd") || !strings.Contains(msg, "op=mkdir") {
+		t.Errorf("Unexpected syslog message %q", msg)
+	}
+	Access.Close()
+	content, err := os.ReadFile(accessLog)
+	if err != nil {
+		t.Fatalf("Failed to read access log: %v", err)
+	}
+	if !strings.Contains(string(content), "op=mkdir") {
+		t.Errorf("Expected access log to contain op=mkdir, got:\n%s", content)
+	}
+}
+
+func TestSyslogErrors(t *testing.T) {
+	if err := ValidateSyslogFacility("local9"); err == nil {
+		t.Error("Expected error for unknown facility")
+	}
+	if _, err := NewSyslogWriter(SyslogConfig{Network: "unixgram", Address: filepath.Join(t.TempDir(), "missing.sock")}); err == nil {
+		t.Error("Expected error connecting to a missing socket")
+	}
+}
@@ -2,7 +2,10 @@ package logging
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,26 +30,71 @@ var (
 	App *AppLogger
 	// Access is the global access logger
 	Access AccessLogger
+	// Audit is the global audit logger
+	Audit AuditLogger
 )
 
+// DefaultTimestampLayout is the layout log timestamps use unless
+// SetTimestampFormat picks another
+const DefaultTimestampLayout = "2006-01-02 15:04:05 -0700"
+
+// timestampFormat is the zone and layout of log line timestamps
+type timestampFormat struct {
+	location *time.Location
+	layout   string
+}
+
+var currentTimestampFormat atomic.Pointer[timestampFormat]
+
 func init() {
+	SetTimestampFormat(time.UTC, DefaultTimestampLayout)
+
 	// Initialize default loggers that write to io.Discard
 	var err error
 
 	// Create no-op loggers by default (rotation params don't matter for empty path)
-	App, err = NewAppLogger("", LogLevelInfo, 1000000, 45*time.Second)
+	App, err = NewAppLogger("", LogLevelInfo, 1000000, 45*time.Second, nil)
 	if err != nil {
 		panic(fmt.Sprintf("failed to initialize default app logger: %v", err))
 	}
 
-	Access, err = NewAccessLogger("", 1000000, 45*time.Second)
+	Access, err = NewAccessLogger("", 1000000, 45*time.Second, nil)
 	if err != nil {
 		panic(fmt.Sprintf("failed to initialize default access logger: %v", err))
 	}
+
+	Audit, err = NewAuditLogger("", 1000000, 45*time.Second)
+	if err != nil {
+		panic(fmt.Sprintf("failed to initialize default audit logger: %v", err))
+	}
+}
+
+// SyslogConfig selects the syslog daemon that logs are sent to
+type SyslogConfig struct {
+	Network  string // "" for the local daemon, or "udp", "tcp", "unixgram"...
+	Address  string // Daemon address; ignored when Network is ""
+	Facility string // Facility name such as "daemon" or "local3"; "" selects "daemon"
+	Tag      string // Program name recorded with each message; "" selects "vkftpd"
+}
+
+func (c SyslogConfig) tag() string {
+	if c.Tag == "" {
+		return "vkftpd"
+	}
+	return c.Tag
 }
 
-// Initialize sets up the global loggers
-func Initialize(accessLogPath, appLogPath string, level LogLevel, maxSize int64, verifyInterval time.Duration) error {
+// Initialize sets up the global loggers. If mirror is not nil, the access
+// and app loggers also write every line to it. If syslogConfig is not nil,
+// they also send every line to syslog; pass empty paths to log only to
+// syslog. The audit log is kept out of mirrors and syslog so that it holds
+// nothing but audit events, and is discarded if auditLogPath is empty.
+//
+// Called again at runtime, Initialize reopens the loggers in place: lines
+// being written finish in the old files before those are closed, and loggers
+// derived with With follow. If any log cannot be opened, none of the
+// current loggers is changed.
+func Initialize(accessLogPath, appLogPath, auditLogPath string, level LogLevel, maxSize int64, verifyInterval time.Duration, mirror io.Writer, syslogConfig *SyslogConfig) error {
 	var err error
 
 	// Set default level if not specified
@@ -54,36 +102,69 @@ func Initialize(accessLogPath, appLogPath string, level LogLevel, maxSize int64,
 		level = LogLevelInfo
 	}
 
+	// Each logger owns its own syslog connection and closes it with the logger
+	var accessSyslog, appSyslog io.WriteCloser
+	if syslogConfig != nil {
+		if accessSyslog, err = NewSyslogWriter(*syslogConfig); err != nil {
+			return fmt.Errorf("failed to initialize access logger: %w", err)
+		}
+		if appSyslog, err = NewSyslogWriter(*syslogConfig); err != nil {
+			_ = accessSyslog.Close()
+			return fmt.Errorf("failed to initialize app logger: %w", err)
+		}
+	}
+
 	// Initialize access logger
-	newAccess, err := NewAccessLogger(accessLogPath, maxSize, verifyInterval)
+	newAccess, err := newAccessLogger(accessLogPath, maxSize, verifyInterval, mirror, accessSyslog)
 	if err != nil {
+		closeSyslog(accessSyslog)
+		closeSyslog(appSyslog)
 		return fmt.Errorf("failed to initialize access logger: %w", err)
 	}
 
 	// Initialize application logger
-	newApp, err := NewAppLogger(appLogPath, level, maxSize, verifyInterval)
+	newApp, err := newAppLogger(appLogPath, level, maxSize, verifyInterval, mirror, appSyslog)
 	if err != nil {
+		_ = newAccess.Close()
+		closeSyslog(appSyslog)
 		return fmt.Errorf("failed to initialize app logger: %w", err)
 	}
 
-	// Close old loggers if they exist
-	if Access != nil {
-		_ = Access.Close()
-	}
-	if App != nil {
-		_ = App.Close()
+	// Initialize audit logger
+	newAudit, err := newAuditLogger(auditLogPath, maxSize, verifyInterval)
+	if err != nil {
+		_ = newAccess.Close()
+		_ = newApp.Close()
+		return fmt.Errorf("failed to initialize audit logger: %w", err)
 	}
 
-	// Update global loggers
-	Access = newAccess
-	App = newApp
+	// Loggers installed by assignment, as tests do, are swapped out whole
+	if current, ok := Access.(*accessLogger); ok {
+		current.out.replace(newAccess.out)
+	} else {
+		oldAccess := Access
+		Access = newAccess
+		if oldAccess != nil {
+			_ = oldAccess.Close()
+		}
+	}
+	App.out.replace(newApp.out)
+	if current, ok := Audit.(*auditLogger); ok {
+		current.out.replace(newAudit.out)
+	} else {
+		oldAudit := Audit
+		Audit = newAudit
+		if oldAudit != nil {
+			_ = oldAudit.Close()
+		}
+	}
 
 	return nil
 }
 
 // MustInitialize initializes logging and panics on error
-func MustInitialize(accessLogPath, appLogPath string, level LogLevel, maxSize int64, verifyInterval time.Duration) {
-	if err := Initialize(accessLogPath, appLogPath, level, maxSize, verifyInterval); err != nil {
+func MustInitialize(accessLogPath, appLogPath, auditLogPath string, level LogLevel, maxSize int64, verifyInterval time.Duration, mirror io.Writer, syslogConfig *SyslogConfig) {
+	if err := Initialize(accessLogPath, appLogPath, auditLogPath, level, maxSize, verifyInterval, mirror, syslogConfig); err != nil {
 		panic(fmt.Sprintf("failed to initialize logging: %v", err))
 	}
 }
@@ -96,6 +177,96 @@ func Shutdown() {
 	if App != nil {
 		_ = App.Close()
 	}
+	if Audit != nil {
+		_ = Audit.Close()
+	}
+}
+
+// SetTimestampFormat sets the time zone and layout of timestamps written by
+// every logger. A nil location selects UTC and an empty layout selects
+// DefaultTimestampLayout.
+func SetTimestampFormat(location *time.Location, layout string) {
+	if location == nil {
+		location = time.UTC
+	}
+	if layout == "" {
+		layout = DefaultTimestampLayout
+	}
+	currentTimestampFormat.Store(&timestampFormat{location: location, layout: layout})
+}
+
+// timestamp formats the current time for a log line
+func timestamp() string {
+	format := currentTimestampFormat.Load()
+	return time.Now().In(format.location).Format(format.layout)
+}
+
+// ParseTimezone returns the location named by a log timezone setting: "UTC"
+// (or empty), "Local", or an IANA zone name such as "Europe/Oslo"
+func ParseTimezone(name string) (*time.Location, error) {
+	switch name {
+	case "", "UTC":
+		return time.UTC, nil
+	case "Local":
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return location, nil
+}
+
+// ParseMirror returns the stream named by a log mirror setting: "stdout",
+// "stderr", or "" for none
+func ParseMirror(name string) (io.Writer, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		return nil, fmt.Errorf("unknown log mirror %q (expected \"stdout\" or \"stderr\")", name)
+	}
+}
+
+// openWriter opens the rotating file at logPath, if any, and combines it
+// with the other non-nil writers. With none of them, lines go to fallback.
+// The returned RotatingWriter is nil when no file is open.
+func openWriter(logPath string, maxSize int64, verifyInterval time.Duration, fallback io.Writer, others ...io.Writer) (io.Writer, *RotatingWriter, error) {
+	var writers []io.Writer
+	var rw *RotatingWriter
+	if logPath != "" {
+		var err error
+		rw, err = NewRotatingWriter(logPath, maxSize, verifyInterval)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating rotating writer: %w", err)
+		}
+		writers = append(writers, rw)
+	}
+	for _, w := range others {
+		if w != nil {
+			writers = append(writers, w)
+		}
+	}
+
+	switch len(writers) {
+	case 0:
+		return fallback, nil, nil
+	case 1:
+		return writers[0], rw, nil
+	default:
+		return io.MultiWriter(writers...), rw, nil
+	}
+}
+
+// closeSyslog closes a syslog writer that was not handed to a logger
+func closeSyslog(w io.WriteCloser) {
+	if w != nil {
+		_ = w.Close()
+	}
 }
 
 // formatValue formats a value for logfmt, quoting if necessary
@@ -0,0 +1,312 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitializeSwapsLevel(t *testing.T) {
+	tmpDir := t.TempDir()
+	appLog := filepath.Join(tmpDir, "app.log")
+	t.Cleanup(Shutdown)
+
+	if err := Initialize("", appLog, "", LogLevelInfo, 1000000, time.Minute, nil, nil); err != nil {
+		t.Fatalf("Failed to initialize logging: %v", err)
+	}
+	if App.IsDebug() {
+		t.Fatal("Expected info level logger")
+	}
+
+	// A forwarder obtained before the reload must follow the new logger
+	forwarder := Forwarder()
+	forwarder.Debug("before reload")
+
+	if err := Initialize("", appLog, "", LogLevelDebug, 1000000, time.Minute, nil, nil); err != nil {
+		t.Fatalf("Failed to reinitialize logging: %v", err)
+	}
+	if !App.IsDebug() {
+		t.Fatal("Expected debug level logger after reinitialize")
+	}
+
+	forwarder.Debug("after reload")
+
+	content, err := os.ReadFile(appLog)
+	if err != nil {
+		t.Fatalf("Failed to read app log: %v", err)
+	}
+	if strings.Contains(string(content), "before reload") {
+		t.Error("Debug message logged while at info level")
+	}
+	if !strings.Contains(string(content), "after reload") {
+		t.Errorf("Expected debug message after reload, got:\n%s", content)
+	}
+}
+
+func TestInitializeFailureKeepsLoggers(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Cleanup(Shutdown)
+
+	appLog := filepath.Join(tmpDir, "app.log")
+	auditLog := filepath.Join(tmpDir, "audit.log")
+	if err := Initialize("", appLog, auditLog, LogLevelInfo, 1000000, time.Minute, nil, nil); err != nil {
+		t.Fatalf("Failed to initialize logging: %v", err)
+	}
+
+	// A file where a directory is expected makes the app log unopenable. The
+	// audit log is valid, and must not be switched either.
+	blocker := filepath.Join(tmpDir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	newAuditLog := filepath.Join(tmpDir, "new-audit.log")
+	if err := Initialize("", filepath.Join(blocker, "app.log"), newAuditLog, LogLevelDebug, 1000000, time.Minute, nil, nil); err == nil {
+		t.Fatal("Expected error for unopenable log path")
+	}
+
+	if App.IsDebug() {
+		t.Error("Expected the app log level to be unchanged after failed reinitialize")
+	}
+	App.Info("still here")
+	Audit.LogEvent(OpLogin, "sauron", "", "10.0.0.1:40000", "failed")
+	Shutdown()
+
+	for path, want := range map[string]string{appLog: "still here", auditLog: "user=sauron"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected %s to contain %q, got:\n%s", filepath.Base(path), want, content)
+		}
+	}
+	if content, err := os.ReadFile(newAuditLog); err == nil && len(content) > 0 {
+		t.Errorf("Expected nothing in the audit log of the failed reinitialize, got:\n%s", content)
+	}
+}
+
+func TestInitializeWhileLogging(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Cleanup(Shutdown)
+
+	accessLog := filepath.Join(tmpDir, "access.log")
+	appLog := filepath.Join(tmpDir, "app.log")
+	auditLog := filepath.Join(tmpDir, "audit.log")
+	initialize := func() {
+		if err := Initialize(accessLog, appLog, auditLog, LogLevelInfo, 1000000, time.Minute, nil, nil); err != nil {
+			t.Errorf("Failed to initialize logging: %v", err)
+		}
+	}
+	initialize()
+	session := App.With("session", "abc")
+
+	// Sessions keep logging while the logs are reopened, as on SIGHUP
+	const writers, lines = 4, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				session.Info("line")
+				Access.LogAccess(OpOpen, "frodo", "/notes.txt", "success")
+				Audit.LogEvent(OpOpen, "frodo", "/secret", "10.0.0.1:40000", "denied")
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		initialize()
+	}
+	wg.Wait()
+	Shutdown()
+
+	for _, path := range []string{accessLog, appLog, auditLog} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if got := strings.Count(string(content), "\n"); got != writers*lines {
+			t.Errorf("%s has %d lines, want %d", filepath.Base(path), got, writers*lines)
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	tmpDir := t.TempDir()
+	appPath := filepath.Join(tmpDir, "app.log")
+	accessPath := filepath.Join(tmpDir, "access.log")
+
+	var mirror bytes.Buffer
+	app, err := NewAppLogger(appPath, LogLevelInfo, 1000000, time.Minute, &mirror)
+	if err != nil {
+		t.Fatalf("Failed to create app logger: %v", err)
+	}
+	access, err := NewAccessLogger(accessPath, 1000000, time.Minute, &mirror)
+	if err != nil {
+		t.Fatalf("Failed to create access logger: %v", err)
+	}
+
+	app.Info("Server started")
+	access.LogAccess("mkdir", "frodo", "/tmp", "success")
+	app.Close()
+	access.Close()
+
+	for path, want := range map[string]string{appPath: "Server started", accessPath: "op=mkdir"} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected %s to contain %q, got:\n%s", filepath.Base(path), want, content)
+		}
+		if !strings.Contains(mirror.String(), want) {
+			t.Errorf("Expected mirror to contain %q, got:\n%s", want, mirror.String())
+		}
+	}
+}
+
+func TestMirrorWithoutPath(t *testing.T) {
+	var mirror bytes.Buffer
+	access, err := NewAccessLogger("", 1000000, time.Minute, &mirror)
+	if err != nil {
+		t.Fatalf("Failed to create access logger: %v", err)
+	}
+	access.LogAuth("login", "frodo", "success")
+	if !strings.Contains(mirror.String(), "op=login user=frodo status=success") {
+		t.Errorf("Expected login line on the mirror, got:\n%s", mirror.String())
+	}
+}
+
+func TestParseMirror(t *testing.T) {
+	for _, name := range []string{"", "stdout", "stderr"} {
+		if _, err := ParseMirror(name); err != nil {
+			t.Errorf("ParseMirror(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := ParseMirror("syslog"); err == nil {
+		t.Error("Expected error for unknown mirror")
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	// A fixed zone stands in for the machine's local zone
+	oldLocal := time.Local
+	time.Local = time.FixedZone("VMT", 3*3600+1800)
+	t.Cleanup(func() {
+		time.Local = oldLocal
+		SetTimestampFormat(time.UTC, DefaultTimestampLayout)
+	})
+
+	location, err := ParseTimezone("Local")
+	if err != nil {
+		t.Fatalf("ParseTimezone(Local) failed: %v", err)
+	}
+	SetTimestampFormat(location, time.RFC3339)
+
+	var mirror bytes.Buffer
+	app, err := NewAppLogger("", LogLevelInfo, 1000000, time.Minute, &mirror)
+	if err != nil {
+		t.Fatalf("Failed to create app logger: %v", err)
+	}
+	access, err := NewAccessLogger("", 1000000, time.Minute, &mirror)
+	if err != nil {
+		t.Fatalf("Failed to create access logger: %v", err)
+	}
+	app.Info("Server started")
+	access.LogAuth("login", "frodo", "success")
+
+	lines := strings.Split(strings.TrimSpace(mirror.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d:\n%s", len(lines), mirror.String())
+	}
+	for _, line := range lines {
+		stamp, _, _ := strings.Cut(line, " ")
+		when, err := time.Parse(time.RFC3339, stamp)
+		if err != nil {
+			t.Errorf("Timestamp %q is not RFC 3339: %v", stamp, err)
+			continue
+		}
+		if _, offset := when.Zone(); offset != 3*3600+1800 {
+			t.Errorf("Timestamp %q has offset %ds, want local +03:30", stamp, offset)
+		}
+	}
+}
+
+func TestTimestampFormatDefault(t *testing.T) {
+	var mirror bytes.Buffer
+	access, err := NewAccessLogger("", 1000000, time.Minute, &mirror)
+	if err != nil {
+		t.Fatalf("Failed to create access logger: %v", err)
+	}
+	access.LogAuth("login", "frodo", "success")
+
+	if _, err := time.Parse(DefaultTimestampLayout, mirror.String()[:len(DefaultTimestampLayout)]); err != nil {
+		t.Errorf("Expected default timestamp layout, got %q: %v", mirror.String(), err)
+	}
+	if !strings.Contains(mirror.String(), " +0000 ") {
+		t.Errorf("Expected a UTC timestamp, got %q", mirror.String())
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    *time.Location
+		wantErr bool
+	}{
+		{"", time.UTC, false},
+		{"UTC", time.UTC, false},
+		{"Local", time.Local, false},
+		{"Not/AZone", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimezone(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimezone(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimezone(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOperationTokens(t *testing.T) {
+	tests := []struct {
+		op   Operation
+		want string
+	}{
+		{OpConnect, "connect"},
+		{OpDisconnect, "disconnect"},
+		{OpLogin, "login"},
+		{OpChdir, "chdir"},
+		{OpReaddir, "readdir"},
+		{OpOpen, "open"},
+		{OpCreate, "create"},
+		{OpMkdir, "mkdir"},
+		{OpRemove, "remove"},
+		{OpRename, "rename"},
+		{OpHash, "hash"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.op.String(); got != tt.want {
+			t.Errorf("Operation %q stringifies to %q, want %q", tt.want, got, tt.want)
+		}
+
+		var buf bytes.Buffer
+		access, err := NewAccessLogger("", 1000000, time.Minute, &buf)
+		if err != nil {
+			t.Fatalf("Failed to create access logger: %v", err)
+		}
+		access.LogAccess(tt.op, "frodo", "/", "success")
+		if !strings.Contains(buf.String(), " op="+tt.want+" ") {
+			t.Errorf("Expected op=%s in %q", tt.want, buf.String())
+		}
+	}
+}
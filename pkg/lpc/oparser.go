@@ -1,6 +1,7 @@
 package lpc
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,7 +12,8 @@ import (
 // ObjectParser holds parsing configuration for LPC object format.
 // The format is used to store and restore object state in DGD.
 type ObjectParser struct {
-	strict bool
+	strict           bool
+	detectDuplicates bool
 }
 
 // NewObjectParser creates a new parser with the given options.
@@ -23,6 +25,24 @@ func NewObjectParser(strict bool) *ObjectParser {
 	}
 }
 
+// SetDetectDuplicates enables reporting of keys that appear more than once.
+// A duplicate is a ParseError wrapping a *DuplicateKeyError: in strict mode
+// it stops parsing, otherwise it is added to ParseResult.Errors and the last
+// value is kept. By default duplicates silently overwrite earlier values.
+func (p *ObjectParser) SetDetectDuplicates(enabled bool) {
+	p.detectDuplicates = enabled
+}
+
+// DuplicateKeyError reports a key that was already set on an earlier line
+type DuplicateKeyError struct {
+	Key       string
+	FirstLine int // Line where the key first appeared
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %q (first seen at line %d)", e.Key, e.FirstLine)
+}
+
 // ParseError represents an error that occurred while parsing a specific line
 type ParseError struct {
 	Line     int   // The line number where the error occurred
@@ -39,7 +59,25 @@ func (e *ParseError) Error() string {
 // In non-strict mode, Errors may contain multiple parsing errors.
 type ParseResult struct {
 	Object map[string]interface{} // Key-value pairs from the object
+	Keys   []string               // Keys of Object in the order they first appeared
 	Errors []*ParseError          // Any errors encountered during parsing
+	Stats  ParseStats             // Line counts for the whole input
+}
+
+// ParseStats summarizes how the lines of an input were handled. Parsed and
+// Errors count entries, so Parsed+Skipped+Errors equals Lines unless a value
+// spans several lines. A duplicate key reported as an error counts as an
+// error.
+type ParseStats struct {
+	Lines   int // Total lines, not counting the empty one after a final newline
+	Parsed  int // Entries that produced a key and value
+	Skipped int // Empty lines and comments outside of values
+	Errors  int // Entries that failed to parse
+}
+
+// String returns a one-line summary such as "10 lines: 8 parsed, 1 skipped, 1 errors"
+func (s ParseStats) String() string {
+	return fmt.Sprintf("%d lines: %d parsed, %d skipped, %d errors", s.Lines, s.Parsed, s.Skipped, s.Errors)
 }
 
 // LineParser handles parsing of individual lines in LPC object format.
@@ -48,10 +86,13 @@ type ParseResult struct {
 // - Exactly one space between key and value
 // - No tabs
 // - Keys must be valid identifiers
+// Inside an array or mapping, newlines and # comments running to the end of
+// the line are treated as whitespace, so one entry may span several lines.
 type LineParser struct {
-	s   string // input string
-	pos int    // current position in string
-	w   int    // width of last rune read
+	s     string // input string
+	pos   int    // current position in string
+	w     int    // width of last rune read
+	depth int    // number of arrays and mappings currently open
 }
 
 // NewLineParser creates a new parser for a single line
@@ -64,7 +105,11 @@ func NewLineParser(line string) *LineParser {
 }
 
 // ParseObject parses an LPC object from the input string.
-// The input should consist of key-value pairs, one per line.
+// The input should consist of key-value pairs, one per line. A line that
+// leaves an array or mapping open continues onto the following lines until it
+// is closed or a line starts a new entry, so one unclosed value does not take
+// the rest of the file with it; errors are reported at the physical line
+// where they occur.
 // Empty lines and lines starting with # are ignored.
 // Returns error if input is empty or invalid.
 func (p *ObjectParser) ParseObject(input string) (*ParseResult, error) {
@@ -74,25 +119,42 @@ func (p *ObjectParser) ParseObject(input string) (*ParseResult, error) {
 
 	result := &ParseResult{
 		Object: make(map[string]interface{}),
+		Keys:   make([]string, 0),
 		Errors: make([]*ParseError, 0),
 	}
 
 	lines := strings.Split(input, "\n")
+	if strings.HasSuffix(input, "\n") {
+		lines = lines[:len(lines)-1]
+	}
+	result.Stats.Lines = len(lines)
 	startPos := 0
+	firstSeen := make(map[string]int) // key -> line it first appeared on
+
+	for lineNum := 0; lineNum < len(lines); lineNum++ {
+		line := lines[lineNum]
 
-	for lineNum, line := range lines {
 		// Skip empty lines and comments
 		if len(line) == 0 || line[0] == '#' {
+			result.Stats.Skipped++
 			startPos += len(line) + 1 // +1 for newline
 			continue
 		}
 
+		// Join continuation lines until every array and mapping is closed
+		entryLine := lineNum
+		for depth := openValues(line, 0); depth > 0 && lineNum+1 < len(lines) && !startsEntry(lines[lineNum+1]); {
+			lineNum++
+			line += "\n" + lines[lineNum]
+			depth = openValues(lines[lineNum], depth)
+		}
+
 		// Parse key and value
 		lp := NewLineParser(line)
 		key, value, err := lp.ParseLine()
 		if err != nil {
 			parseErr := &ParseError{
-				Line:     lineNum + 1,
+				Line:     entryLine + 1 + strings.Count(line[:lp.pos], "\n"),
 				Position: startPos + lp.pos,
 				Err:      err,
 			}
@@ -101,7 +163,27 @@ func (p *ObjectParser) ParseObject(input string) (*ParseResult, error) {
 				return nil, parseErr
 			}
 			result.Errors = append(result.Errors, parseErr)
+			result.Stats.Errors++
 		} else {
+			if first, ok := firstSeen[key]; !ok {
+				firstSeen[key] = entryLine + 1
+				result.Keys = append(result.Keys, key)
+				result.Stats.Parsed++
+			} else if !p.detectDuplicates {
+				result.Stats.Parsed++
+			} else {
+				dupErr := &ParseError{
+					Line:     entryLine + 1,
+					Position: startPos,
+					Err:      &DuplicateKeyError{Key: key, FirstLine: first},
+				}
+
+				if p.strict {
+					return nil, dupErr
+				}
+				result.Errors = append(result.Errors, dupErr)
+				result.Stats.Errors++
+			}
 			result.Object[key] = value
 		}
 
@@ -115,6 +197,52 @@ func (p *ObjectParser) ParseObject(input string) (*ParseResult, error) {
 	return result, nil
 }
 
+// startsEntry reports whether line begins with a key and a space, as a new
+// entry does. Continuation lines of a value start with a value or a
+// delimiter instead, never a bare identifier.
+func startsEntry(line string) bool {
+	for i, r := range line {
+		switch {
+		case unicode.IsLetter(r):
+		case i > 0 && (unicode.IsDigit(r) || r == '_'):
+		case i > 0 && r == ' ':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// openValues returns the number of arrays and mappings left open at the end
+// of line, given the number open at its start. Strings are skipped, as are #
+// comments within a value.
+func openValues(line string, depth int) int {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++ // skip the escaped character
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '#' && depth > 0:
+			return depth
+		case c == '(' && i+1 < len(line) && (line[i+1] == '{' || line[i+1] == '['):
+			depth++
+			i++
+		case (c == '}' || c == ']') && i+1 < len(line) && line[i+1] == ')':
+			depth--
+			i++
+		}
+	}
+	return depth
+}
+
 // ParseLine parses a single line of LPC object format, returning the key and value.
 // Format rules:
 // - Lines starting with # are treated as comments and skipped
@@ -175,7 +303,7 @@ func (p *LineParser) ParseLine() (string, interface{}, error) {
 // Value types can be:
 // - Strings (double-quoted)
 // - Integers
-// - Floats (with optional hex notation)
+// - Floats (with optional exponent and hex notation)
 // - Arrays
 // - Maps
 // - nil
@@ -221,6 +349,8 @@ func (p *LineParser) parseArray() ([]interface{}, error) {
 	if !p.match("({") {
 		return nil, fmt.Errorf("error in array: expected '({' at position %d", p.pos)
 	}
+	p.depth++
+	defer func() { p.depth-- }()
 
 	// Parse size
 	size, err := p.parseInt()
@@ -300,6 +430,8 @@ func (p *LineParser) parseMap() (map[string]interface{}, error) {
 	if !p.match("([") {
 		return nil, fmt.Errorf("error in map: expected '([' at position %d", p.pos)
 	}
+	p.depth++
+	defer func() { p.depth-- }()
 
 	// Parse size
 	size, err := p.parseInt()
@@ -414,6 +546,8 @@ func (p *LineParser) parseMapEntry() (string, interface{}, bool, error) {
 		key = v
 	case int:
 		key = strconv.Itoa(v)
+	case int64:
+		key = strconv.FormatInt(v, 10)
 	case float64:
 		key = strconv.FormatFloat(v, 'f', -1, 64)
 	case []interface{}, map[string]interface{}:
@@ -448,8 +582,9 @@ func (p *LineParser) parseMapEntry() (string, interface{}, bool, error) {
 }
 
 // ParseNumber parses either an integer or float value.
-// Floats may include hex notation after = sign.
-// Format: [-]digits[.digits][=hexdigits]
+// Floats may use exponent notation and include hex notation after = sign.
+// Plain digits with none of these are always integers.
+// Format: [-]digits[.digits][e[+-]digits][=hexdigits]
 func (p *LineParser) parseNumber() (interface{}, error) {
 	// Look ahead to see if this is a float
 	offset := 0
@@ -460,15 +595,38 @@ func (p *LineParser) parseNumber() (interface{}, error) {
 	for unicode.IsDigit(p.peek(offset)) {
 		offset++
 	}
-	// Check for decimal point or hex notation
-	if p.peek(offset) == '.' || p.peek(offset) == '=' {
+	// Check for decimal point, exponent or hex notation
+	if p.peek(offset) == '.' || p.peek(offset) == '=' || p.exponentLen(offset) > 0 {
 		return p.parseFloat()
 	}
-	return p.parseInt()
+
+	n, err := p.parseInt64()
+	if err != nil {
+		return nil, err
+	}
+	// Integers are ints unless they only fit in 64 bits, which happens on
+	// 32-bit platforms for large counters and timestamps
+	if int64(int(n)) != n {
+		return n, nil
+	}
+	return int(n), nil
 }
 
-// ParseInt parses an integer from the input string
+// ParseInt parses an integer that must fit in an int, such as a size prefix
 func (p *LineParser) parseInt() (int, error) {
+	start := p.pos
+	n, err := p.parseInt64()
+	if err != nil {
+		return 0, err
+	}
+	if int64(int(n)) != n {
+		return 0, fmt.Errorf("error in integer: %s is out of range at position %d", p.s[start:p.pos], p.pos)
+	}
+	return int(n), nil
+}
+
+// parseInt64 parses a 64-bit integer from the input string
+func (p *LineParser) parseInt64() (int64, error) {
 	start := p.pos
 	if p.peek(0) == '-' {
 		p.next()
@@ -477,8 +635,11 @@ func (p *LineParser) parseInt() (int, error) {
 		p.next()
 	}
 
-	result, err := strconv.Atoi(p.s[start:p.pos])
+	result, err := strconv.ParseInt(p.s[start:p.pos], 10, 64)
 	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, fmt.Errorf("error in integer: %s is out of range at position %d", p.s[start:p.pos], p.pos)
+		}
 		return 0, fmt.Errorf("error in integer: invalid number at position %d", p.pos)
 	}
 	return result, nil
@@ -514,11 +675,18 @@ func (p *LineParser) expect(r rune) bool {
 	return false
 }
 
-// SkipSpaces skips any whitespace characters
+// SkipSpaces skips any whitespace characters. Inside an array or mapping it
+// also skips newlines and # comments.
 func (p *LineParser) skipSpaces() {
 	for {
 		r := p.peek(0)
-		if r != ' ' && r != '\t' {
+		if p.depth > 0 && r == '#' {
+			for r != '\n' && r != 0 {
+				p.next()
+				r = p.peek(0)
+			}
+		}
+		if r != ' ' && r != '\t' && (p.depth == 0 || r != '\n') {
 			break
 		}
 		p.next()
@@ -527,6 +695,9 @@ func (p *LineParser) skipSpaces() {
 
 // match checks if the next runes match the given string and advances the position if they do
 func (p *LineParser) match(s string) bool {
+	if p.pos+len(s) > len(p.s) {
+		return false
+	}
 	if p.s[p.pos:p.pos+len(s)] == s {
 		p.pos += len(s)
 		return true
@@ -534,9 +705,29 @@ func (p *LineParser) match(s string) bool {
 	return false
 }
 
-// parseFloat parses a float value, optionally with hex notation.
-// Format: [-]digits[.digits][=hexdigits]
-// The hex part represents the IEEE 754 bits of the float.
+// exponentLen returns the length of the exponent (e or E, an optional sign
+// and at least one digit) starting offset runes ahead, or 0 if there is none
+func (p *LineParser) exponentLen(offset int) int {
+	if r := p.peek(offset); r != 'e' && r != 'E' {
+		return 0
+	}
+	n := 1
+	if r := p.peek(offset + n); r == '+' || r == '-' {
+		n++
+	}
+	if !unicode.IsDigit(p.peek(offset + n)) {
+		return 0
+	}
+	for unicode.IsDigit(p.peek(offset + n)) {
+		n++
+	}
+	return n
+}
+
+// parseFloat parses a float value, optionally with exponent and hex notation.
+// Format: [-]digits[.digits][e[+-]digits][=hexdigits]
+// The hex part represents the IEEE 754 bits of the float. A bare integer
+// such as 42 is accepted as a float when it carries the hex part.
 func (p *LineParser) parseFloat() (float64, error) {
 	start := p.pos
 
@@ -566,9 +757,13 @@ func (p *LineParser) parseFloat() (float64, error) {
 		}
 	}
 
-	// If no decimal point or hex notation, it must have hex notation
-	if p.peek(0) != '=' && !strings.Contains(p.s[start:p.pos], ".") {
-		return 0, fmt.Errorf("float value must contain a decimal point or hex representation at position %d", p.pos)
+	// Parse optional exponent
+	exponent := p.exponentLen(0)
+	p.pos += exponent
+
+	// Without a decimal point or exponent, it must have hex notation
+	if exponent == 0 && p.peek(0) != '=' && !strings.Contains(p.s[start:p.pos], ".") {
+		return 0, fmt.Errorf("float value must contain a decimal point, exponent or hex representation at position %d", p.pos)
 	}
 
 	floatStr := p.s[start:p.pos]
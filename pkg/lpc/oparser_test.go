@@ -1,6 +1,7 @@
 package lpc
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -119,6 +120,182 @@ another bad line`,
 	})
 }
 
+func TestDuplicateKeys(t *testing.T) {
+	input := `name "Drake"
+level 30
+title "wizard"
+level 31`
+
+	t.Run("Ignored By Default", func(t *testing.T) {
+		got, err := NewObjectParser(true).ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		if got.Object["level"] != 31 {
+			t.Errorf("level = %v, want 31", got.Object["level"])
+		}
+	})
+
+	t.Run("Strict Mode", func(t *testing.T) {
+		p := NewObjectParser(true)
+		p.SetDetectDuplicates(true)
+
+		_, err := p.ParseObject(input)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("ParseObject() error = %v, want *ParseError", err)
+		}
+		var dupErr *DuplicateKeyError
+		if !errors.As(parseErr.Err, &dupErr) {
+			t.Fatalf("ParseError.Err = %v, want *DuplicateKeyError", parseErr.Err)
+		}
+		if parseErr.Line != 4 || dupErr.FirstLine != 2 || dupErr.Key != "level" {
+			t.Errorf("got key %q at line %d (first %d), want level at line 4 (first 2)", dupErr.Key, parseErr.Line, dupErr.FirstLine)
+		}
+	})
+
+	t.Run("Non-Strict Mode", func(t *testing.T) {
+		p := NewObjectParser(false)
+		p.SetDetectDuplicates(true)
+
+		got, err := p.ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		if len(got.Errors) != 1 {
+			t.Fatalf("ParseObject() error count = %d, want 1", len(got.Errors))
+		}
+		if want := `Format error at line 4: duplicate key "level" (first seen at line 2)`; got.Errors[0].Error() != want {
+			t.Errorf("error = %q, want %q", got.Errors[0].Error(), want)
+		}
+		// The last value wins
+		if got.Object["level"] != 31 {
+			t.Errorf("level = %v, want 31", got.Object["level"])
+		}
+	})
+}
+
+func TestKeyOrder(t *testing.T) {
+	input := `# Keys deliberately out of alphabetical order
+password "xyz"
+level 30
+invalid line
+cap_name "Drake"
+gender 1
+level 31
+alias ([1|"l":"look"])`
+
+	got, err := NewObjectParser(false).ParseObject(input)
+	if err != nil {
+		t.Fatalf("ParseObject() error = %v", err)
+	}
+
+	// Invalid lines are skipped and repeated keys keep their first position
+	want := []string{"password", "level", "cap_name", "gender", "alias"}
+	if !reflect.DeepEqual(got.Keys, want) {
+		t.Errorf("Keys = %v, want %v", got.Keys, want)
+	}
+	if len(got.Keys) != len(got.Object) {
+		t.Errorf("len(Keys) = %d, len(Object) = %d", len(got.Keys), len(got.Object))
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	input := `# A character with some damage
+password "xyz"
+level 30
+
+invalid line
+cap_name "Drake"
+level 31
+gender
+`
+
+	t.Run("Default", func(t *testing.T) {
+		got, err := NewObjectParser(false).ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		want := ParseStats{Lines: 8, Parsed: 4, Skipped: 2, Errors: 2}
+		if got.Stats != want {
+			t.Errorf("Stats = %+v, want %+v", got.Stats, want)
+		}
+		if got.Stats.Errors != len(got.Errors) {
+			t.Errorf("Stats.Errors = %d, len(Errors) = %d", got.Stats.Errors, len(got.Errors))
+		}
+		if s := got.Stats.String(); s != "8 lines: 4 parsed, 2 skipped, 2 errors" {
+			t.Errorf("String() = %q", s)
+		}
+	})
+
+	t.Run("DetectDuplicates", func(t *testing.T) {
+		p := NewObjectParser(false)
+		p.SetDetectDuplicates(true)
+		got, err := p.ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		want := ParseStats{Lines: 8, Parsed: 3, Skipped: 2, Errors: 3}
+		if got.Stats != want {
+			t.Errorf("Stats = %+v, want %+v", got.Stats, want)
+		}
+	})
+}
+
+// asInt64 converts a parsed integer to int64, whichever type it was given as
+func asInt64(t *testing.T, v interface{}) int64 {
+	t.Helper()
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	default:
+		t.Fatalf("value %v has type %T, want an integer", v, v)
+		return 0
+	}
+}
+
+func TestLargeIntegers(t *testing.T) {
+	input := `last_login 4102444800
+experience -3000000000
+max 9223372036854775807
+kills ([1|5000000000:12])`
+
+	got, err := NewObjectParser(true).ParseObject(input)
+	if err != nil {
+		t.Fatalf("ParseObject() error = %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want int64
+	}{
+		{"last_login", 4102444800},
+		{"experience", -3000000000},
+		{"max", 9223372036854775807},
+	}
+	for _, tt := range tests {
+		if n := asInt64(t, got.Object[tt.key]); n != tt.want {
+			t.Errorf("%s = %d, want %d", tt.key, n, tt.want)
+		}
+	}
+
+	kills, ok := got.Object["kills"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("kills has type %T, want map", got.Object["kills"])
+	}
+	if n := asInt64(t, kills["5000000000"]); n != 12 {
+		t.Errorf("kills[5000000000] = %d, want 12", n)
+	}
+
+	// Beyond int64 is an error rather than a silently wrong value
+	_, err = NewObjectParser(true).ParseObject("max 9223372036854775808")
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("ParseObject() error = %v, want out of range error", err)
+	}
+}
+
 // Line Parsing Tests
 
 func TestLineParsing(t *testing.T) {
@@ -247,6 +424,115 @@ func TestLineParsing(t *testing.T) {
 
 }
 
+func TestMultiLineValues(t *testing.T) {
+	t.Run("Array", func(t *testing.T) {
+		input := `name "frodo"
+items ({3|"ring",
+  "sting", # a comment
+  "mithril"})
+level 1`
+		got, err := NewObjectParser(true).ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		want := map[string]interface{}{
+			"name":  "frodo",
+			"items": []interface{}{"ring", "sting", "mithril"},
+			"level": 1,
+		}
+		if !reflect.DeepEqual(got.Object, want) {
+			t.Errorf("Object = %v, want %v", got.Object, want)
+		}
+		if want := (ParseStats{Lines: 5, Parsed: 3}); got.Stats != want {
+			t.Errorf("Stats = %+v, want %+v", got.Stats, want)
+		}
+	})
+
+	t.Run("NestedMap", func(t *testing.T) {
+		input := `access ([2|
+"frodo":({1|"#not a comment"}),
+"sam":([1|"*":3])])`
+		got, err := NewObjectParser(true).ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		want := map[string]interface{}{
+			"frodo": []interface{}{"#not a comment"},
+			"sam":   map[string]interface{}{"*": 3},
+		}
+		if !reflect.DeepEqual(got.Object["access"], want) {
+			t.Errorf("access = %v, want %v", got.Object["access"], want)
+		}
+	})
+
+	t.Run("ErrorLine", func(t *testing.T) {
+		input := `name "frodo"
+items ({3|"ring",
+  "sting" "oops",
+  "mithril"})
+level 1`
+		got, err := NewObjectParser(false).ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		if len(got.Errors) != 1 {
+			t.Fatalf("Errors = %v, want 1 error", got.Errors)
+		}
+		if got.Errors[0].Line != 3 {
+			t.Errorf("Error line = %d, want 3", got.Errors[0].Line)
+		}
+		// Lines after the broken value are still parsed
+		if got.Object["level"] != 1 {
+			t.Errorf("level = %v, want 1", got.Object["level"])
+		}
+	})
+
+	t.Run("UnclosedBeforeNextEntry", func(t *testing.T) {
+		// One corrupt value must not swallow the entries after it
+		input := `name "frodo"
+quests ({"a","b",
+level 31
+password "x1/Ab"`
+		got, err := NewObjectParser(false).ParseObject(input)
+		if err != nil {
+			t.Fatalf("ParseObject() error = %v", err)
+		}
+		want := map[string]interface{}{
+			"name":     "frodo",
+			"level":    31,
+			"password": "x1/Ab",
+		}
+		if !reflect.DeepEqual(got.Object, want) {
+			t.Errorf("Object = %v, want %v", got.Object, want)
+		}
+		if len(got.Errors) != 1 || got.Errors[0].Line != 2 {
+			t.Errorf("Errors = %v, want one error on line 2", got.Errors)
+		}
+	})
+
+	t.Run("Unterminated", func(t *testing.T) {
+		_, err := NewObjectParser(true).ParseObject("items ({2|\"ring\",\n\"sting\",\n")
+		if err == nil {
+			t.Error("Expected error for unterminated array")
+		}
+	})
+}
+
+func TestTruncatedInput(t *testing.T) {
+	// Values cut off at end of input must be errors, not slice panics
+	for _, input := range []string{"({", "([", "n", "ni", "({1|", "([1|\"a\":", "({1|n"} {
+		t.Run(input, func(t *testing.T) {
+			lp := NewLineParser("key " + input)
+			if _, _, err := lp.ParseLine(); err == nil {
+				t.Errorf("ParseLine(%q) expected error", input)
+			}
+			if _, err := NewObjectParser(true).ParseObject("key " + input); err == nil {
+				t.Errorf("ParseObject(%q) expected error", input)
+			}
+		})
+	}
+}
+
 // Value Parsing Tests
 
 func TestValueParsing(t *testing.T) {
@@ -398,6 +684,31 @@ func TestValueParsing(t *testing.T) {
 				input: "-3.14",
 				want:  -3.14,
 			},
+			{
+				name:  "Exponent Float",
+				input: "1e10",
+				want:  1e10,
+			},
+			{
+				name:  "Fraction With Negative Exponent",
+				input: "2.5e-3",
+				want:  2.5e-3,
+			},
+			{
+				name:  "Uppercase Exponent With Sign",
+				input: "-1.5E+2",
+				want:  -150.0,
+			},
+			{
+				name:  "Exponent With Hex",
+				input: "1e2=4059000000000000",
+				want:  100.0,
+			},
+			{
+				name:  "Exponent Without Digits Stays Integer",
+				input: "1e",
+				want:  1,
+			},
 			// Hex notation
 			{
 				name:  "Float With Hex",
@@ -0,0 +1,141 @@
+// Package metrics exposes server counters in the Prometheus text exposition format.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+	"github.com/mmcdole/viking-ftpd/pkg/status"
+)
+
+// Counter is a monotonically increasing value that is safe for concurrent use
+type Counter struct {
+	value atomic.Int64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+// Value returns the current counter value
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+var (
+	// LoginSuccesses counts successful authentications
+	LoginSuccesses Counter
+	// LoginFailures counts failed authentications
+	LoginFailures Counter
+	// BytesRead counts bytes read from files served to clients (downloads)
+	BytesRead Counter
+	// BytesWritten counts bytes written to files by clients (uploads)
+	BytesWritten Counter
+	// AuthCacheHits counts authentications answered from the authenticator cache
+	AuthCacheHits Counter
+	// AuthorizerRefreshes counts reloads of the access tree
+	AuthorizerRefreshes Counter
+)
+
+// Server serves the /metrics endpoint over HTTP
+type Server struct {
+	addr     string
+	provider status.MetricsProvider
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewServer creates a metrics server listening on addr. The provider supplies
+// connection gauges and may be nil.
+func NewServer(addr string, provider status.MetricsProvider) *Server {
+	s := &Server{
+		addr:     addr,
+		provider: provider,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Start binds the listen address and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.addr, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.App.Error("Metrics server error", "error", err)
+		}
+	}()
+
+	logging.App.Info("Started metrics server", "addr", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the address the server is listening on, or the configured
+// address if it has not been started
+func (s *Server) Addr() string {
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.addr
+}
+
+// Shutdown stops the server, waiting for in-flight scrapes to finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// handleMetrics writes all metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteMetrics(w, s.provider)
+}
+
+// WriteMetrics writes all metrics in the Prometheus text format
+func WriteMetrics(w io.Writer, provider status.MetricsProvider) {
+	if provider != nil {
+		writeMetric(w, "vkftpd_active_connections", "gauge", "Number of active FTP connections.", provider.GetActiveConnections())
+		writeMetric(w, "vkftpd_connections_total", "counter", "Total FTP connections since start.", provider.GetTotalConnections())
+		if startTime := provider.GetStartTime(); !startTime.IsZero() {
+			writeMetric(w, "vkftpd_uptime_seconds", "gauge", "Seconds since the server started.", int64(time.Since(startTime).Seconds()))
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP vkftpd_logins_total Total login attempts by result.\n# TYPE vkftpd_logins_total counter\n")
+	fmt.Fprintf(w, "vkftpd_logins_total{result=\"success\"} %d\n", LoginSuccesses.Value())
+	fmt.Fprintf(w, "vkftpd_logins_total{result=\"failure\"} %d\n", LoginFailures.Value())
+
+	fmt.Fprintf(w, "# HELP vkftpd_transferred_bytes_total Total bytes transferred by direction.\n# TYPE vkftpd_transferred_bytes_total counter\n")
+	fmt.Fprintf(w, "vkftpd_transferred_bytes_total{direction=\"download\"} %d\n", BytesRead.Value())
+	fmt.Fprintf(w, "vkftpd_transferred_bytes_total{direction=\"upload\"} %d\n", BytesWritten.Value())
+
+	writeMetric(w, "vkftpd_auth_cache_hits_total", "counter", "Authentications answered from the cache.", AuthCacheHits.Value())
+	writeMetric(w, "vkftpd_authorizer_refreshes_total", "counter", "Access tree reloads.", AuthorizerRefreshes.Value())
+}
+
+// writeMetric writes a single unlabeled metric with its HELP and TYPE lines
+func writeMetric(w io.Writer, name, metricType, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, metricType, name, value)
+}
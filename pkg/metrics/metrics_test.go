@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockMetricsProvider implements status.MetricsProvider for testing
+type mockMetricsProvider struct {
+	activeConnections int32
+	totalConnections  int64
+	connectionsByUser map[string]int
+	connectionsByIP   map[string]int
+	startTime         time.Time
+}
+
+func (m *mockMetricsProvider) GetActiveConnections() int32 {
+	return m.activeConnections
+}
+
+func (m *mockMetricsProvider) GetTotalConnections() int64 {
+	return m.totalConnections
+}
+
+func (m *mockMetricsProvider) GetConnectionsByUser() map[string]int {
+	return m.connectionsByUser
+}
+
+func (m *mockMetricsProvider) GetConnectionsByIP() map[string]int {
+	return m.connectionsByIP
+}
+
+func (m *mockMetricsProvider) GetStartTime() time.Time {
+	return m.startTime
+}
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	c.Inc()
+	c.Add(41)
+	if got := c.Value(); got != 42 {
+		t.Errorf("Expected counter value 42, got %d", got)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	provider := &mockMetricsProvider{
+		activeConnections: 3,
+		totalConnections:  17,
+		startTime:         time.Now().Add(-time.Minute),
+	}
+
+	var b strings.Builder
+	WriteMetrics(&b, provider)
+	output := b.String()
+
+	expected := []string{
+		"# TYPE vkftpd_active_connections gauge",
+		"vkftpd_active_connections 3",
+		"# TYPE vkftpd_connections_total counter",
+		"vkftpd_connections_total 17",
+		"vkftpd_uptime_seconds ",
+		`vkftpd_logins_total{result="success"} `,
+		`vkftpd_logins_total{result="failure"} `,
+		`vkftpd_transferred_bytes_total{direction="download"} `,
+		`vkftpd_transferred_bytes_total{direction="upload"} `,
+		"vkftpd_auth_cache_hits_total ",
+		"vkftpd_authorizer_refreshes_total ",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestWriteMetricsWithoutProvider(t *testing.T) {
+	var b strings.Builder
+	WriteMetrics(&b, nil)
+	output := b.String()
+
+	if strings.Contains(output, "vkftpd_active_connections") {
+		t.Error("Expected no connection gauges without a provider")
+	}
+	if !strings.Contains(output, "vkftpd_logins_total") {
+		t.Error("Expected login counters without a provider")
+	}
+}
+
+func TestServer(t *testing.T) {
+	provider := &mockMetricsProvider{activeConnections: 2, startTime: time.Now()}
+	server := NewServer("127.0.0.1:0", provider)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start metrics server: %v", err)
+	}
+
+	resp, err := http.Get("http://" + server.Addr() + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "vkftpd_active_connections 2") {
+		t.Errorf("Expected active connections gauge, got:\n%s", body)
+	}
+	if !strings.Contains(string(body), `vkftpd_logins_total{result="success"} `) {
+		t.Errorf("Expected login success counter, got:\n%s", body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down metrics server: %v", err)
+	}
+
+	if _, err := http.Get("http://" + server.Addr() + "/metrics"); err == nil {
+		t.Error("Expected scrape to fail after shutdown")
+	}
+}
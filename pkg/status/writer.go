@@ -1,10 +1,13 @@
 package status
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,16 +18,49 @@ import (
 type MetricsProvider interface {
 	GetActiveConnections() int32
 	GetTotalConnections() int64
+	GetConnectionsByUser() map[string]int
+	GetConnectionsByIP() map[string]int
 	GetStartTime() time.Time
 }
 
+// AccessProvider reports when the access file was last loaded. LastRefresh
+// returns a zero time if it never loaded, and the error of the most recent
+// load attempt.
+type AccessProvider interface {
+	LastRefresh() (time.Time, error)
+}
+
+// Format selects how status files are encoded
+type Format string
+
+const (
+	// FormatText writes one "key: value" pair per line (default)
+	FormatText Format = "text"
+	// FormatJSON writes a single JSON object with the same keys
+	FormatJSON Format = "json"
+)
+
+// ParseFormat converts a format name into a Format. An empty name selects FormatText.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown status format %q (expected %q or %q)", name, FormatText, FormatJSON)
+	}
+}
+
 // Writer manages status files for daemon health monitoring
 type Writer struct {
 	dir             string
 	updateInterval  time.Duration
 	pid             int
 	version         string
+	format          Format
 	metricsProvider MetricsProvider
+	accessProvider  AccessProvider
 
 	stopCh       chan struct{}
 	wg           sync.WaitGroup
@@ -43,6 +79,7 @@ func New(dir string, updateInterval time.Duration, version string) (*Writer, err
 		updateInterval: updateInterval,
 		pid:            os.Getpid(),
 		version:        version,
+		format:         FormatText,
 		stopCh:         make(chan struct{}),
 	}, nil
 }
@@ -52,22 +89,31 @@ func (w *Writer) SetMetricsProvider(provider MetricsProvider) {
 	w.metricsProvider = provider
 }
 
+// SetAccessProvider sets the source of access file reload times
+func (w *Writer) SetAccessProvider(provider AccessProvider) {
+	w.accessProvider = provider
+}
+
+// SetFormat sets the encoding used for status files
+func (w *Writer) SetFormat(format Format) {
+	w.format = format
+}
+
 // WriteStartFile writes the last_start file with startup information
 func (w *Writer) WriteStartFile() error {
 	now := time.Now()
-	content := fmt.Sprintf(`timestamp_unix: %d
-timestamp_human: %s
-pid: %d
-version: %s
-`,
-		now.Unix(),
-		now.Format("Mon Jan 02 15:04:05 2006"),
-		w.pid,
-		w.version,
-	)
+	content, err := w.encode(report{
+		{"timestamp_unix", now.Unix()},
+		{"timestamp_human", now.Format("Mon Jan 02 15:04:05 2006")},
+		{"pid", w.pid},
+		{"version", w.version},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode last_start: %w", err)
+	}
 
 	path := filepath.Join(w.dir, "last_start")
-	if err := w.atomicWrite(path, []byte(content)); err != nil {
+	if err := w.atomicWrite(path, content); err != nil {
 		return fmt.Errorf("failed to write last_start: %w", err)
 	}
 
@@ -78,19 +124,18 @@ version: %s
 // WriteStopFile writes the last_stop file with shutdown information
 func (w *Writer) WriteStopFile(reason string, uptime time.Duration) error {
 	now := time.Now()
-	content := fmt.Sprintf(`timestamp_unix: %d
-timestamp_human: %s
-reason: %s
-uptime_seconds: %d
-`,
-		now.Unix(),
-		now.Format("Mon Jan 02 15:04:05 2006"),
-		reason,
-		int64(uptime.Seconds()),
-	)
+	content, err := w.encode(report{
+		{"timestamp_unix", now.Unix()},
+		{"timestamp_human", now.Format("Mon Jan 02 15:04:05 2006")},
+		{"reason", reason},
+		{"uptime_seconds", int64(uptime.Seconds())},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode last_stop: %w", err)
+	}
 
 	path := filepath.Join(w.dir, "last_stop")
-	if err := w.atomicWrite(path, []byte(content)); err != nil {
+	if err := w.atomicWrite(path, content); err != nil {
 		return fmt.Errorf("failed to write last_stop: %w", err)
 	}
 
@@ -167,11 +212,19 @@ func (w *Writer) writeRunningFile() error {
 	var startTime time.Time
 	var activeConnections int32
 	var totalConnections int64
+	connectionsByUser := map[string]int{}
+	connectionsByIP := map[string]int{}
 
 	if w.metricsProvider != nil {
 		startTime = w.metricsProvider.GetStartTime()
 		activeConnections = w.metricsProvider.GetActiveConnections()
 		totalConnections = w.metricsProvider.GetTotalConnections()
+		if byUser := w.metricsProvider.GetConnectionsByUser(); byUser != nil {
+			connectionsByUser = byUser
+		}
+		if byIP := w.metricsProvider.GetConnectionsByIP(); byIP != nil {
+			connectionsByIP = byIP
+		}
 	}
 
 	uptime := int64(0)
@@ -179,31 +232,43 @@ func (w *Writer) writeRunningFile() error {
 		uptime = int64(now.Sub(startTime).Seconds())
 	}
 
+	// Zero and empty until an access provider reports a load
+	accessRefreshed := int64(0)
+	accessError := ""
+	if w.accessProvider != nil {
+		lastRefresh, err := w.accessProvider.LastRefresh()
+		if !lastRefresh.IsZero() {
+			accessRefreshed = lastRefresh.Unix()
+		}
+		if err != nil {
+			accessError = err.Error()
+		}
+	}
+
 	// Collect memory statistics
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	content := fmt.Sprintf(`timestamp_unix: %d
-uptime_seconds: %d
-active_connections: %d
-total_connections: %d
-memory_alloc_mb: %d
-memory_sys_mb: %d
-goroutines: %d
-gc_cpu_fraction: %.6f
-`,
-		now.Unix(),
-		uptime,
-		activeConnections,
-		totalConnections,
-		memStats.Alloc/1024/1024,
-		memStats.Sys/1024/1024,
-		runtime.NumGoroutine(),
-		memStats.GCCPUFraction,
-	)
+	content, err := w.encode(report{
+		{"timestamp_unix", now.Unix()},
+		{"uptime_seconds", uptime},
+		{"active_connections", activeConnections},
+		{"total_connections", totalConnections},
+		{"connections_by_user", connectionsByUser},
+		{"connections_by_ip", connectionsByIP},
+		{"memory_alloc_mb", memStats.Alloc / 1024 / 1024},
+		{"memory_sys_mb", memStats.Sys / 1024 / 1024},
+		{"goroutines", runtime.NumGoroutine()},
+		{"gc_cpu_fraction", memStats.GCCPUFraction},
+		{"access_refreshed_unix", accessRefreshed},
+		{"access_refresh_error", accessError},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode running: %w", err)
+	}
 
 	path := filepath.Join(w.dir, "running")
-	if err := w.atomicWrite(path, []byte(content)); err != nil {
+	if err := w.atomicWrite(path, content); err != nil {
 		return fmt.Errorf("failed to write running: %w", err)
 	}
 
@@ -211,6 +276,72 @@ gc_cpu_fraction: %.6f
 	return nil
 }
 
+// field is a single key/value entry in a status file
+type field struct {
+	key   string
+	value interface{}
+}
+
+// report is the ordered set of fields written to a status file. The same
+// report is encoded as text or JSON so both formats always carry identical keys.
+type report []field
+
+// encode renders a report in the writer's configured format
+func (w *Writer) encode(r report) ([]byte, error) {
+	if w.format == FormatJSON {
+		return r.marshalJSON()
+	}
+	return r.marshalText(), nil
+}
+
+// marshalText renders the report as "key: value" lines. Breakdown maps are
+// written as a bare "key:" line followed by indented, sorted entries.
+func (r report) marshalText() []byte {
+	var b bytes.Buffer
+	for _, f := range r {
+		switch v := f.value.(type) {
+		case float64:
+			fmt.Fprintf(&b, "%s: %.6f\n", f.key, v)
+		case map[string]int:
+			fmt.Fprintf(&b, "%s:\n", f.key)
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(&b, "  %s: %d\n", k, v[k])
+			}
+		default:
+			fmt.Fprintf(&b, "%s: %v\n", f.key, f.value)
+		}
+	}
+	return b.Bytes()
+}
+
+// marshalJSON renders the report as a JSON object, preserving field order
+func (r report) marshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, f := range r {
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.MarshalIndent(f.value, "  ", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "  %s: %s", key, value)
+		if i < len(r)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
 // atomicWrite writes content to a file atomically by writing to a temp file
 // and then renaming it. This prevents readers from seeing partial writes.
 func (w *Writer) atomicWrite(path string, content []byte) error {
@@ -1,6 +1,8 @@
 package status
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,6 +14,8 @@ import (
 type mockMetricsProvider struct {
 	activeConnections int32
 	totalConnections  int64
+	connectionsByUser map[string]int
+	connectionsByIP   map[string]int
 	startTime         time.Time
 }
 
@@ -23,6 +27,14 @@ func (m *mockMetricsProvider) GetTotalConnections() int64 {
 	return m.totalConnections
 }
 
+func (m *mockMetricsProvider) GetConnectionsByUser() map[string]int {
+	return m.connectionsByUser
+}
+
+func (m *mockMetricsProvider) GetConnectionsByIP() map[string]int {
+	return m.connectionsByIP
+}
+
 func (m *mockMetricsProvider) GetStartTime() time.Time {
 	return m.startTime
 }
@@ -189,6 +201,54 @@ func TestWriteRunningFile(t *testing.T) {
 	}
 }
 
+// mockAccessProvider implements AccessProvider for testing
+type mockAccessProvider struct {
+	lastRefresh time.Time
+	err         error
+}
+
+func (m *mockAccessProvider) LastRefresh() (time.Time, error) {
+	return m.lastRefresh, m.err
+}
+
+func TestAccessProvider(t *testing.T) {
+	refreshed := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		provider *mockAccessProvider
+		want     []string
+	}{
+		{"Loaded", &mockAccessProvider{lastRefresh: refreshed}, []string{"access_refreshed_unix: 1700000000", "access_refresh_error: \n"}},
+		{"ReloadFailing", &mockAccessProvider{lastRefresh: refreshed, err: errors.New("access_map is empty")}, []string{"access_refreshed_unix: 1700000000", "access_refresh_error: access_map is empty"}},
+		{"NeverLoaded", &mockAccessProvider{err: errors.New("no such file")}, []string{"access_refreshed_unix: 0", "access_refresh_error: no such file"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			w, err := New(tmpDir, 10*time.Second, "v1.0.0")
+			if err != nil {
+				t.Fatalf("Failed to create writer: %v", err)
+			}
+			w.SetAccessProvider(tt.provider)
+
+			if err := w.writeRunningFile(); err != nil {
+				t.Fatalf("Failed to write running file: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(tmpDir, "running"))
+			if err != nil {
+				t.Fatalf("Failed to read running file: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("Running file missing %q:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
+
 func TestHeartbeat(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -458,3 +518,191 @@ func TestShutdownWithoutMetricsProvider(t *testing.T) {
 		t.Error("Stop file missing correct reason")
 	}
 }
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{"", FormatText, false},
+		{"text", FormatText, false},
+		{"json", FormatJSON, false},
+		{"yaml", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFormat(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	w, err := New(tmpDir, 10*time.Second, "v1.2.3")
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	w.SetFormat(FormatJSON)
+	w.SetMetricsProvider(&mockMetricsProvider{
+		activeConnections: 5,
+		totalConnections:  42,
+		startTime:         time.Now().Add(-1 * time.Hour),
+	})
+
+	if err := w.WriteStartFile(); err != nil {
+		t.Fatalf("Failed to write start file: %v", err)
+	}
+	if err := w.writeRunningFile(); err != nil {
+		t.Fatalf("Failed to write running file: %v", err)
+	}
+	if err := w.WriteStopFile("test_reason", 90*time.Second); err != nil {
+		t.Fatalf("Failed to write stop file: %v", err)
+	}
+
+	readJSON := func(name string) map[string]interface{} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(content, &fields); err != nil {
+			t.Fatalf("Failed to parse %s as JSON: %v\n%s", name, err, content)
+		}
+		return fields
+	}
+
+	start := readJSON("last_start")
+	if start["version"] != "v1.2.3" {
+		t.Errorf("Expected version v1.2.3, got %v", start["version"])
+	}
+	if start["pid"] != float64(os.Getpid()) {
+		t.Errorf("Expected pid %d, got %v", os.Getpid(), start["pid"])
+	}
+
+	running := readJSON("running")
+	for _, key := range []string{"timestamp_unix", "uptime_seconds", "active_connections", "total_connections", "memory_alloc_mb", "memory_sys_mb", "goroutines", "gc_cpu_fraction"} {
+		if _, ok := running[key]; !ok {
+			t.Errorf("Running file missing field: %s", key)
+		}
+	}
+	if running["active_connections"] != float64(5) {
+		t.Errorf("Expected active_connections 5, got %v", running["active_connections"])
+	}
+	if uptime, _ := running["uptime_seconds"].(float64); uptime < 3600 {
+		t.Errorf("Expected uptime of at least 3600 seconds, got %v", running["uptime_seconds"])
+	}
+
+	stop := readJSON("last_stop")
+	if stop["reason"] != "test_reason" {
+		t.Errorf("Expected reason test_reason, got %v", stop["reason"])
+	}
+	if stop["uptime_seconds"] != float64(90) {
+		t.Errorf("Expected uptime_seconds 90, got %v", stop["uptime_seconds"])
+	}
+}
+
+func TestConnectionBreakdown(t *testing.T) {
+	mock := &mockMetricsProvider{
+		activeConnections: 4,
+		totalConnections:  10,
+		connectionsByUser: map[string]int{"frodo": 2, "aragorn": 1},
+		connectionsByIP:   map[string]int{"10.0.0.2": 1, "10.0.0.1": 3},
+		startTime:         time.Now(),
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		w, err := New(tmpDir, 10*time.Second, "v1.0.0")
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		w.SetMetricsProvider(mock)
+
+		if err := w.writeRunningFile(); err != nil {
+			t.Fatalf("Failed to write running file: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "running"))
+		if err != nil {
+			t.Fatalf("Failed to read running file: %v", err)
+		}
+
+		// Entries are indented under their heading and sorted by key
+		expected := []string{
+			"connections_by_user:\n  aragorn: 1\n  frodo: 2\n",
+			"connections_by_ip:\n  10.0.0.1: 3\n  10.0.0.2: 1\n",
+		}
+		for _, want := range expected {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("Running file missing block:\n%s\ngot:\n%s", want, content)
+			}
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		w, err := New(tmpDir, 10*time.Second, "v1.0.0")
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		w.SetFormat(FormatJSON)
+		w.SetMetricsProvider(mock)
+
+		if err := w.writeRunningFile(); err != nil {
+			t.Fatalf("Failed to write running file: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "running"))
+		if err != nil {
+			t.Fatalf("Failed to read running file: %v", err)
+		}
+
+		var running struct {
+			ConnectionsByUser map[string]int `json:"connections_by_user"`
+			ConnectionsByIP   map[string]int `json:"connections_by_ip"`
+		}
+		if err := json.Unmarshal(content, &running); err != nil {
+			t.Fatalf("Failed to parse running file: %v\n%s", err, content)
+		}
+
+		if len(running.ConnectionsByUser) != 2 || running.ConnectionsByUser["frodo"] != 2 || running.ConnectionsByUser["aragorn"] != 1 {
+			t.Errorf("Unexpected connections_by_user: %v", running.ConnectionsByUser)
+		}
+		if len(running.ConnectionsByIP) != 2 || running.ConnectionsByIP["10.0.0.1"] != 3 || running.ConnectionsByIP["10.0.0.2"] != 1 {
+			t.Errorf("Unexpected connections_by_ip: %v", running.ConnectionsByIP)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		w, err := New(tmpDir, 10*time.Second, "v1.0.0")
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		w.SetFormat(FormatJSON)
+
+		if err := w.writeRunningFile(); err != nil {
+			t.Fatalf("Failed to write running file: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "running"))
+		if err != nil {
+			t.Fatalf("Failed to read running file: %v", err)
+		}
+
+		var running map[string]interface{}
+		if err := json.Unmarshal(content, &running); err != nil {
+			t.Fatalf("Failed to parse running file: %v\n%s", err, content)
+		}
+		if byUser, ok := running["connections_by_user"].(map[string]interface{}); !ok || len(byUser) != 0 {
+			t.Errorf("Expected empty connections_by_user object, got %v", running["connections_by_user"])
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package users
+
+import "context"
+
+// ContextSource is implemented by sources whose loads can be cancelled
+type ContextSource interface {
+	// LoadUserContext loads user data for a given username, giving up when ctx is done
+	LoadUserContext(ctx context.Context, username string) (*User, error)
+}
+
+// LoadUserContext loads username from source, returning ctx.Err() once ctx is
+// done. Sources that implement ContextSource are given the context; any other
+// source is run in a goroutine that is abandoned on cancellation.
+func LoadUserContext(ctx context.Context, source Source, username string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cs, ok := source.(ContextSource); ok {
+		return cs.LoadUserContext(ctx, username)
+	}
+
+	type loadResult struct {
+		user *User
+		err  error
+	}
+	done := make(chan loadResult, 1)
+	go func() {
+		user, err := source.LoadUser(username)
+		done <- loadResult{user, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.user, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
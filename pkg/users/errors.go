@@ -1,6 +1,9 @@
 package users
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrUserNotFound is returned when a user does not exist
@@ -9,6 +12,39 @@ var (
 	// ErrInvalidHash is returned when a user file has an invalid password hash
 	ErrInvalidHash = errors.New("invalid password hash")
 
+	// ErrCorruptFile is returned when a user file cannot be parsed. It wraps
+	// the underlying parse error.
+	ErrCorruptFile = errors.New("corrupt user file")
+
+	// ErrUnreadable is returned when a user file exists but cannot be read
+	ErrUnreadable = errors.New("unreadable user file")
+
 	// ErrInvalidCredentials is returned when the username or password is incorrect
 	ErrInvalidCredentials = errors.New("invalid credentials")
 )
+
+// LoadError is returned by FileSource.LoadUser. Kind is ErrUserNotFound,
+// ErrInvalidHash, ErrCorruptFile or ErrUnreadable, and errors.Is matches it,
+// so callers can branch on the kind without inspecting messages. Cause, if
+// set, is the underlying error, such as an *lpc.ParseError.
+type LoadError struct {
+	Username string
+	Path     string
+	Kind     error
+	Cause    error
+}
+
+func (e *LoadError) Error() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("loading user %q: %v", e.Username, e.Kind)
+	}
+	return fmt.Sprintf("loading user %q: %v: %v", e.Username, e.Kind, e.Cause)
+}
+
+// Unwrap returns the kind and the cause, for errors.Is and errors.As
+func (e *LoadError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Cause}
+}
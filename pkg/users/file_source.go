@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/mmcdole/viking-ftpd/pkg/logging"
 	"github.com/mmcdole/viking-ftpd/pkg/lpc"
 )
@@ -15,19 +17,78 @@ const (
 	PasswordField = "password"
 	// LevelField is the field name for the user's level
 	LevelField = "level"
+	// CapNameField is the field name for the user's capitalized display name
+	CapNameField = "cap_name"
+	// GenderField is the field name for the user's gender code
+	GenderField = "gender"
+	// EmailField is the field name for the user's email address
+	EmailField = "email"
 )
 
+// DefaultExtension is the file extension of character files saved by the MUD
+const DefaultExtension = ".o"
+
+// PathFunc returns where a username's character file lives, relative to the
+// character directory and without its extension
+type PathFunc func(username string) string
+
+// LetterLayout stores each character in a subdirectory named after the first
+// letter of its name, e.g. "f/frodo". This is the default layout.
+func LetterLayout(username string) string {
+	return filepath.Join(strings.ToLower(username[0:1]), username)
+}
+
+// FlatLayout stores every character directly in the character directory
+func FlatLayout(username string) string {
+	return username
+}
+
+// ParseLayout converts a layout name into a PathFunc. An empty name selects
+// LetterLayout.
+func ParseLayout(name string) (PathFunc, error) {
+	switch name {
+	case "", "letter":
+		return LetterLayout, nil
+	case "flat":
+		return FlatLayout, nil
+	default:
+		return nil, fmt.Errorf("unknown character layout %q (expected \"letter\" or \"flat\")", name)
+	}
+}
+
 // FileSource implements Source using the filesystem
 type FileSource struct {
 	// rootDir is the path to the directory containing user subdirectories
-	rootDir string
+	rootDir   string
+	extension string
+	pathFunc  PathFunc
+
+	// Set while Watch is running
+	watcher   *fsnotify.Watcher
+	watchDone chan struct{}
 }
 
-// NewFileSource creates a new FileSource
+// NewFileSource creates a new FileSource using LetterLayout and DefaultExtension
 func NewFileSource(rootDir string) *FileSource {
 	return &FileSource{
-		rootDir: rootDir,
+		rootDir:   rootDir,
+		extension: DefaultExtension,
+		pathFunc:  LetterLayout,
+	}
+}
+
+// SetExtension sets the extension of character files, including the dot
+func (s *FileSource) SetExtension(extension string) {
+	s.extension = extension
+}
+
+// SetPathFunc sets how usernames map to character files. A nil PathFunc
+// restores LetterLayout.
+func (s *FileSource) SetPathFunc(pathFunc PathFunc) {
+	if pathFunc == nil {
+		pathFunc = LetterLayout
 	}
+	s.pathFunc = pathFunc
 }
 
 // getCharacterPath returns the full path to a user file
@@ -35,10 +96,7 @@ func (s *FileSource) getCharacterPath(username string) string {
 	if username == "" {
 		return ""
 	}
-	// Get first letter of username for subdirectory
-	firstLetter := strings.ToLower(username[0:1])
-	path := filepath.Join(s.rootDir, firstLetter, username+".o")
-	return path
+	return filepath.Join(s.rootDir, s.pathFunc(username)+s.extension)
 }
 
 // LoadUser implements Source
@@ -46,7 +104,7 @@ func (s *FileSource) LoadUser(username string) (*User, error) {
 	path := s.getCharacterPath(username)
 	if path == "" {
 		logging.App.Debug("Invalid username provided", "username", username)
-		return nil, fmt.Errorf("invalid username")
+		return nil, &LoadError{Username: username, Kind: ErrUserNotFound}
 	}
 
 	// Check if file exists
@@ -54,10 +112,10 @@ func (s *FileSource) LoadUser(username string) (*User, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			logging.App.Debug("User file not found", "username", username, "path", path)
-			return nil, ErrUserNotFound
+			return nil, &LoadError{Username: username, Path: path, Kind: ErrUserNotFound}
 		}
 		logging.App.Debug("Error reading user file", "username", username, "path", path, "error", err)
-		return nil, fmt.Errorf("reading user file: %w", err)
+		return nil, &LoadError{Username: username, Path: path, Kind: ErrUnreadable, Cause: err}
 	}
 
 	// Parse LPC object
@@ -65,19 +123,19 @@ func (s *FileSource) LoadUser(username string) (*User, error) {
 	result, err := parser.ParseObject(string(data))
 	if err != nil {
 		logging.App.Debug("Error parsing user file", "username", username, "path", path, "error", err)
-		return nil, fmt.Errorf("parsing user file: %w", err)
+		return nil, &LoadError{Username: username, Path: path, Kind: ErrCorruptFile, Cause: firstParseError(result, err)}
 	}
 
 	// Extract password hash
 	passwordRaw, ok := result.Object[PasswordField]
 	if !ok {
 		logging.App.Debug("Password field missing in user file", "username", username, "path", path)
-		return nil, ErrInvalidHash
+		return nil, &LoadError{Username: username, Path: path, Kind: ErrInvalidHash}
 	}
 	passwordHash, ok := passwordRaw.(string)
 	if !ok {
 		logging.App.Debug("Invalid password hash type in user file", "username", username, "path", path, "type", fmt.Sprintf("%T", passwordRaw))
-		return nil, ErrInvalidHash
+		return nil, &LoadError{Username: username, Path: path, Kind: ErrInvalidHash}
 	}
 
 	// Extract level, defaulting to MORTAL_FIRST if not found
@@ -88,6 +146,8 @@ func (s *FileSource) LoadUser(username string) (*User, error) {
 			level = int(v)
 		case int:
 			level = v
+		case int64:
+			level = int(v)
 		default:
 			logging.App.Debug("Invalid level type in user file", "username", username, "path", path, "type", fmt.Sprintf("%T", levelRaw))
 		}
@@ -100,5 +160,47 @@ func (s *FileSource) LoadUser(username string) (*User, error) {
 		Username:     username,
 		PasswordHash: passwordHash,
 		Level:        level,
+		CapName:      optionalString(result.Object, CapNameField),
+		Gender:       optionalInt(result.Object, GenderField),
+		Email:        optionalString(result.Object, EmailField),
 	}, nil
 }
+
+// ListUsers implements Lister by walking the character directory for files
+// with the configured extension. Files that are not where the layout would
+// put them are skipped. A missing root directory yields no users.
+func (s *FileSource) ListUsers() ([]string, error) {
+	if _, err := os.Stat(s.rootDir); os.IsNotExist(err) {
+		logging.App.Debug("Character directory not found", "path", s.rootDir)
+		return []string{}, nil
+	}
+
+	usernames := []string{}
+	err := filepath.WalkDir(s.rootDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		username, ok := s.usernameFor(path)
+		if !ok || entry.IsDir() || s.getCharacterPath(username) != path {
+			return nil
+		}
+		usernames = append(usernames, username)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading character directory: %w", err)
+	}
+
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+// usernameFor returns the username a character file path belongs to, if it
+// has the configured extension
+func (s *FileSource) usernameFor(path string) (string, bool) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(name, s.extension) || len(name) == len(s.extension) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, s.extension), true
+}
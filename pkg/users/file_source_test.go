@@ -1,9 +1,13 @@
 package users
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/mmcdole/viking-ftpd/pkg/lpc"
 )
 
 func TestFileSource_LoadUser(t *testing.T) {
@@ -49,7 +53,7 @@ gender 1`
 
 	// Test non-existent user
 	user, err = source.LoadUser("nonexistent")
-	if err != ErrUserNotFound {
+	if !errors.Is(err, ErrUserNotFound) {
 		t.Errorf("Expected ErrUserNotFound, got %v", err)
 	}
 
@@ -60,15 +64,19 @@ gender 1`
 	}
 
 	// Test invalid file format
-	invalidFile := filepath.Join(userDir, "invalid.o")
+	invalidDir := filepath.Join(tempDir, "i")
+	if err := os.MkdirAll(invalidDir, 0755); err != nil {
+		t.Fatalf("Failed to create invalid dir: %v", err)
+	}
+	invalidFile := filepath.Join(invalidDir, "invalid.o")
 	invalidData := `invalid format`
 	if err := os.WriteFile(invalidFile, []byte(invalidData), 0644); err != nil {
 		t.Fatalf("Failed to write invalid file: %v", err)
 	}
 
 	user, err = source.LoadUser("invalid")
-	if err == nil {
-		t.Error("Expected error for invalid file format, got nil")
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("Expected ErrCorruptFile for invalid file format, got %v", err)
 	}
 
 	// Test missing password
@@ -85,7 +93,7 @@ gender 1`
 	}
 
 	user, err = source.LoadUser("nopass")
-	if err != ErrInvalidHash {
+	if !errors.Is(err, ErrInvalidHash) {
 		t.Errorf("Expected ErrInvalidHash, got %v", err)
 	}
 
@@ -110,3 +118,202 @@ gender 1`
 		t.Errorf("Expected default level %d, got %d", MORTAL_FIRST, user.Level)
 	}
 }
+
+func TestFileSource_LoadUserOptionalFields(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name string
+		data string
+		want User
+	}{
+		{
+			name: "full",
+			data: `password "hashedpass"
+level 31
+cap_name "Frodo"
+gender 1
+email "frodo@shire.example"`,
+			want: User{Username: "full", PasswordHash: "hashedpass", Level: 31, CapName: "Frodo", Gender: 1, Email: "frodo@shire.example"},
+		},
+		{
+			name: "minimal",
+			data: `password "hashedpass"
+level 5`,
+			want: User{Username: "minimal", PasswordHash: "hashedpass", Level: 5},
+		},
+	}
+
+	source := NewFileSource(tempDir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(tempDir, tt.name[:1])
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("Failed to create user dir: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, tt.name+".o"), []byte(tt.data), 0644); err != nil {
+				t.Fatalf("Failed to write user file: %v", err)
+			}
+
+			user, err := source.LoadUser(tt.name)
+			if err != nil {
+				t.Fatalf("LoadUser failed: %v", err)
+			}
+			if *user != tt.want {
+				t.Errorf("LoadUser = %+v, want %+v", *user, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileSource_ListUsers(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{"a/aragorn.o", "f/frodo.o", "f/faramir.o", "s/sam.o", "s/notes.txt"}
+	for _, file := range files {
+		path := filepath.Join(tempDir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(`password "x"`), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	// Stray files in the root and empty buckets are ignored
+	if err := os.WriteFile(filepath.Join(tempDir, "README"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write README: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "z"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	got, err := NewFileSource(tempDir).ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	want := []string{"aragorn", "faramir", "frodo", "sam"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListUsers = %v, want %v", got, want)
+	}
+
+	// A missing character directory has no users
+	got, err = NewFileSource(filepath.Join(tempDir, "missing")).ListUsers()
+	if err != nil {
+		t.Errorf("ListUsers on missing dir failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ListUsers on missing dir = %v, want none", got)
+	}
+}
+
+func TestFileSource_Layouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		layout    string
+		extension string
+		files     []string
+	}{
+		{"Flat", "flat", ".o", []string{"frodo.o", "sam.o", "f/faramir.o"}},
+		{"CustomExtension", "letter", ".dat", []string{"f/frodo.dat", "s/sam.dat", "f/faramir.o"}},
+		{"FlatCustomExtension", "flat", ".dat", []string{"frodo.dat", "sam.dat", "faramir.o"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, file := range tt.files {
+				path := filepath.Join(tempDir, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create dir: %v", err)
+				}
+				if err := os.WriteFile(path, []byte("password \"x\"\nlevel 30\n"), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", file, err)
+				}
+			}
+
+			pathFunc, err := ParseLayout(tt.layout)
+			if err != nil {
+				t.Fatalf("ParseLayout(%q) failed: %v", tt.layout, err)
+			}
+			source := NewFileSource(tempDir)
+			source.SetPathFunc(pathFunc)
+			source.SetExtension(tt.extension)
+
+			user, err := source.LoadUser("frodo")
+			if err != nil {
+				t.Fatalf("LoadUser failed: %v", err)
+			}
+			if user.Level != 30 {
+				t.Errorf("Expected level 30, got %d", user.Level)
+			}
+
+			// faramir's file is not where this layout looks for it
+			if _, err := source.LoadUser("faramir"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Expected ErrUserNotFound for faramir, got %v", err)
+			}
+
+			got, err := source.ListUsers()
+			if err != nil {
+				t.Fatalf("ListUsers failed: %v", err)
+			}
+			if want := []string{"frodo", "sam"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("ListUsers = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := ParseLayout("nested"); err == nil {
+		t.Error("Expected error for unknown layout")
+	}
+}
+
+func TestFileSource_LoadErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"n/nopass.o":  "level 50\n",
+		"c/corrupt.o": "password \"unterminated\nlevel ({2|1\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(tempDir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	// A directory where the file should be exists but cannot be read
+	if err := os.MkdirAll(filepath.Join(tempDir, "d", "dir.o"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	tests := []struct {
+		username string
+		want     error
+	}{
+		{"missing", ErrUserNotFound},
+		{"nopass", ErrInvalidHash},
+		{"corrupt", ErrCorruptFile},
+		{"dir", ErrUnreadable},
+	}
+
+	source := NewFileSource(tempDir)
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			_, err := source.LoadUser(tt.username)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("LoadUser(%q) = %v, want %v", tt.username, err, tt.want)
+			}
+			var loadErr *LoadError
+			if !errors.As(err, &loadErr) || loadErr.Username != tt.username || loadErr.Kind != tt.want {
+				t.Errorf("Expected a *LoadError for %s with kind %v, got %#v", tt.username, tt.want, err)
+			}
+		})
+	}
+
+	// Parse errors keep the line they were found on
+	_, err := source.LoadUser("corrupt")
+	var parseErr *lpc.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line == 0 {
+		t.Errorf("Expected an *lpc.ParseError with a line number, got %v", err)
+	}
+}
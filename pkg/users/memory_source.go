@@ -1,6 +1,9 @@
 package users
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 // MemorySource implements Source using an in-memory map
 type MemorySource struct {
@@ -40,3 +43,16 @@ func (s *MemorySource) RemoveUser(username string) {
 	defer s.mu.Unlock()
 	delete(s.users, username)
 }
+
+// ListUsers implements Lister
+func (s *MemorySource) ListUsers() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	usernames := make([]string, 0, len(s.users))
+	for username := range s.users {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
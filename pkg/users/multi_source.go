@@ -0,0 +1,59 @@
+package users
+
+import (
+	"errors"
+	"sort"
+)
+
+// MultiSource implements Source by trying several sources in order, for
+// instance the live character directory followed by an archive
+type MultiSource struct {
+	sources []Source
+}
+
+// NewMultiSource creates a MultiSource that consults sources in the given
+// order
+func NewMultiSource(sources ...Source) *MultiSource {
+	return &MultiSource{sources: sources}
+}
+
+// LoadUser implements Source. It returns the user from the first source
+// that has them. Any error other than ErrUserNotFound stops the search, so
+// a corrupt file in an earlier source is never masked by a later one.
+func (s *MultiSource) LoadUser(username string) (*User, error) {
+	for _, source := range s.sources {
+		user, err := source.LoadUser(username)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// ListUsers implements Lister, merging the users of every source that can
+// list them
+func (s *MultiSource) ListUsers() ([]string, error) {
+	seen := make(map[string]bool)
+	var usernames []string
+	for _, source := range s.sources {
+		lister, ok := source.(Lister)
+		if !ok {
+			continue
+		}
+		names, err := lister.ListUsers()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				usernames = append(usernames, name)
+			}
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
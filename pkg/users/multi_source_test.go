@@ -0,0 +1,69 @@
+package users
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// failingSource returns err for every user
+type failingSource struct {
+	err error
+}
+
+func (s failingSource) LoadUser(username string) (*User, error) {
+	return nil, s.err
+}
+
+func TestMultiSource(t *testing.T) {
+	live := NewMemorySource()
+	live.AddUser(&User{Username: "frodo", Level: WIZARD})
+	archive := NewMemorySource()
+	archive.AddUser(&User{Username: "frodo", Level: MORTAL_FIRST})
+	archive.AddUser(&User{Username: "bilbo", Level: ELDER})
+
+	source := NewMultiSource(live, archive)
+
+	t.Run("first source hit", func(t *testing.T) {
+		user, err := source.LoadUser("frodo")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.Level != WIZARD {
+			t.Errorf("expected the live character (level %d), got level %d", WIZARD, user.Level)
+		}
+	})
+
+	t.Run("fallback hit", func(t *testing.T) {
+		user, err := source.LoadUser("bilbo")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.Level != ELDER {
+			t.Errorf("expected level %d, got %d", ELDER, user.Level)
+		}
+	})
+
+	t.Run("all miss", func(t *testing.T) {
+		if _, err := source.LoadUser("gollum"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("error stops the search", func(t *testing.T) {
+		corrupt := failingSource{err: ErrCorruptFile}
+		if _, err := NewMultiSource(corrupt, archive).LoadUser("bilbo"); !errors.Is(err, ErrCorruptFile) {
+			t.Errorf("expected ErrCorruptFile, got %v", err)
+		}
+	})
+
+	t.Run("list merges sources", func(t *testing.T) {
+		names, err := NewMultiSource(live, failingSource{err: ErrUserNotFound}, archive).ListUsers()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"bilbo", "frodo"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("expected %v, got %v", want, names)
+		}
+	})
+}
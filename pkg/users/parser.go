@@ -6,16 +6,18 @@ import (
 	"github.com/mmcdole/viking-ftpd/pkg/lpc"
 )
 
-// ParseUserFile parses a user file in LPC object format
+// ParseUserFile parses a user file in LPC object format. A file that cannot be
+// parsed yields ErrCorruptFile; one that parses but has no string password
+// yields ErrInvalidHash.
 func ParseUserFile(data []byte) (*User, error) {
 	parser := lpc.NewObjectParser(false) // non-strict mode for better error handling
 	result, err := parser.ParseObject(string(data))
 	if err != nil {
-		return nil, fmt.Errorf("parsing user file: %w", err)
+		return nil, corruptFile(result, err)
 	}
 
 	// Extract password hash
-	passwordRaw, ok := result.Object["password"]
+	passwordRaw, ok := result.Object[PasswordField]
 	if !ok {
 		return nil, ErrInvalidHash
 	}
@@ -26,17 +28,56 @@ func ParseUserFile(data []byte) (*User, error) {
 
 	// Extract level, defaulting to MORTAL_FIRST if not found
 	level := MORTAL_FIRST // Default to mortal if not found
-	if levelRaw, ok := result.Object["level"]; ok {
+	if levelRaw, ok := result.Object[LevelField]; ok {
 		switch v := levelRaw.(type) {
 		case float64:
 			level = int(v)
 		case int:
 			level = v
+		case int64:
+			level = int(v)
 		}
 	}
 
 	return &User{
 		PasswordHash: passwordHash,
 		Level:        level,
+		CapName:      optionalString(result.Object, CapNameField),
+		Gender:       optionalInt(result.Object, GenderField),
+		Email:        optionalString(result.Object, EmailField),
 	}, nil
 }
+
+// corruptFile wraps a failed parse in ErrCorruptFile
+func corruptFile(result *lpc.ParseResult, err error) error {
+	return fmt.Errorf("%w: %w", ErrCorruptFile, firstParseError(result, err))
+}
+
+// firstParseError returns the first *lpc.ParseError of a failed parse, which
+// carries the line number, or the summary error if there is none
+func firstParseError(result *lpc.ParseResult, err error) error {
+	if result != nil && len(result.Errors) > 0 {
+		return result.Errors[0]
+	}
+	return err
+}
+
+// optionalString returns a string field, or "" if it is missing or not a string
+func optionalString(object map[string]interface{}, field string) string {
+	s, _ := object[field].(string)
+	return s
+}
+
+// optionalInt returns an integer field, or 0 if it is missing or not a number
+func optionalInt(object map[string]interface{}, field string) int {
+	switch v := object[field].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
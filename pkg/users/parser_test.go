@@ -0,0 +1,56 @@
+package users
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mmcdole/viking-ftpd/pkg/lpc"
+)
+
+func TestParseUserFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"Valid", "password \"hash\"\nlevel 30\n", nil},
+		{"Malformed", "password \"unterminated\nlevel ({2|1\n", ErrCorruptFile},
+		{"NotAnObject", "this is not a character file\n", ErrCorruptFile},
+		{"MissingPassword", "level 30\ncap_name \"Frodo\"\n", ErrInvalidHash},
+		{"PasswordNotString", "password 12345\n", ErrInvalidHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseUserFile([]byte(tt.data))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+
+			// Corruption and a missing password are never confused
+			if tt.wantErr == ErrCorruptFile && errors.Is(err, ErrInvalidHash) {
+				t.Errorf("Corrupt file also matched ErrInvalidHash: %v", err)
+			}
+			if tt.wantErr == ErrInvalidHash && errors.Is(err, ErrCorruptFile) {
+				t.Errorf("Missing password also matched ErrCorruptFile: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseUserFileWrapsParseError(t *testing.T) {
+	_, err := ParseUserFile([]byte("password \"unterminated\n"))
+	var parseErr *lpc.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected an *lpc.ParseError in %v", err)
+	}
+	if parseErr.Line != 1 {
+		t.Errorf("Expected error on line 1, got line %d", parseErr.Line)
+	}
+}
@@ -1,6 +1,8 @@
 package users
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -15,6 +17,10 @@ type Repository struct {
 	mu          sync.RWMutex
 	cache       map[string]*User
 	lastRefresh map[string]time.Time
+
+	// Cached result of ListUsers, which walks every character file
+	usernames   []string
+	lastListing time.Time
 }
 
 // NewRepository creates a new Repository
@@ -58,6 +64,25 @@ func (r *Repository) GetUser(username string) (*User, error) {
 	return user, nil
 }
 
+// LoadUser implements Source, so a Repository can stand in for its source
+func (r *Repository) LoadUser(username string) (*User, error) {
+	return r.GetUser(username)
+}
+
+// Warm preloads the given users into the cache and returns how many were
+// loaded. Users that fail to load are logged and skipped.
+func (r *Repository) Warm(usernames []string) int {
+	loaded := 0
+	for _, username := range usernames {
+		if err := r.RefreshUser(username); err != nil {
+			logging.App.Warn("Failed to preload user", "username", username, "error", err)
+			continue
+		}
+		loaded++
+	}
+	return loaded
+}
+
 // RefreshUser forces a refresh of user data from the source
 func (r *Repository) RefreshUser(username string) error {
 	logging.App.Debug("Forcing user cache refresh", "username", username)
@@ -79,10 +104,22 @@ func (r *Repository) RefreshUser(username string) error {
 	return nil
 }
 
+// Invalidate drops a user from the cache so the next lookup reads the
+// source. It is used as the FileSource.Watch callback.
+func (r *Repository) Invalidate(username string) {
+	r.mu.Lock()
+	delete(r.cache, username)
+	delete(r.lastRefresh, username)
+	r.usernames = nil
+	r.mu.Unlock()
+
+	logging.App.Debug("Invalidated user cache", "username", username)
+}
+
 // UserExists checks if a user exists
 func (r *Repository) UserExists(username string) (bool, error) {
 	_, err := r.GetUser(username)
-	if err == ErrUserNotFound {
+	if errors.Is(err, ErrUserNotFound) {
 		return false, nil
 	}
 	if err != nil {
@@ -90,3 +127,33 @@ func (r *Repository) UserExists(username string) (bool, error) {
 	}
 	return true, nil
 }
+
+// ListUsers returns every username in the source, using the cache if it is
+// fresh. It fails if the source does not implement Lister.
+func (r *Repository) ListUsers() ([]string, error) {
+	lister, ok := r.source.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("user source cannot list users")
+	}
+
+	r.mu.RLock()
+	usernames, lastListing := r.usernames, r.lastListing
+	r.mu.RUnlock()
+
+	if usernames != nil && time.Since(lastListing) < r.cacheDuration {
+		return usernames, nil
+	}
+
+	usernames, err := lister.ListUsers()
+	if err != nil {
+		logging.App.Debug("Failed to list users from source", "error", err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.usernames = usernames
+	r.lastListing = time.Now()
+	r.mu.Unlock()
+
+	return usernames, nil
+}
@@ -121,4 +121,49 @@ func TestRepository(t *testing.T) {
 			t.Error("UserExists returned true for non-existent user")
 		}
 	})
+	t.Run("list users", func(t *testing.T) {
+		source.AddUser(&User{Username: "another"})
+
+		usernames, err := repository.ListUsers()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(usernames) != 2 || usernames[0] != "another" || usernames[1] != "testuser" {
+			t.Errorf("expected [another testuser], got %v", usernames)
+		}
+
+		// The listing is cached like user data
+		source.AddUser(&User{Username: "newcomer"})
+		usernames, _ = repository.ListUsers()
+		if len(usernames) != 2 {
+			t.Errorf("expected cached listing, got %v", usernames)
+		}
+
+		time.Sleep(150 * time.Millisecond)
+		usernames, _ = repository.ListUsers()
+		if len(usernames) != 3 {
+			t.Errorf("expected listing to refresh after expiry, got %v", usernames)
+		}
+	})
+}
+
+func TestRepositoryWarm(t *testing.T) {
+	source := NewMemorySource()
+	source.AddUser(&User{Username: "frodo", Level: WIZARD})
+	source.AddUser(&User{Username: "sam", Level: MORTAL_FIRST})
+	repository := NewRepository(source, time.Hour)
+
+	if loaded := repository.Warm([]string{"frodo", "sam", "nobody"}); loaded != 2 {
+		t.Errorf("expected 2 users preloaded, got %d", loaded)
+	}
+
+	// Preloaded users are served from the cache
+	source.RemoveUser("frodo")
+	user, err := repository.LoadUser("frodo")
+	if err != nil {
+		t.Fatalf("expected cached user, got error: %v", err)
+	}
+	if user.Level != WIZARD {
+		t.Errorf("expected level %d, got %d", WIZARD, user.Level)
+	}
 }
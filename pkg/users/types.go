@@ -5,6 +5,9 @@ type User struct {
 	Username     string
 	PasswordHash string
 	Level        int
+	CapName      string // Capitalized display name; empty if not set
+	Gender       int    // Gender code as stored by the MUD; zero if not set
+	Email        string // Empty if not set
 }
 
 // Source represents a source of user data
@@ -13,6 +16,12 @@ type Source interface {
 	LoadUser(username string) (*User, error)
 }
 
+// Lister is implemented by sources that can enumerate their users
+type Lister interface {
+	// ListUsers returns every username in the source, sorted
+	ListUsers() ([]string, error)
+}
+
 // Constants for user levels
 const (
 	MORTAL_FIRST  = 1
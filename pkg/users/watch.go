@@ -0,0 +1,105 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mmcdole/viking-ftpd/pkg/logging"
+)
+
+// Watch starts watching the character directory and calls onChange with the
+// username of every character file that is created, written, removed or
+// renamed. Every directory under the root is watched; directories created
+// later are picked up as they appear. Call Close to stop watching.
+func (s *FileSource) Watch(onChange func(username string)) error {
+	if s.watcher != nil {
+		return fmt.Errorf("already watching %s", s.rootDir)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+	if err := addDirs(watcher, s.rootDir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watching character directory: %w", err)
+	}
+
+	s.watcher = watcher
+	s.watchDone = make(chan struct{})
+	go s.watch(watcher, onChange)
+
+	logging.App.Debug("Watching character files", "path", s.rootDir, "directories", len(watcher.WatchList()))
+	return nil
+}
+
+// addDirs watches root and every directory below it
+func addDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	})
+}
+
+// Close stops watching for changes. It is a no-op if Watch was not called.
+func (s *FileSource) Close() error {
+	if s.watcher == nil {
+		return nil
+	}
+	err := s.watcher.Close()
+	<-s.watchDone
+	s.watcher = nil
+	return err
+}
+
+// watch dispatches watcher events until the watcher is closed
+func (s *FileSource) watch(watcher *fsnotify.Watcher, onChange func(username string)) {
+	defer close(s.watchDone)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			s.handleEvent(watcher, event, onChange)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logging.App.Warn("Character file watcher error", "path", s.rootDir, "error", err)
+		}
+	}
+}
+
+// handleEvent maps a single event back to a username, adding watches for
+// directories created under the root
+func (s *FileSource) handleEvent(watcher *fsnotify.Watcher, event fsnotify.Event, onChange func(username string)) {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := addDirs(watcher, event.Name); err != nil {
+				logging.App.Warn("Failed to watch character directory", "path", event.Name, "error", err)
+			}
+			return
+		}
+	}
+
+	username, ok := s.usernameFor(event.Name)
+	if !ok {
+		return
+	}
+
+	logging.App.Debug("Character file changed", "username", username, "op", event.Op.String())
+	onChange(username)
+}
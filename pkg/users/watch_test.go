@@ -0,0 +1,130 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCharacter(t *testing.T, root, username string, level int) {
+	t.Helper()
+	dir := filepath.Join(root, username[0:1])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+	data := fmt.Sprintf("password \"hash\"\nlevel %d\n", level)
+	if err := os.WriteFile(filepath.Join(dir, username+".o"), []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write character file: %v", err)
+	}
+}
+
+// cached reports whether username is currently in the repository cache
+func cached(r *Repository, username string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.cache[username]
+	return ok
+}
+
+func TestFileSourceWatch(t *testing.T) {
+	root := t.TempDir()
+	writeCharacter(t, root, "frodo", 1)
+	writeCharacter(t, root, "sam", 1)
+
+	source := NewFileSource(root)
+	repository := NewRepository(source, time.Hour)
+
+	invalidated := make(chan string, 10)
+	if err := source.Watch(func(username string) {
+		repository.Invalidate(username)
+		invalidated <- username
+	}); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer source.Close()
+
+	for _, username := range []string{"frodo", "sam"} {
+		if _, err := repository.GetUser(username); err != nil {
+			t.Fatalf("GetUser(%s) failed: %v", username, err)
+		}
+	}
+
+	writeCharacter(t, root, "frodo", WIZARD)
+
+	select {
+	case username := <-invalidated:
+		if username != "frodo" {
+			t.Fatalf("Expected frodo to be invalidated, got %s", username)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for frodo to be invalidated")
+	}
+
+	if cached(repository, "frodo") {
+		t.Error("Expected frodo to be dropped from the cache")
+	}
+	if !cached(repository, "sam") {
+		t.Error("Expected sam to stay cached")
+	}
+
+	user, err := repository.GetUser("frodo")
+	if err != nil {
+		t.Fatalf("GetUser(frodo) failed: %v", err)
+	}
+	if user.Level != WIZARD {
+		t.Errorf("Expected updated level %d, got %d", WIZARD, user.Level)
+	}
+}
+
+func TestFileSourceWatchNewBucket(t *testing.T) {
+	root := t.TempDir()
+	source := NewFileSource(root)
+
+	changed := make(chan string, 10)
+	if err := source.Watch(func(username string) { changed <- username }); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	defer source.Close()
+
+	// The bucket is created first, then the file; give the watcher a moment
+	// to add the new bucket before the file appears
+	if err := os.Mkdir(filepath.Join(root, "g"), 0755); err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+	deadline := time.After(5 * time.Second)
+	for {
+		time.Sleep(50 * time.Millisecond)
+		writeCharacter(t, root, "gandalf", 1)
+		select {
+		case username := <-changed:
+			if username != "gandalf" {
+				t.Fatalf("Expected gandalf, got %s", username)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Timed out waiting for a change in the new bucket")
+		default:
+		}
+	}
+}
+
+func TestFileSourceClose(t *testing.T) {
+	source := NewFileSource(t.TempDir())
+
+	// Close without Watch is a no-op
+	if err := source.Close(); err != nil {
+		t.Errorf("Close without Watch failed: %v", err)
+	}
+
+	if err := source.Watch(func(string) {}); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if err := source.Watch(func(string) {}); err == nil {
+		t.Error("Expected error watching twice")
+	}
+	if err := source.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}